@@ -0,0 +1,183 @@
+// Command apikey issues, lists and revokes API keys directly against the database,
+// which is how the first admin key of a deployment is created.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"image-rag-backend/internal/config"
+	"image-rag-backend/internal/database"
+	"image-rag-backend/internal/models"
+	"image-rag-backend/internal/services"
+)
+
+const usage = `Usage:
+  apikey create [-tenant name] -name name -scopes scope[,scope] [-expires duration]
+                [-rate-limits class=limit[,class=limit]]
+  apikey list [-tenant name]
+  apikey revoke [-tenant name] -id id
+
+Scopes: records:read, records:write, search, admin
+Rate limit classes: read, write, search, upload (e.g. search=600/m)`
+
+func main() {
+	if len(os.Args) < 2 {
+		exit(usage)
+	}
+
+	cfg := config.Load()
+	if err := database.InitDB(cfg); err != nil {
+		exit(err.Error())
+	}
+	defer database.CloseDB()
+
+	command, args := os.Args[1], os.Args[2:]
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	tenantName := fs.String("tenant", services.DefaultTenantName, "tenant owning the key")
+
+	var err error
+	switch command {
+	case "create":
+		name := fs.String("name", "", "key name")
+		scopes := fs.String("scopes", "", "comma separated scopes")
+		expires := fs.Duration("expires", 0, "key lifetime, e.g. 720h; zero never expires")
+		rateLimits := fs.String("rate-limits", "", "comma separated class=limit overrides")
+		_ = fs.Parse(args)
+		err = create(*tenantName, *name, *scopes, *expires, *rateLimits)
+	case "list":
+		_ = fs.Parse(args)
+		err = list(*tenantName)
+	case "revoke":
+		id := fs.Uint("id", 0, "key ID")
+		_ = fs.Parse(args)
+		err = revoke(*tenantName, *id)
+	default:
+		exit(usage)
+	}
+
+	if err != nil {
+		exit(err.Error())
+	}
+}
+
+func create(tenantName, name, scopes string, expires time.Duration, rateLimits string) error {
+	tenant, err := lookupTenant(tenantName)
+	if err != nil {
+		return err
+	}
+
+	var expiresAt *time.Time
+	if expires > 0 {
+		t := time.Now().Add(expires)
+		expiresAt = &t
+	}
+
+	limits, err := parseRateLimits(rateLimits)
+	if err != nil {
+		return err
+	}
+
+	key, secret, err := services.NewAPIKeyService().CreateKey(tenant.ID, name, strings.Split(scopes, ","), expiresAt,
+		limits)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created API key %d (%s) for tenant %s with scopes %s\n",
+		key.ID, key.Name, tenant.Name, strings.Join(key.Scopes, ","))
+	fmt.Printf("Key: %s\n", secret)
+	fmt.Println("Store it now; it cannot be shown again.")
+	return nil
+}
+
+func list(tenantName string) error {
+	tenant, err := lookupTenant(tenantName)
+	if err != nil {
+		return err
+	}
+
+	keys, err := services.NewAPIKeyService().ListKeys(tenant.ID)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tSTATUS\tLAST USED")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Prefix,
+			strings.Join(key.Scopes, ","), keyStatus(key), formatTime(key.LastUsedAt))
+	}
+	return w.Flush()
+}
+
+func revoke(tenantName string, id uint) error {
+	if id == 0 {
+		return fmt.Errorf("-id is required")
+	}
+
+	tenant, err := lookupTenant(tenantName)
+	if err != nil {
+		return err
+	}
+
+	key, err := services.NewAPIKeyService().RevokeKey(tenant.ID, id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Revoked API key %d (%s)\n", key.ID, key.Name)
+	return nil
+}
+
+// parseRateLimits parses class=limit pairs such as search=600/m,upload=60/m
+func parseRateLimits(value string) (models.RateLimits, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	limits := make(models.RateLimits)
+	for _, pair := range strings.Split(value, ",") {
+		class, limit, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit override %q: expected class=limit", pair)
+		}
+		limits[class] = limit
+	}
+	return limits, nil
+}
+
+func lookupTenant(name string) (*models.Tenant, error) {
+	tenant, err := services.NewTenantService(nil).GetTenantByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%v (tenants are created when the server starts)", err)
+	}
+	return tenant, nil
+}
+
+func keyStatus(key models.APIKey) string {
+	switch {
+	case key.RevokedAt != nil:
+		return "revoked"
+	case key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func exit(message string) {
+	fmt.Fprintln(os.Stderr, message)
+	os.Exit(1)
+}
@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 	"time"
 
@@ -15,7 +14,6 @@ import (
 	"image-rag-backend/internal/config"
 	"image-rag-backend/internal/database"
 	"image-rag-backend/internal/logger"
-	"image-rag-backend/internal/services"
 )
 
 func main() {
@@ -35,15 +33,6 @@ func main() {
 		log.Info("Database connection closed")
 	}()
 
-	// Ensure upload directories exist
-	if err := services.EnsureDirectoryExists(cfg.Upload.Path); err != nil {
-		log.Fatal("Failed to create upload directory: %v", err)
-	}
-
-	if err := services.EnsureDirectoryExists(filepath.Join(cfg.Upload.Path, "temp")); err != nil {
-		log.Fatal("Failed to create temp directory: %v", err)
-	}
-
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") != "release" {
 		gin.SetMode(gin.DebugMode)
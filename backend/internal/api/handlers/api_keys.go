@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/logger"
+	"image-rag-backend/internal/models"
+	"image-rag-backend/internal/services"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+	logger        *logger.Logger
+}
+
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService, logger *logger.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+		logger:        logger,
+	}
+}
+
+// ListAPIKeys returns the tenant's API keys without their secrets
+// @Summary List API keys
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Router /api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	keys, err := h.apiKeyService.ListKeys(tenant.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  keys,
+		"total": len(keys),
+	})
+}
+
+// CreateAPIKey issues an API key; the plaintext key is only returned in this response
+// @Summary Create API key
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param key body models.CreateAPIKeyRequest true "Key name, scopes and optional expiry"
+// @Success 201 {object} models.CreateAPIKeyResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, secret, err := h.apiKeyService.CreateKey(tenant.ID, req.Name, req.Scopes, req.ExpiresAt, req.RateLimits)
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("API key %d (%s) created for tenant %s", key.ID, key.Prefix, tenant.Name)
+	c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{APIKey: *key, Key: secret})
+}
+
+// RevokeAPIKey revokes an API key
+// @Summary Revoke API key
+// @Tags Admin
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} models.APIKey
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key ID"})
+		return
+	}
+
+	key, err := h.apiKeyService.RevokeKey(tenant.ID, uint(id))
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("API key %d (%s) revoked for tenant %s", key.ID, key.Prefix, tenant.Name)
+	c.JSON(http.StatusOK, key)
+}
+
+// apiKeyErrorStatus maps API key service errors to HTTP status codes
+func apiKeyErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.HasPrefix(msg, "invalid") || strings.Contains(msg, "required"):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
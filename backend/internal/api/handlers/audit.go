@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/authz"
+	"image-rag-backend/internal/logger"
+	"image-rag-backend/internal/models"
+	"image-rag-backend/internal/services"
+)
+
+// tenantAdminActor is the audit actor for static tenant tokens and anonymous development callers
+const tenantAdminActor = "tenant-admin"
+
+type AuditHandler struct {
+	auditService *services.AuditService
+	logger       *logger.Logger
+}
+
+func NewAuditHandler(auditService *services.AuditService, logger *logger.Logger) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// ListAuditEntries returns the tenant's audit log, newest first
+// @Summary List audit log entries
+// @Tags Admin
+// @Produce json
+// @Param actor query string false "Actor, e.g. user:123 or apikey:4"
+// @Param action query string false "create, update, delete, restore or purge"
+// @Param entity_type query string false "record or image"
+// @Param entity_id query int false "Entity ID"
+// @Param request_id query string false "Request ID"
+// @Param from query string false "Earliest entry (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Latest entry (RFC3339 or YYYY-MM-DD)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Entries per page (max 100)" default(50)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /audit [get]
+func (h *AuditHandler) ListAuditEntries(c *gin.Context) {
+	opts, err := parseAuditListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+	opts.Limit = limit
+	opts.Offset = (page - 1) * limit
+
+	entries, total, err := h.auditService.ListEntries(opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  entries,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// ExportAuditEntries streams every matching audit entry as JSON Lines, oldest first
+// @Summary Export audit log as JSONL
+// @Tags Admin
+// @Produce application/x-ndjson
+// @Param actor query string false "Actor"
+// @Param action query string false "create, update, delete, restore or purge"
+// @Param entity_type query string false "record or image"
+// @Param entity_id query int false "Entity ID"
+// @Param request_id query string false "Request ID"
+// @Param from query string false "Earliest entry (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Latest entry (RFC3339 or YYYY-MM-DD)"
+// @Success 200 {string} string "One JSON audit entry per line"
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /audit/export [get]
+func (h *AuditHandler) ExportAuditEntries(c *gin.Context) {
+	opts, err := parseAuditListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	c.Status(http.StatusOK)
+
+	// Headers are already sent, so a failure can only be logged and the stream cut short
+	if err := h.auditService.Export(opts, c.Writer); err != nil {
+		h.logger.Error("audit export failed: %v", err)
+	}
+}
+
+// parseAuditListOptions reads audit filters from the query string
+func parseAuditListOptions(c *gin.Context) (services.AuditListOptions, error) {
+	opts := services.AuditListOptions{
+		TenantID:   middleware.TenantFromContext(c).ID,
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		EntityType: c.Query("entity_type"),
+		RequestID:  c.Query("request_id"),
+	}
+
+	switch opts.Action {
+	case "", models.AuditActionCreate, models.AuditActionUpdate, models.AuditActionDelete,
+		models.AuditActionRestore, models.AuditActionPurge:
+	default:
+		return opts, fmt.Errorf("invalid action: %s", opts.Action)
+	}
+	switch opts.EntityType {
+	case "", models.AuditEntityRecord, models.AuditEntityImage:
+	default:
+		return opts, fmt.Errorf("invalid entity_type: %s", opts.EntityType)
+	}
+
+	if value := c.Query("entity_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return opts, fmt.Errorf("invalid entity_id: %s", value)
+		}
+		opts.EntityID = uint(id)
+	}
+
+	var err error
+	if opts.From, err = parseTimeQuery(c, "from", false); err != nil {
+		return opts, err
+	}
+	if opts.To, err = parseTimeQuery(c, "to", true); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// auditActor identifies the caller and request for the audit log
+func auditActor(c *gin.Context) services.AuditActor {
+	actor := authz.OwnerID(middleware.PrincipalFromContext(c))
+	if actor == "" {
+		actor = tenantAdminActor
+	}
+	return services.AuditActor{ID: actor, RequestID: middleware.RequestIDFromContext(c)}
+}
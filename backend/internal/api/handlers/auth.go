@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"image-rag-backend/internal/api/middleware"
+)
+
+type AuthHandler struct{}
+
+func NewAuthHandler() *AuthHandler {
+	return &AuthHandler{}
+}
+
+// GetCurrentUser returns the identity, tenant, roles and scopes of the caller
+// @Summary Get current user
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Router /auth/me [get]
+func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"subject":    principal.Subject,
+		"name":       principal.Name,
+		"email":      principal.Email,
+		"tenant":     principal.Tenant.Name,
+		"api_key_id": principal.APIKeyID,
+		"roles":      principal.Roles,
+		"scopes":     principal.Scopes,
+	})
+}
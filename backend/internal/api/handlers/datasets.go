@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/logger"
+	"image-rag-backend/internal/models"
+	"image-rag-backend/internal/services"
+)
+
+type DatasetHandler struct {
+	datasetService *services.DatasetService
+	logger         *logger.Logger
+}
+
+func NewDatasetHandler(datasetService *services.DatasetService, logger *logger.Logger) *DatasetHandler {
+	return &DatasetHandler{
+		datasetService: datasetService,
+		logger:         logger,
+	}
+}
+
+// ListDatasets returns all datasets with record and image counts
+// @Summary List datasets
+// @Tags Datasets
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /datasets [get]
+func (h *DatasetHandler) ListDatasets(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	datasets, err := h.datasetService.ListDatasets(tenant.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  datasets,
+		"total": len(datasets),
+	})
+}
+
+// CreateDataset creates a dataset and its vector partition
+// @Summary Create dataset
+// @Tags Datasets
+// @Accept json
+// @Produce json
+// @Param dataset body models.CreateDatasetRequest true "Dataset"
+// @Success 201 {object} models.Dataset
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /datasets [post]
+func (h *DatasetHandler) CreateDataset(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	var req models.CreateDatasetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dataset, err := h.datasetService.CreateDataset(tenant.ID, req.Name, req.Description)
+	if err != nil {
+		c.JSON(datasetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dataset)
+}
+
+// UpdateDataset renames a dataset or updates its description
+// @Summary Update dataset
+// @Tags Datasets
+// @Accept json
+// @Produce json
+// @Param id path int true "Dataset ID"
+// @Param dataset body models.UpdateDatasetRequest true "Dataset changes"
+// @Success 200 {object} models.Dataset
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /datasets/{id} [put]
+func (h *DatasetHandler) UpdateDataset(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dataset ID"})
+		return
+	}
+
+	var req models.UpdateDatasetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dataset, err := h.datasetService.UpdateDataset(tenant.ID, uint(id), req.Name, req.Description)
+	if err != nil {
+		c.JSON(datasetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dataset)
+}
+
+// DeleteDataset deletes a dataset with all of its records, images and vectors
+// @Summary Delete dataset
+// @Tags Datasets
+// @Produce json
+// @Param id path int true "Dataset ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /datasets/{id} [delete]
+func (h *DatasetHandler) DeleteDataset(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dataset ID"})
+		return
+	}
+
+	if err := h.datasetService.DeleteDataset(tenant.ID, uint(id)); err != nil {
+		h.logger.Error("failed to delete dataset %d: %v", id, err)
+		c.JSON(datasetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "dataset deleted successfully"})
+}
+
+// datasetErrorStatus maps dataset service errors to HTTP status codes
+func datasetErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(msg, "already exists"):
+		return http.StatusConflict
+	case strings.HasPrefix(msg, "invalid dataset") || strings.Contains(msg, "cannot be"):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/logger"
+	"image-rag-backend/internal/models"
+	"image-rag-backend/internal/services"
+)
+
+type DuplicateHandler struct {
+	duplicateService *services.DuplicateService
+	logger           *logger.Logger
+}
+
+func NewDuplicateHandler(duplicateService *services.DuplicateService, logger *logger.Logger) *DuplicateHandler {
+	return &DuplicateHandler{
+		duplicateService: duplicateService,
+		logger:           logger,
+	}
+}
+
+// ListDuplicateClusters returns the clusters of duplicate images visible to the caller, largest first
+// @Summary List duplicate image clusters
+// @Description Groups images with identical content, and images linked as duplicates at upload, across all datasets
+// @Tags Images
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Clusters per page (max 100)" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /duplicates [get]
+func (h *DuplicateHandler) ListDuplicateClusters(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	clusters, total, err := h.duplicateService.ListClusters(principal, principal.Tenant.ID, limit, (page-1)*limit)
+	if err != nil {
+		h.logger.Error("Failed to list duplicate clusters: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  clusters,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// StartScan starts a background scan of the whole tenant for clusters of similar images
+// @Summary Start a duplicate scan
+// @Description Walks every live image, links it to its nearest neighbours above the similarity threshold and reports the connected clusters
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body models.StartDuplicateScanRequest false "Scan parameters (default: DUPLICATE_MIN_SIMILARITY and DUPLICATE_CANDIDATES)"
+// @Success 202 {object} models.DuplicateScan
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /duplicates/scans [post]
+func (h *DuplicateHandler) StartScan(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	var req models.StartDuplicateScanRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	scan, err := h.duplicateService.StartScan(auditActor(c), tenant.ID, req)
+	if err != nil {
+		c.JSON(scanErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, scan)
+}
+
+// ListScans returns the tenant's duplicate scans, newest first
+// @Summary List duplicate scans
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /duplicates/scans [get]
+func (h *DuplicateHandler) ListScans(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	scans, err := h.duplicateService.ListScans(tenant.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": scans})
+}
+
+// GetScan returns a duplicate scan with its progress
+// @Summary Get a duplicate scan
+// @Tags Admin
+// @Produce json
+// @Param id path int true "Scan ID"
+// @Success 200 {object} models.DuplicateScan
+// @Failure 404 {object} map[string]string
+// @Router /duplicates/scans/{id} [get]
+func (h *DuplicateHandler) GetScan(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scan ID"})
+		return
+	}
+
+	scan, err := h.duplicateService.GetScan(tenant.ID, uint(id))
+	if err != nil {
+		c.JSON(scanErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, scan)
+}
+
+// ListScanClusters returns the report of a duplicate scan: its clusters, largest first
+// @Summary List the clusters found by a duplicate scan
+// @Tags Admin
+// @Produce json
+// @Param id path int true "Scan ID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Clusters per page (max 100)" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /duplicates/scans/{id}/clusters [get]
+func (h *DuplicateHandler) ListScanClusters(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scan ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	clusters, total, err := h.duplicateService.ListScanClusters(tenant.ID, uint(id), limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(scanErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  clusters,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// ResolveClusters merges or deletes the duplicates of clusters found by a scan
+// @Summary Resolve duplicate clusters
+// @Description Moves every image of the selected clusters but the keeper to the trash. merge also tags the keeper with the removed images' tags and trashes records left without images.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Scan ID"
+// @Param request body models.ResolveDuplicatesRequest true "Action, clusters and keeper overrides"
+// @Success 200 {object} models.ResolveDuplicatesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /duplicates/scans/{id}/resolve [post]
+func (h *DuplicateHandler) ResolveClusters(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scan ID"})
+		return
+	}
+
+	var req models.ResolveDuplicatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.duplicateService.ResolveClusters(auditActor(c), tenant.ID, uint(id), req)
+	if err != nil {
+		h.logger.Error("Failed to resolve duplicates of scan %d: %v", id, err)
+		response := gin.H{"error": err.Error()}
+		if result != nil {
+			// Clusters resolved and images removed before the failure stay so
+			response["resolved"] = result.Resolved
+			response["removed_images"] = result.RemovedImages
+			response["trashed_records"] = result.TrashedRecords
+		}
+		c.JSON(scanErrorStatus(err), response)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// scanErrorStatus maps duplicate scan errors to HTTP status codes
+func scanErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.HasPrefix(err.Error(), "invalid"):
+		return http.StatusBadRequest
+	case strings.Contains(err.Error(), "already running"), strings.Contains(err.Error(), "is not completed"):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,15 +1,21 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"image"
+	"io"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/authz"
+	"image-rag-backend/internal/blobstore"
 	"image-rag-backend/internal/logger"
 	"image-rag-backend/internal/models"
 	"image-rag-backend/internal/services"
@@ -22,28 +28,58 @@ import (
 // @Produce json
 // @Param name formData string true "Record name"
 // @Param description formData string false "Record description"
+// @Param visibility formData string false "tenant (default) or private"
+// @Param dataset formData string false "Dataset name (default: default)"
 // @Param images formData []file true "Image files to upload"
-// @Success 201 {object} models.RecordResponse
+// @Param duplicates formData string false "Duplicate policy: allow, link or reject (default from DUPLICATE_POLICY)"
+// @Success 201 {object} models.CreateRecordResponse
 // @Failure 400 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /records [post]
 
 type RecordHandler struct {
-	recordService *services.RecordService
-	vectorService *services.VectorService
-	logger        *logger.Logger
+	recordService    *services.RecordService
+	vectorService    *services.VectorService
+	tagService       *services.TagService
+	datasetService   *services.DatasetService
+	versionService   *services.VersionService
+	duplicateService *services.DuplicateService
+	imageValidator   *services.ImageValidator
+	thumbnailService *services.ThumbnailService
+	transformService *services.TransformService
+	logger           *logger.Logger
 }
 
-func NewRecordHandler(recordService *services.RecordService, vectorService *services.VectorService, logger *logger.Logger) *RecordHandler {
+func NewRecordHandler(recordService *services.RecordService, vectorService *services.VectorService,
+	tagService *services.TagService, datasetService *services.DatasetService, versionService *services.VersionService,
+	duplicateService *services.DuplicateService, imageValidator *services.ImageValidator,
+	thumbnailService *services.ThumbnailService, transformService *services.TransformService,
+	logger *logger.Logger) *RecordHandler {
 	return &RecordHandler{
-		recordService: recordService,
-		vectorService: vectorService,
-		logger:        logger,
+		recordService:    recordService,
+		vectorService:    vectorService,
+		tagService:       tagService,
+		datasetService:   datasetService,
+		versionService:   versionService,
+		duplicateService: duplicateService,
+		imageValidator:   imageValidator,
+		thumbnailService: thumbnailService,
+		transformService: transformService,
+		logger:           logger,
 	}
 }
 
-// CreateRecord creates a new record with images
+// CreateRecord creates a new record with images, owned by the caller
 func (h *RecordHandler) CreateRecord(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	tenant := principal.Tenant
+	form, err := c.MultipartForm()
+	if err != nil {
+		requestBodyError(c, err, "multipart form data is required")
+		return
+	}
 	name := c.PostForm("name")
 	description := c.PostForm("description")
 
@@ -52,67 +88,103 @@ func (h *RecordHandler) CreateRecord(c *gin.Context) {
 		return
 	}
 
-	// Create record first
-	record, err := h.recordService.CreateRecord(name, description)
+	tags, err := services.NormalizeTags(parseTagList(c.PostFormArray("tags")))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Process uploaded images
-	form, _ := c.MultipartForm()
-	files := form.File["images"]
+	attributes, err := services.ParseAttributes(c.PostForm("attributes"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	var uploadedImages []*models.Image
+	policy, err := h.duplicateService.Policy(c.PostForm("duplicates"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	dataset, err := h.datasetService.ResolveDataset(tenant.ID, c.PostForm("dataset"))
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validate every file up front so a bad upload fails the request before anything is stored
+	files := form.File["images"]
 	for _, file := range files {
-		// Validate file
-		if err := services.ValidateImageFile(file.Filename); err != nil {
-			// Skip invalid files but don't fail the entire operation
-			continue
+		if err := h.validateUpload(file); err != nil {
+			c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error(), "filename": file.Filename})
+			return
 		}
+	}
 
-		// Generate unique filename
-		filename := services.GenerateUniqueFilename(file.Filename)
-		filePath := filepath.Join("uploads", filename)
+	// Create record first
+	record, err := h.recordService.CreateRecord(auditActor(c), tenant.ID, dataset.ID, authz.OwnerID(principal), name, description,
+		c.PostForm("visibility"), attributes)
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
-		// Save file
-		if err := c.SaveUploadedFile(file, filePath); err != nil {
-			// Log error but continue with other files
-			fmt.Printf("Failed to save file %s: %v\n", filename, err)
+	// Tag the record before uploading images so their vectors carry the tags
+	if err := h.tagService.TagRecords(tenant.ID, []uint{record.ID}, tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Store uploaded images under the tenant's prefix in the blob store
+	duplicates := make(map[uint][]models.DuplicateMatch)
+	var rejected []models.RejectedImage
+
+	for _, file := range files {
+		// Store the file and generate its vector; failures skip the file
+		stored, vectorID, err := h.storeAndEmbed(c, tenant, file, services.VectorMetadata{
+			Tags:      tags,
+			Partition: dataset.PartitionName,
+		})
+		if err != nil {
 			continue
 		}
 
-		// Generate vector
-		vectorID, err := h.vectorService.GenerateVector(filePath)
-		if err != nil {
-			// Clean up file if vector generation fails
-			_ = services.NewRecordService().DeleteImageByPath(filePath)
-			fmt.Printf("Failed to generate vector for %s: %v\n", filename, err)
+		matches, ok := h.applyDuplicatePolicy(principal, stored, vectorID, policy)
+		if !ok {
+			rejected = append(rejected, models.RejectedImage{Filename: stored.Filename, Duplicates: matches})
 			continue
 		}
 
 		// Add image to record
-		image, err := h.recordService.AddImageToRecord(record.ID, filename, vectorID)
+		image, err := h.recordService.AddImageToRecord(auditActor(c), tenant.ID, record.ID, stored, vectorID, nil)
 		if err != nil {
 			// Clean up file and vector if adding to record fails
-			_ = services.NewRecordService().DeleteImageByPath(filePath)
-			_ = h.vectorService.DeleteVector(vectorID)
+			_ = h.recordService.ReleaseImageFile(stored)
+			h.deleteVectors(vectorID, stored.KeyFrames)
 			fmt.Printf("Failed to add image to record: %v\n", err)
 			continue
 		}
 
-		uploadedImages = append(uploadedImages, image)
+		if len(matches) > 0 {
+			duplicates[image.ID] = matches
+		}
 	}
 
 	// Reload record with images
-	record, _ = h.recordService.GetRecord(record.ID)
+	record, _ = h.recordService.GetRecord(tenant.ID, record.ID)
+	for i := range record.Images {
+		record.Images[i].Duplicates = duplicates[record.Images[i].ID]
+	}
 
-	c.JSON(http.StatusCreated, record)
+	c.JSON(http.StatusCreated, models.CreateRecordResponse{Record: record, RejectedImages: rejected})
 }
 
-// GetRecords lists all records with pagination
+// GetRecords lists the records of one dataset visible to the caller, with keyword, date and image-count filters.
+// Pagination uses page/limit by default; passing the next_cursor from a previous
+// response switches to keyset pagination, which stays stable while records are added.
 func (h *RecordHandler) GetRecords(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	tenant := principal.Tenant
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 
@@ -123,19 +195,219 @@ func (h *RecordHandler) GetRecords(c *gin.Context) {
 		limit = 10
 	}
 
-	offset := (page - 1) * limit
-	records, total, err := h.recordService.GetRecords(limit, offset)
+	opts, err := parseRecordListOptions(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":  records,
-		"total": total,
-		"page":  page,
-		"limit": limit,
-	})
+	dataset, err := h.datasetService.ResolveDataset(tenant.ID, c.Query("dataset"))
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	opts.TenantID = tenant.ID
+	opts.DatasetID = dataset.ID
+	opts.Principal = principal
+	opts.Limit = limit
+	opts.Offset = (page - 1) * limit
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.recordService.ListRecords(opts)
+	if err != nil {
+		if strings.Contains(err.Error(), "cursor") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	response := gin.H{
+		"dataset":     dataset.Name,
+		"data":        result.Records,
+		"total":       result.Total,
+		"limit":       limit,
+		"next_cursor": result.NextCursor,
+	}
+	if opts.Cursor == "" {
+		response["page"] = page
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// recordErrorStatus maps record service errors to HTTP status codes
+func recordErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "not found"):
+		return http.StatusNotFound
+	case strings.HasPrefix(err.Error(), "forbidden"):
+		return http.StatusForbidden
+	case strings.Contains(err.Error(), "in the trash"):
+		return http.StatusConflict
+	case strings.HasPrefix(err.Error(), "invalid attributes"), strings.HasPrefix(err.Error(), "invalid visibility"),
+		strings.HasPrefix(err.Error(), "invalid patch"), strings.HasPrefix(err.Error(), "invalid transform"):
+		return http.StatusBadRequest
+	case strings.HasPrefix(err.Error(), "precondition failed"):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// uploadErrorStatus maps image validation errors to HTTP status codes
+func uploadErrorStatus(err error) int {
+	switch {
+	case strings.HasPrefix(err.Error(), "file too large"), strings.HasPrefix(err.Error(), "image too large"):
+		return http.StatusRequestEntityTooLarge
+	case strings.HasPrefix(err.Error(), "unsupported image type"):
+		return http.StatusUnsupportedMediaType
+	case strings.HasPrefix(err.Error(), "invalid image"):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// requestBodyError responds to a request body that could not be read: 413 when it passed
+// the size limit, otherwise 400 with the given message
+func requestBodyError(c *gin.Context, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge,
+			gin.H{"error": fmt.Sprintf("request too large: the limit is %d bytes", tooLarge.Limit)})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": message})
+}
+
+// parseRecordListOptions reads listing filters and sort order from the query string
+func parseRecordListOptions(c *gin.Context) (services.RecordListOptions, error) {
+	opts := services.RecordListOptions{
+		Keyword: c.Query("q"),
+		SortBy:  c.DefaultQuery("sort", services.SortByCreatedAt),
+		Cursor:  c.Query("cursor"),
+	}
+
+	switch order := c.DefaultQuery("order", "desc"); order {
+	case "asc":
+		opts.Ascending = true
+	case "desc":
+	default:
+		return opts, fmt.Errorf("order must be asc or desc")
+	}
+
+	var err error
+	if opts.CreatedAfter, err = parseTimeQuery(c, "created_from", false); err != nil {
+		return opts, err
+	}
+	if opts.CreatedBefore, err = parseTimeQuery(c, "created_to", true); err != nil {
+		return opts, err
+	}
+	if opts.UpdatedAfter, err = parseTimeQuery(c, "updated_from", false); err != nil {
+		return opts, err
+	}
+	if opts.UpdatedBefore, err = parseTimeQuery(c, "updated_to", true); err != nil {
+		return opts, err
+	}
+	if opts.MinImages, err = parseIntQuery(c, "min_images"); err != nil {
+		return opts, err
+	}
+	if opts.MaxImages, err = parseIntQuery(c, "max_images"); err != nil {
+		return opts, err
+	}
+	if opts.Tags, err = parseTagFilter(c); err != nil {
+		return opts, err
+	}
+	if opts.Attributes, err = services.ParseAttributeFilters(c.Request.URL.Query()); err != nil {
+		return opts, err
+	}
+	if opts.Images, err = parseImageMetadataFilter(c); err != nil {
+		return opts, err
+	}
+
+	switch match := c.DefaultQuery("tag_match", "all"); match {
+	case "any":
+		opts.TagMatchAny = true
+	case "all":
+	default:
+		return opts, fmt.Errorf("tag_match must be all or any")
+	}
+
+	return opts, nil
+}
+
+// parseImageMetadataFilter reads the image metadata filters shared by listings and searches
+func parseImageMetadataFilter(c *gin.Context) (services.ImageMetadataFilter, error) {
+	filter := services.ImageMetadataFilter{MimeType: c.Query("mime_type")}
+
+	var err error
+	if filter.MinWidth, err = parseIntQuery(c, "min_width"); err != nil {
+		return filter, err
+	}
+	if filter.MinHeight, err = parseIntQuery(c, "min_height"); err != nil {
+		return filter, err
+	}
+	if filter.CapturedAfter, err = parseTimeQuery(c, "captured_from", false); err != nil {
+		return filter, err
+	}
+	if filter.CapturedBefore, err = parseTimeQuery(c, "captured_to", true); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseTimeQuery parses an RFC3339 timestamp or a YYYY-MM-DD date.
+// Dates used as an upper bound cover the whole day.
+func parseTimeQuery(c *gin.Context, key string, endOfDay bool) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: expected RFC3339 timestamp or YYYY-MM-DD date", key)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// parseIntQuery parses an optional non-negative integer query parameter
+func parseIntQuery(c *gin.Context, key string) (*int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid %s: %s", key, value)
+	}
+	return &n, nil
+}
+
+// authorizedRecord loads a record and checks that the caller may perform the action on it
+func (h *RecordHandler) authorizedRecord(c *gin.Context, id uint, action authz.Action) (*models.Record, error) {
+	principal := middleware.PrincipalFromContext(c)
+	record, err := h.recordService.GetRecord(principal.Tenant.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authz.Authorize(principal, record, action); err != nil {
+		return nil, err
+	}
+	return record, nil
 }
 
 // GetRecord retrieves a single record by ID
@@ -146,21 +418,19 @@ func (h *RecordHandler) GetRecord(c *gin.Context) {
 		return
 	}
 
-	record, err := h.recordService.GetRecord(uint(id))
+	record, err := h.authorizedRecord(c, uint(id), authz.ActionView)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
+	c.Header("ETag", services.RecordETag(record))
 	c.JSON(http.StatusOK, record)
 }
 
-// UpdateRecord updates a record
+// UpdateRecord updates a record's non-empty fields; editors may only update records they own
 func (h *RecordHandler) UpdateRecord(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
@@ -173,118 +443,203 @@ func (h *RecordHandler) UpdateRecord(c *gin.Context) {
 		return
 	}
 
-	record, err := h.recordService.UpdateRecord(uint(id), req.Name, req.Description)
+	if _, err := h.authorizedRecord(c, uint(id), authz.ActionUpdate); err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	record, err := h.recordService.UpdateRecord(auditActor(c), tenant.ID, uint(id), req.Name, req.Description, req.Visibility,
+		req.Attributes, c.GetHeader("If-Match"))
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
+	c.Header("ETag", services.RecordETag(record))
 	c.JSON(http.StatusOK, record)
 }
 
-// DeleteRecord deletes a record and its associated images
-func (h *RecordHandler) DeleteRecord(c *gin.Context) {
+// PatchRecord applies a JSON Merge Patch to a record; editors may only patch records they own
+// @Summary Patch record
+// @Description Apply a JSON Merge Patch (RFC 7396) to name, description, visibility and attributes. Send the ETag from a previous read in If-Match to avoid overwriting concurrent changes.
+// @Tags Records
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path int true "Record ID"
+// @Param If-Match header string false "ETag the record must still have"
+// @Success 200 {object} models.Record
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Router /records/{id} [patch]
+func (h *RecordHandler) PatchRecord(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
 		return
 	}
 
-	// Get record to delete associated images
-	record, err := h.recordService.GetRecord(uint(id))
+	switch c.ContentType() {
+	case "application/merge-patch+json", "application/json":
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "content type must be application/merge-patch+json"})
+		return
+	}
+	patch, err := c.GetRawData()
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
 		return
 	}
 
-	// Delete vectors from vector service
-	for _, image := range record.Images {
-		if err := h.vectorService.DeleteVector(image.VectorID); err != nil {
-			// Log error but continue with deletion
-			fmt.Printf("Failed to delete vector %s: %v\n", image.VectorID, err)
-		}
+	if _, err := h.authorizedRecord(c, uint(id), authz.ActionUpdate); err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	record, err := h.recordService.PatchRecord(auditActor(c), tenant.ID, uint(id), patch, c.GetHeader("If-Match"))
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", services.RecordETag(record))
+	c.JSON(http.StatusOK, record)
+}
+
+// DeleteRecord moves a record and its images to the trash; editors may only delete records they own
+func (h *RecordHandler) DeleteRecord(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
+		return
 	}
 
-	// Delete record (will cascade to images due to foreign key constraint)
-	if err := h.recordService.DeleteRecord(uint(id)); err != nil {
+	// Get record to move the vectors of its images
+	record, err := h.authorizedRecord(c, uint(id), authz.ActionDelete)
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.recordService.DeleteRecord(auditActor(c), tenant.ID, uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "record deleted successfully"})
+	// Move vectors to the trash partition so they drop out of search
+	for _, image := range record.Images {
+		for _, vectorID := range image.VectorIDs() {
+			if err := h.vectorService.TrashVector(vectorID); err != nil {
+				h.logger.Error("Failed to move vector %s to trash: %v", vectorID, err)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "record moved to trash"})
 }
 
-// AddImageToRecord adds an image to an existing record
+// AddImageToRecord adds an image to an existing record. An image duplicating existing images is
+// refused with 409 under the reject duplicate policy; otherwise the duplicates are reported with it.
 func (h *RecordHandler) AddImageToRecord(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	tenant := principal.Tenant
 	recordID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
 		return
 	}
 
-	// Ensure record exists
-	_, err = h.recordService.GetRecord(uint(recordID))
+	// Ensure record exists and the caller may change it
+	record, err := h.authorizedRecord(c, uint(recordID), authz.ActionManageImages)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "record not found"})
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	file, header, err := c.Request.FormFile("image")
+	imageTags, err := services.NormalizeTags(parseTagList(c.PostFormArray("tags")))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "image is required"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer file.Close()
 
-	// Validate file
-	if err := services.ValidateImageFile(header.Filename); err != nil {
+	attributes, err := services.ParseAttributes(c.PostForm("attributes"))
+	if err == nil {
+		err = h.recordService.ValidateImageAttributes(attributes)
+	}
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generate unique filename
-	filename := services.GenerateUniqueFilename(header.Filename)
-	filePath := filepath.Join("uploads", filename)
+	policy, err := h.duplicateService.Policy(c.PostForm("duplicates"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("image")
+	if err != nil {
+		requestBodyError(c, err, "image is required")
+		return
+	}
+	defer file.Close()
 
-	// Save file
-	if err := c.SaveUploadedFile(header, filePath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save file"})
+	if err := h.imageValidator.Validate(file, header.Filename, header.Size); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generate vector
-	vectorID, err := h.vectorService.GenerateVector(filePath)
+	dataset, err := h.datasetService.GetDataset(tenant.ID, record.DatasetID)
 	if err != nil {
-		h.logger.Error("generarte image vector with error: %v", err)
-		// Clean up file
-		_ = services.NewRecordService().DeleteImageByPath(filePath)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate vector"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Store the file and generate its vector carrying the record's tags; image tags are attached below
+	stored, vectorID, err := h.storeAndEmbed(c, tenant, header, services.VectorMetadata{
+		Tags:      models.TagNames(record.Tags),
+		Partition: dataset.PartitionName,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	matches, ok := h.applyDuplicatePolicy(principal, stored, vectorID, policy)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "image duplicates existing images", "duplicates": matches})
 		return
 	}
 
 	// Add image to record
-	image, err := h.recordService.AddImageToRecord(uint(recordID), filename, vectorID)
+	image, err := h.recordService.AddImageToRecord(auditActor(c), tenant.ID, uint(recordID), stored, vectorID, attributes)
 	if err != nil {
 		// Clean up file and vector
-		_ = services.NewRecordService().DeleteImageByPath(filePath)
-		_ = h.vectorService.DeleteVector(vectorID)
+		_ = h.recordService.ReleaseImageFile(stored)
+		h.deleteVectors(vectorID, stored.KeyFrames)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add image to record"})
 		return
 	}
 
+	if len(imageTags) > 0 {
+		if err := h.tagService.TagImages(tenant.ID, []uint{image.ID}, imageTags); err != nil {
+			h.logger.Error("failed to tag image %d: %v", image.ID, err)
+		}
+		if tagged, err := h.recordService.GetImage(tenant.ID, image.ID); err == nil {
+			image = tagged
+		}
+	}
+	image.Duplicates = matches
+
 	c.JSON(http.StatusCreated, image)
 }
 
-// DeleteImage deletes an image from a record
+// DeleteImage moves an image to the trash
 func (h *RecordHandler) DeleteImage(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
 	imageID, err := strconv.ParseUint(c.Param("image_id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID"})
@@ -292,47 +647,268 @@ func (h *RecordHandler) DeleteImage(c *gin.Context) {
 	}
 
 	// Get image to delete vector
-	image, err := h.recordService.GetImage(uint(imageID))
+	image, err := h.recordService.GetImage(tenant.ID, uint(imageID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
 		return
 	}
-
-	// Delete vector from vector service
-	if err := h.vectorService.DeleteVector(image.VectorID); err != nil {
-		fmt.Printf("Failed to delete vector %s: %v\n", image.VectorID, err)
+	if _, err := h.authorizedRecord(c, image.RecordID, authz.ActionManageImages); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		} else {
+			c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
 	}
 
-	// Delete image
-	if err := h.recordService.DeleteImage(uint(imageID)); err != nil {
+	if err := h.recordService.DeleteImage(auditActor(c), tenant.ID, uint(imageID)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "image deleted successfully"})
+	// Move vectors to the trash partition so they drop out of search
+	for _, vectorID := range image.VectorIDs() {
+		if err := h.vectorService.TrashVector(vectorID); err != nil {
+			h.logger.Error("Failed to move vector %s to trash: %v", vectorID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "image moved to trash"})
 }
 
-// GetImagePreview serves an image file for preview
+// GetImagePreview serves an image file for preview, or a downscaled JPEG rendition of it
+// with ?size=small|medium|large or ?w=<width>
 func (h *RecordHandler) GetImagePreview(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
 	imageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID"})
 		return
 	}
+	width, err := h.thumbnailService.Width(c.Query("size"), c.Query("w"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Get image metadata
-	image, err := h.recordService.GetImage(uint(imageID))
+	image, err := h.recordService.GetImage(tenant.ID, uint(imageID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
 		return
 	}
+	if _, err := h.authorizedRecord(c, image.RecordID, authz.ActionView); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		return
+	}
+
+	// Previews are per user, so only the client may cache them
+	etag := h.thumbnailService.ETag(image, width)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(h.thumbnailService.CacheMaxAge().Seconds())))
+	if etagListed(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 
-	// Check if file exists
-	if _, err := os.Stat(image.Path); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "image file not found"})
+	var reader io.ReadCloser
+	var info *blobstore.Info
+	if width > 0 {
+		reader, info, err = h.thumbnailService.Open(c.Request.Context(), image, width)
+	} else {
+		reader, info, err = h.recordService.OpenImageFile(c.Request.Context(), image.Path)
+	}
+	if err != nil {
+		h.logger.Error("Failed to open preview of image %d: %v", image.ID, err)
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
+	defer reader.Close()
 
-	// Serve the image file
-	c.File(image.Path)
+	serveBlob(c, reader, info)
+}
+
+// TransformImage serves a transformed rendition of an image: ?crop=x,y,w,h&rotate=90&w=&h=&fit=&format=&q=
+func (h *RecordHandler) TransformImage(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	imageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID"})
+		return
+	}
+	transform, err := parseImageTransform(c)
+	if err == nil {
+		transform, err = h.transformService.Normalize(transform)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	image, err := h.recordService.GetImage(tenant.ID, uint(imageID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		return
+	}
+	if _, err := h.authorizedRecord(c, image.RecordID, authz.ActionView); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		return
+	}
+
+	etag := h.transformService.ETag(image, transform)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(h.transformService.CacheMaxAge().Seconds())))
+	if etagListed(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, err := h.transformService.Transform(c.Request.Context(), image, transform)
+	if err != nil {
+		if recordErrorStatus(err) == http.StatusInternalServerError {
+			h.logger.Error("Failed to transform image %d: %v", image.ID, err)
+		}
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, transform.ContentType(), data)
+}
+
+// parseImageTransform reads a transform from the query; the service checks its values
+func parseImageTransform(c *gin.Context) (services.ImageTransform, error) {
+	var t services.ImageTransform
+	if crop := c.Query("crop"); crop != "" {
+		parts := strings.Split(crop, ",")
+		values := make([]int, len(parts))
+		for i, part := range parts {
+			v, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				values = nil
+				break
+			}
+			values[i] = v
+		}
+		if len(values) != 4 {
+			return t, fmt.Errorf("invalid transform: crop must be x,y,width,height")
+		}
+		t.Crop = image.Rect(values[0], values[1], values[0]+values[2], values[1]+values[3])
+	}
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{"rotate", &t.Rotate}, {"w", &t.Width}, {"h", &t.Height}, {"q", &t.Quality}} {
+		if raw := c.Query(param.name); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil {
+				return t, fmt.Errorf("invalid transform: %s must be an integer", param.name)
+			}
+			*param.value = v
+		}
+	}
+	t.Fit = strings.ToLower(c.Query("fit"))
+	t.Format = strings.ToLower(c.Query("format"))
+	return t, nil
+}
+
+// etagListed reports whether an If-None-Match header lists an entity tag, comparing weakly
+func etagListed(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// validateUpload checks an uploaded file against the upload limits
+func (h *RecordHandler) validateUpload(header *multipart.FileHeader) error {
+	file, err := header.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+	return h.imageValidator.Validate(file, header.Filename, header.Size)
+}
+
+// storeAndEmbed stores an uploaded image in the blob store and generates its vector. Bytes the
+// tenant uploaded before reuse their embedding when it was made under the current preprocessing;
+// others are embedded from the upload itself, so the blob is never read back. Nothing is left behind when it fails.
+func (h *RecordHandler) storeAndEmbed(c *gin.Context, tenant *models.Tenant, header *multipart.FileHeader,
+	meta services.VectorMetadata) (*services.StoredImage, string, error) {
+	file, err := header.Open()
+	if err != nil {
+		h.logger.Error("Failed to open upload %s: %v", header.Filename, err)
+		return nil, "", errors.New("failed to save file")
+	}
+	defer file.Close()
+
+	stored, err := h.recordService.StoreImageFile(c.Request.Context(), tenant, header.Filename, file, header.Size)
+	if err != nil {
+		h.logger.Error("Failed to store %s: %v", header.Filename, err)
+		return nil, "", errors.New("failed to save file")
+	}
+
+	// Vectors made under another preprocessing transform are not comparable and are not reused
+	transform := h.vectorService.Transform()
+	if source, err := h.recordService.FindImageByDigest(tenant.ID, stored.Digest, transform); err == nil {
+		vectorID, err := h.vectorService.CopyVector(source.VectorID, source.KeyFrames, meta)
+		if err == nil {
+			stored.EmbeddingTransform = transform
+			stored.KeyFrames = source.KeyFrames
+			return stored, vectorID, nil
+		}
+		// Fall back to embedding the upload, e.g. when the source vector is gone
+		h.logger.Error("Failed to reuse vector %s for %s: %v", source.VectorID, header.Filename, err)
+	}
+
+	// Rewind to embed the upload itself rather than read the blob back from the store
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		h.logger.Error("Failed to rewind upload %s: %v", header.Filename, err)
+		_ = h.recordService.ReleaseImageFile(stored)
+		return nil, "", errors.New("failed to save file")
+	}
+	vectorID, keyFrames, err := h.vectorService.GenerateVectorFromReader(file, header.Filename, meta)
+	if err != nil {
+		h.logger.Error("Failed to generate vector for %s: %v", header.Filename, err)
+		_ = h.recordService.ReleaseImageFile(stored)
+		return nil, "", errors.New("failed to generate vector")
+	}
+	stored.EmbeddingTransform = transform
+	stored.KeyFrames = keyFrames
+	return stored, vectorID, nil
+}
+
+// deleteVectors deletes the vectors of an upload that was not added to a record
+func (h *RecordHandler) deleteVectors(vectorID string, keyFrames int) {
+	for _, id := range models.ImageVectorIDs(vectorID, keyFrames) {
+		_ = h.vectorService.DeleteVector(id)
+	}
+}
+
+// applyDuplicatePolicy looks up the existing images a stored upload duplicates and applies the
+// duplicate policy. It reports false when the upload is rejected, after releasing its file and vector;
+// under the link policy the upload is linked to the image it duplicates.
+func (h *RecordHandler) applyDuplicatePolicy(principal *models.Principal, stored *services.StoredImage, vectorID string,
+	policy string) ([]models.DuplicateMatch, bool) {
+	matches, err := h.duplicateService.FindDuplicates(principal, stored, vectorID)
+	if err != nil {
+		// Duplicate detection is best effort; the upload goes ahead as if it had none
+		h.logger.Error("Failed to find duplicates of %s: %v", stored.Filename, err)
+		return nil, true
+	}
+	if len(matches) == 0 {
+		return nil, true
+	}
+
+	switch policy {
+	case services.DuplicatePolicyReject:
+		_ = h.recordService.ReleaseImageFile(stored)
+		h.deleteVectors(vectorID, stored.KeyFrames)
+		return matches, false
+	case services.DuplicatePolicyLink:
+		canonical := services.CanonicalImageID(matches)
+		stored.DuplicateOf = &canonical
+	}
+	return matches, true
 }
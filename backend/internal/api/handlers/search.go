@@ -3,10 +3,11 @@ package handlers
 import (
 	"fmt"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"strings"
 
+	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/authz"
 	"image-rag-backend/internal/logger"
 	"image-rag-backend/internal/models"
 	"image-rag-backend/internal/services"
@@ -14,26 +15,39 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	searchModeFilter = "filter"
+	searchModeHybrid = "hybrid"
+)
+
 type SearchHandler struct {
-	recordService *services.RecordService
-	vectorService *services.VectorService
-	logger        *logger.Logger
+	recordService  *services.RecordService
+	vectorService  *services.VectorService
+	datasetService *services.DatasetService
+	imageValidator *services.ImageValidator
+	logger         *logger.Logger
 }
 
 type SearchResult struct {
-	RecordID    uint    `json:"record_id"`
-	RecordName  string  `json:"record_name"`
-	Description string  `json:"description"`
-	ImageID     uint    `json:"image_id"`
-	Filename    string  `json:"filename"`
-	Distance    float64 `json:"distance"`
+	RecordID    uint              `json:"record_id"`
+	RecordName  string            `json:"record_name"`
+	Description string            `json:"description"`
+	ImageID     uint              `json:"image_id"`
+	Filename    string            `json:"filename"`
+	Distance    float64           `json:"distance"`
+	Attributes  models.Attributes `json:"attributes,omitempty"`
+	TextScore   float64           `json:"text_score,omitempty"`
+	Score       float64           `json:"score,omitempty"`
 }
 
-func NewSearchHandler(recordService *services.RecordService, vectorService *services.VectorService, logger *logger.Logger) *SearchHandler {
+func NewSearchHandler(recordService *services.RecordService, vectorService *services.VectorService,
+	datasetService *services.DatasetService, imageValidator *services.ImageValidator, logger *logger.Logger) *SearchHandler {
 	return &SearchHandler{
-		recordService: recordService,
-		vectorService: vectorService,
-		logger:        logger,
+		recordService:  recordService,
+		vectorService:  vectorService,
+		datasetService: datasetService,
+		imageValidator: imageValidator,
+		logger:         logger,
 	}
 }
 
@@ -45,21 +59,33 @@ func NewSearchHandler(recordService *services.RecordService, vectorService *serv
 // @Produce json
 // @Param image formData file true "Image file to search for"
 // @Param top_k query int false "Number of results to return (default: 10, max: 100)"
+// @Param dataset query string false "Dataset to search (default: default)"
+// @Param diversity query number false "MMR diversity weight between 0 (relevance only) and 1 (maximum variety)"
+// @Param tags query []string false "Only return images carrying all of these tags"
+// @Param attr.{key} query string false "Attribute filter, e.g. attr.category=shoes or attr.price.lte=100"
+// @Param min_width query int false "Only return images at least this many pixels wide"
+// @Param min_height query int false "Only return images at least this many pixels high"
+// @Param mime_type query string false "Only return images of this detected content type, e.g. image/jpeg"
+// @Param captured_from query string false "Only return images captured at or after this time (RFC3339 or YYYY-MM-DD)"
+// @Param captured_to query string false "Only return images captured before the end of this time (RFC3339 or YYYY-MM-DD)"
 // @Success 200 {object} SearchResponse
 // @Failure 400 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /search [post]
 func (h *SearchHandler) SearchImages(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	tenant := principal.Tenant
 	file, header, err := c.Request.FormFile("image")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "image is required"})
+		requestBodyError(c, err, "image is required")
 		return
 	}
 	defer file.Close()
 
-	// Validate file
-	if err := services.ValidateImageFile(header.Filename); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := h.imageValidator.Validate(file, header.Filename, header.Size); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -69,26 +95,45 @@ func (h *SearchHandler) SearchImages(c *gin.Context) {
 		topK = 10
 	}
 
-	// Save temporary file
-	filename := services.GenerateUniqueFilename(header.Filename)
-	tempPath := filepath.Join("uploads", "temp", filename)
+	diversity, err := parseDiversity(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Ensure temp directory exists
-	services.EnsureDirectoryExists(filepath.Join("uploads", "temp"))
+	tags, err := parseTagFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	attrFilters, err := services.ParseAttributeFilters(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Save file
-	if err := c.SaveUploadedFile(header, tempPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save file"})
+	imageFilter, err := parseImageMetadataFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Clean up temp file after processing
-	defer func() {
-		_ = services.NewRecordService().DeleteImageByPath(tempPath)
-	}()
+	dataset, err := h.datasetService.ResolveDataset(tenant.ID, c.Query("dataset"))
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
 	// Search for similar images
-	results, err := h.vectorService.SearchSimilar(tempPath, topK)
+	searchOpts := services.SearchOptions{
+		TopK:       fetchTopK(principal, topK, attrFilters, imageFilter),
+		Diversity:  diversity,
+		Tags:       tags,
+		Partitions: []string{dataset.PartitionName},
+	}
+	// The query image is embedded straight from the upload; it is never stored
+	results, err := h.vectorService.SearchSimilarFromReader(file, header.Filename, searchOpts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -98,27 +143,37 @@ func (h *SearchHandler) SearchImages(c *gin.Context) {
 	var searchResults []SearchResult
 	for _, result := range results {
 		// Find image by vector ID
-		image, err := h.findImageByVectorID(result.ImageID)
+		image, err := h.recordService.FindImageByVectorID(tenant.ID, result.ImageID)
 		if err != nil {
 			continue // Skip if image not found
 		}
+		if !imageFilter.Match(image) {
+			continue
+		}
 
 		// Get record information
-		record, err := h.recordService.GetRecord(image.RecordID)
+		record, err := h.visibleRecord(principal, image.RecordID)
 		if err != nil {
 			continue // Skip if record not found
 		}
 
+		if !services.MatchAttributes(record.Attributes, attrFilters) {
+			continue
+		}
+
 		searchResults = append(searchResults, SearchResult{
 			RecordID:    record.ID,
 			RecordName:  record.Name,
 			Description: record.Description,
+			Attributes:  record.Attributes,
 			ImageID:     image.ID,
 			Filename:    image.Filename,
 			Distance:    float64(result.Distance),
 		})
 	}
 
+	searchResults = truncateResults(searchResults, topK)
+
 	c.JSON(http.StatusOK, gin.H{
 		"results": searchResults,
 		"count":   len(searchResults),
@@ -138,6 +193,8 @@ func (h *SearchHandler) SearchImages(c *gin.Context) {
 // @Failure 500 {object} map[string]string
 // @Router /search/by-vector/{vector_id} [get]
 func (h *SearchHandler) GetImageByVectorID(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	tenant := principal.Tenant
 	vectorID := c.Param("vector_id")
 	if vectorID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "vector ID is required"})
@@ -145,16 +202,16 @@ func (h *SearchHandler) GetImageByVectorID(c *gin.Context) {
 	}
 
 	// Find image by vector ID
-	image, err := h.findImageByVectorID(vectorID)
+	image, err := h.recordService.FindImageByVectorID(tenant.ID, vectorID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Get record information
-	record, err := h.recordService.GetRecord(image.RecordID)
+	record, err := h.visibleRecord(principal, image.RecordID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -164,8 +221,10 @@ func (h *SearchHandler) GetImageByVectorID(c *gin.Context) {
 	})
 }
 
-// FindSimilar finds similar images to an existing image
+// FindSimilar finds similar images to an existing image, within its own dataset unless dataset is given
 func (h *SearchHandler) FindSimilar(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	tenant := principal.Tenant
 	imageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID"})
@@ -173,7 +232,10 @@ func (h *SearchHandler) FindSimilar(c *gin.Context) {
 	}
 
 	// Get image information
-	image, err := h.recordService.GetImage(uint(imageID))
+	image, err := h.recordService.GetImage(tenant.ID, uint(imageID))
+	if err == nil {
+		_, err = h.visibleRecord(principal, image.RecordID)
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
 		return
@@ -185,15 +247,51 @@ func (h *SearchHandler) FindSimilar(c *gin.Context) {
 		topK = 10
 	}
 
-	// Get image path
-	imagePath := filepath.Join("uploads", image.Filename)
-	if _, err := services.NewRecordService().FileExists(imagePath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "image file not found"})
+	diversity, err := parseDiversity(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tags, err := parseTagFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	attrFilters, err := services.ParseAttributeFilters(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	imageFilter, err := parseImageMetadataFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dataset, err := h.sourceDataset(tenant.ID, c.Query("dataset"), image)
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, _, err := h.recordService.OpenImageFile(c.Request.Context(), image.Path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
 	// Search for similar images
-	results, err := h.vectorService.SearchSimilar(imagePath, topK)
+	searchOpts := services.SearchOptions{
+		TopK:       fetchTopK(principal, topK, attrFilters, imageFilter),
+		Diversity:  diversity,
+		Tags:       tags,
+		Partitions: []string{dataset.PartitionName},
+	}
+	results, err := h.vectorService.SearchSimilarFromReader(reader, image.Filename, searchOpts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -208,38 +306,51 @@ func (h *SearchHandler) FindSimilar(c *gin.Context) {
 		}
 
 		// Find image by vector ID
-		similarImage, err := h.findImageByVectorID(result.ImageID)
-		if err != nil {
+		similarImage, err := h.recordService.FindImageByVectorID(tenant.ID, result.ImageID)
+		if err != nil || !imageFilter.Match(similarImage) {
 			continue // Skip if image not found
 		}
 
 		// Get record information
-		record, err := h.recordService.GetRecord(similarImage.RecordID)
+		record, err := h.visibleRecord(principal, similarImage.RecordID)
 		if err != nil {
 			continue // Skip if record not found
 		}
 
+		if !services.MatchAttributes(record.Attributes, attrFilters) {
+			continue
+		}
+
 		searchResults = append(searchResults, SearchResult{
 			RecordID:    record.ID,
 			RecordName:  record.Name,
 			Description: record.Description,
+			Attributes:  record.Attributes,
 			ImageID:     similarImage.ID,
 			Filename:    similarImage.Filename,
 			Distance:    float64(result.Distance),
 		})
 	}
 
+	searchResults = truncateResults(searchResults, topK)
+
 	c.JSON(http.StatusOK, gin.H{
 		"results": searchResults,
 		"count":   len(searchResults),
 	})
 }
 
-// AdvancedSearch performs advanced search with filters
+// AdvancedSearch performs advanced search with filters.
+// With mode=hybrid the q parameter is matched against the full-text index over
+// record names and descriptions and fused with image similarity instead of
+// being applied as a substring filter.
 func (h *SearchHandler) AdvancedSearch(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	tenant := principal.Tenant
 	// Get search parameters
 	query := c.Query("q")
 	recordName := c.Query("record_name")
+	mode := c.DefaultQuery("mode", searchModeFilter)
 	minDistance, _ := strconv.ParseFloat(c.DefaultQuery("min_distance", "0"), 32)
 	maxDistance, _ := strconv.ParseFloat(c.DefaultQuery("max_distance", "1"), 32)
 	topK, _ := strconv.Atoi(c.DefaultQuery("top_k", "10"))
@@ -248,39 +359,68 @@ func (h *SearchHandler) AdvancedSearch(c *gin.Context) {
 		topK = 10
 	}
 
-	file, header, err := c.Request.FormFile("image")
+	diversity, err := parseDiversity(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "image is required"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer file.Close()
 
-	// Validate file
-	if err := services.ValidateImageFile(header.Filename); err != nil {
+	tags, err := parseTagFilter(c)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Save temporary file
-	filename := services.GenerateUniqueFilename(header.Filename)
-	tempPath := filepath.Join("uploads", "temp", filename)
+	attrFilters, err := services.ParseAttributeFilters(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Ensure temp directory exists
-	services.EnsureDirectoryExists(filepath.Join("uploads", "temp"))
+	imageFilter, err := parseImageMetadataFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Save file
-	if err := c.SaveUploadedFile(header, tempPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save file"})
+	dataset, err := h.datasetService.ResolveDataset(tenant.ID, c.Query("dataset"))
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	// Clean up temp file after processing
-	defer func() {
-		_ = services.NewRecordService().DeleteImageByPath(tempPath)
-	}()
+	if mode != searchModeFilter && mode != searchModeHybrid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be filter or hybrid"})
+		return
+	}
+
+	hybridOpts, err := parseHybridOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("image")
+	if err != nil {
+		requestBodyError(c, err, "image is required")
+		return
+	}
+	defer file.Close()
+
+	if err := h.imageValidator.Validate(file, header.Filename, header.Size); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
 	// Search for similar images
-	results, err := h.vectorService.SearchSimilar(tempPath, topK)
+	searchOpts := services.SearchOptions{
+		TopK:       fetchTopK(principal, topK, attrFilters, imageFilter),
+		Diversity:  diversity,
+		Tags:       tags,
+		Partitions: []string{dataset.PartitionName},
+	}
+	// The query image is embedded straight from the upload; it is never stored
+	results, err := h.vectorService.SearchSimilarFromReader(file, header.Filename, searchOpts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -295,19 +435,24 @@ func (h *SearchHandler) AdvancedSearch(c *gin.Context) {
 		}
 
 		// Find image by vector ID
-		image, err := h.findImageByVectorID(result.ImageID)
-		if err != nil {
+		image, err := h.recordService.FindImageByVectorID(tenant.ID, result.ImageID)
+		if err != nil || !imageFilter.Match(image) {
 			continue
 		}
 
 		// Get record information
-		record, err := h.recordService.GetRecord(image.RecordID)
+		record, err := h.visibleRecord(principal, image.RecordID)
 		if err != nil {
 			continue
 		}
 
-		// Apply text filters
-		if query != "" && !strings.Contains(strings.ToLower(record.Description), strings.ToLower(query)) {
+		if !services.MatchAttributes(record.Attributes, attrFilters) {
+			continue
+		}
+
+		// Apply text filters; hybrid mode scores q through the full-text index instead
+		if mode == searchModeFilter && query != "" &&
+			!strings.Contains(strings.ToLower(record.Description), strings.ToLower(query)) {
 			continue
 		}
 
@@ -319,16 +464,30 @@ func (h *SearchHandler) AdvancedSearch(c *gin.Context) {
 			RecordID:    record.ID,
 			RecordName:  record.Name,
 			Description: record.Description,
+			Attributes:  record.Attributes,
 			ImageID:     image.ID,
 			Filename:    image.Filename,
 			Distance:    float64(result.Distance),
 		})
 	}
 
+	if mode == searchModeHybrid && query != "" {
+		searchResults, err = h.fuseHybridResults(principal, searchResults, dataset, query, recordName, tags, attrFilters,
+			imageFilter, topK, hybridOpts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	searchResults = truncateResults(searchResults, topK)
+
 	c.JSON(http.StatusOK, gin.H{
 		"results": searchResults,
 		"count":   len(searchResults),
 		"query":   query,
+		"mode":    mode,
+		"dataset": dataset.Name,
 		"filters": gin.H{
 			"record_name":  recordName,
 			"min_distance": minDistance,
@@ -337,22 +496,214 @@ func (h *SearchHandler) AdvancedSearch(c *gin.Context) {
 	})
 }
 
-// Helper function to find image by vector ID
-func (h *SearchHandler) findImageByVectorID(vectorID string) (*models.Image, error) {
-	// Query database for image with matching vector ID
-	var image models.Image
-	if err := h.recordService.GetDB().Where("vector_id = ?", vectorID).First(&image).Error; err != nil {
-		return nil, fmt.Errorf("image not found for vector ID: %s", vectorID)
+// fuseHybridResults merges vector hits with full-text matches and re-ranks them by fused score
+func (h *SearchHandler) fuseHybridResults(principal *models.Principal, vectorResults []SearchResult,
+	dataset *models.Dataset, query, recordName string, tags []string, attrFilters []services.AttributeFilter,
+	imageFilter services.ImageMetadataFilter, topK int, opts services.HybridOptions) ([]SearchResult, error) {
+	textMatches, err := h.recordService.SearchText(query, topK, dataset.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	textRanks := make(map[uint]services.TextMatch, len(textMatches))
+	textRankOrder := make(map[uint]int, len(textMatches))
+	for i, match := range textMatches {
+		textRanks[match.RecordID] = match
+		textRankOrder[match.RecordID] = i + 1
+	}
+
+	rows := make(map[uint]SearchResult)
+	seenRecords := make(map[uint]bool)
+	var candidates []services.HybridCandidate
+
+	for i, result := range vectorResults {
+		rows[result.ImageID] = result
+		seenRecords[result.RecordID] = true
+		candidates = append(candidates, services.HybridCandidate{
+			ImageID:    result.ImageID,
+			RecordID:   result.RecordID,
+			Distance:   float32(result.Distance),
+			VectorRank: i + 1,
+			TextScore:  textRanks[result.RecordID].Score,
+			TextRank:   textRankOrder[result.RecordID],
+		})
+	}
+
+	// Records found only by text contribute their first image
+	for _, match := range textMatches {
+		if seenRecords[match.RecordID] {
+			continue
+		}
+
+		record, err := h.visibleRecord(principal, match.RecordID)
+		if err != nil {
+			continue
+		}
+		if recordName != "" && !strings.Contains(strings.ToLower(record.Name), strings.ToLower(recordName)) {
+			continue
+		}
+		if !services.MatchAttributes(record.Attributes, attrFilters) {
+			continue
+		}
+
+		image, ok := firstMatchingImage(record, tags, imageFilter)
+		if !ok {
+			continue
+		}
+		rows[image.ID] = SearchResult{
+			RecordID:    record.ID,
+			RecordName:  record.Name,
+			Description: record.Description,
+			Attributes:  record.Attributes,
+			ImageID:     image.ID,
+			Filename:    image.Filename,
+		}
+		candidates = append(candidates, services.HybridCandidate{
+			ImageID:   image.ID,
+			RecordID:  record.ID,
+			TextScore: match.Score,
+			TextRank:  textRankOrder[match.RecordID],
+		})
+	}
+
+	fused := services.FuseHybrid(candidates, opts)
+	if len(fused) > topK {
+		fused = fused[:topK]
+	}
+
+	results := make([]SearchResult, 0, len(fused))
+	for _, candidate := range fused {
+		row := rows[candidate.ImageID]
+		row.TextScore = candidate.TextScore
+		row.Score = candidate.Score
+		results = append(results, row)
+	}
+	return results, nil
+}
+
+// firstMatchingImage returns the first image of a record that passes the metadata filter
+// and whose own and record tags include all given tags
+func firstMatchingImage(record *models.Record, tags []string, imageFilter services.ImageMetadataFilter) (models.Image, bool) {
+	for _, image := range record.Images {
+		if !imageFilter.Match(&image) {
+			continue
+		}
+		have := make(map[string]bool)
+		for _, tag := range record.Tags {
+			have[tag.Name] = true
+		}
+		for _, tag := range image.Tags {
+			have[tag.Name] = true
+		}
+
+		matched := true
+		for _, tag := range tags {
+			if !have[tag] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return image, true
+		}
 	}
-	return &image, nil
+	return models.Image{}, false
+}
+
+// parseHybridOptions reads score fusion settings for hybrid search from the query string
+func parseHybridOptions(c *gin.Context) (services.HybridOptions, error) {
+	opts := services.DefaultHybridOptions()
+	opts.Method = services.FusionMethod(c.DefaultQuery("fusion", string(opts.Method)))
+
+	var err error
+	if value := c.Query("vector_weight"); value != "" {
+		if opts.VectorWeight, err = strconv.ParseFloat(value, 64); err != nil {
+			return opts, fmt.Errorf("invalid vector_weight: %s", value)
+		}
+	}
+	if value := c.Query("text_weight"); value != "" {
+		if opts.TextWeight, err = strconv.ParseFloat(value, 64); err != nil {
+			return opts, fmt.Errorf("invalid text_weight: %s", value)
+		}
+	}
+	if value := c.Query("rrf_k"); value != "" {
+		if opts.RRFK, err = strconv.Atoi(value); err != nil {
+			return opts, fmt.Errorf("invalid rrf_k: %s", value)
+		}
+	}
+
+	return opts, opts.Validate()
+}
+
+// fetchTopK over-fetches candidates when attribute or image metadata filters, or the records the
+// caller may not see, will drop some of them
+func fetchTopK(principal *models.Principal, topK int, attrFilters []services.AttributeFilter,
+	imageFilter services.ImageMetadataFilter) int {
+	if len(attrFilters) == 0 && imageFilter.IsZero() && authz.Role(principal) == models.RoleAdmin {
+		return topK
+	}
+	return services.CandidatePoolSize(topK)
+}
+
+// truncateResults trims results to the requested count
+func truncateResults(results []SearchResult, topK int) []SearchResult {
+	if topK > 0 && len(results) > topK {
+		return results[:topK]
+	}
+	return results
+}
+
+// parseDiversity reads the optional MMR diversity weight from the query string
+func parseDiversity(c *gin.Context) (float64, error) {
+	value := c.Query("diversity")
+	if value == "" {
+		return 0, nil
+	}
+
+	diversity, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid diversity: %s", value)
+	}
+	if err := services.ValidateDiversity(diversity); err != nil {
+		return 0, err
+	}
+	return diversity, nil
+}
+
+// visibleRecord loads the record of a search hit, hiding records the caller may not see
+func (h *SearchHandler) visibleRecord(principal *models.Principal, recordID uint) (*models.Record, error) {
+	record, err := h.recordService.GetRecord(principal.Tenant.ID, recordID)
+	if err != nil {
+		return nil, err
+	}
+	if err := authz.Authorize(principal, record, authz.ActionView); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// sourceDataset resolves the named dataset, defaulting to the dataset of the given image
+func (h *SearchHandler) sourceDataset(tenantID uint, name string, image *models.Image) (*models.Dataset, error) {
+	if name != "" {
+		return h.datasetService.ResolveDataset(tenantID, name)
+	}
+
+	record, err := h.recordService.GetRecord(tenantID, image.RecordID)
+	if err != nil {
+		return nil, err
+	}
+	return h.datasetService.GetDataset(tenantID, record.DatasetID)
 }
 
 // Base64SearchRequest represents the request structure for base64 image search
 // @Base64SearchRequest represents the request structure for base64 image search
 type Base64SearchRequest struct {
-	Base64Data string `json:"image_base64" binding:"required"`
-	Format     string `json:"format" binding:"omitempty"`
-	TopK       int    `json:"top_k" binding:"omitempty,min=1,max=100"`
+	Base64Data string   `json:"image_base64" binding:"required"`
+	Format     string   `json:"format" binding:"omitempty"`
+	TopK       int      `json:"top_k" binding:"omitempty,min=1,max=100"`
+	Diversity  float64  `json:"diversity" binding:"omitempty,min=0,max=1"`
+	Tags       []string `json:"tags"`
+	Dataset    string   `json:"dataset"`
 }
 
 // SearchByBase64 searches for similar images using base64 image data
@@ -364,15 +715,43 @@ type Base64SearchRequest struct {
 // @Param search body Base64SearchRequest true "Base64 image data and search parameters"
 // @Success 200 {object} SearchResponse
 // @Failure 400 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /search/base64 [post]
 func (h *SearchHandler) SearchByBase64(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	tenant := principal.Tenant
 	var req Base64SearchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		requestBodyError(c, err, err.Error())
+		return
+	}
+
+	tags, err := services.NormalizeTags(req.Tags)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	attrFilters, err := services.ParseAttributeFilters(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	imageFilter, err := parseImageMetadataFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dataset, err := h.datasetService.ResolveDataset(tenant.ID, req.Dataset)
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	// Set default top_k if not provided
 	if req.TopK == 0 {
 		req.TopK = 10
@@ -383,9 +762,21 @@ func (h *SearchHandler) SearchByBase64(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "image_base64 is required"})
 		return
 	}
+	format, err := h.imageValidator.ValidateBase64(req.Base64Data, req.Format)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	req.Format = format
 
 	// Search for similar images using base64 data
-	results, err := h.vectorService.SearchSimilarFromBase64(req.Base64Data, req.Format, req.TopK)
+	searchOpts := services.SearchOptions{
+		TopK:       fetchTopK(principal, req.TopK, attrFilters, imageFilter),
+		Diversity:  req.Diversity,
+		Tags:       tags,
+		Partitions: []string{dataset.PartitionName},
+	}
+	results, err := h.vectorService.SearchSimilarFromBase64(req.Base64Data, req.Format, searchOpts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -395,27 +786,37 @@ func (h *SearchHandler) SearchByBase64(c *gin.Context) {
 	var searchResults []SearchResult
 	for _, result := range results {
 		// Find image by vector ID
-		image, err := h.findImageByVectorID(result.ImageID)
+		image, err := h.recordService.FindImageByVectorID(tenant.ID, result.ImageID)
 		if err != nil {
 			continue // Skip if image not found
 		}
+		if !imageFilter.Match(image) {
+			continue
+		}
 
 		// Get record information
-		record, err := h.recordService.GetRecord(image.RecordID)
+		record, err := h.visibleRecord(principal, image.RecordID)
 		if err != nil {
 			continue // Skip if record not found
 		}
 
+		if !services.MatchAttributes(record.Attributes, attrFilters) {
+			continue
+		}
+
 		searchResults = append(searchResults, SearchResult{
 			RecordID:    record.ID,
 			RecordName:  record.Name,
 			Description: record.Description,
+			Attributes:  record.Attributes,
 			ImageID:     image.ID,
 			Filename:    image.Filename,
 			Distance:    float64(result.Distance),
 		})
 	}
 
+	searchResults = truncateResults(searchResults, req.TopK)
+
 	c.JSON(http.StatusOK, gin.H{
 		"results": searchResults,
 		"count":   len(searchResults),
@@ -432,21 +833,55 @@ func (h *SearchHandler) SearchByBase64(c *gin.Context) {
 // @Param image body Base64SearchRequest true "Base64 image data"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /search/record-by-image [post]
 func (h *SearchHandler) GetRecordDetailsByImage(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	tenant := principal.Tenant
 	var req Base64SearchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		requestBodyError(c, err, err.Error())
+		return
+	}
+
+	tags, err := services.NormalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	attrFilters, err := services.ParseAttributeFilters(c.Request.URL.Query())
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	imageFilter, err := parseImageMetadataFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dataset, err := h.datasetService.ResolveDataset(tenant.ID, req.Dataset)
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	// Validate base64 data
 	if req.Base64Data == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "image_base64 is required"})
 		return
 	}
+	format, err := h.imageValidator.ValidateBase64(req.Base64Data, req.Format)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	req.Format = format
 
 	// Set default to get only the best match
 	if req.TopK == 0 {
@@ -454,7 +889,13 @@ func (h *SearchHandler) GetRecordDetailsByImage(c *gin.Context) {
 	}
 
 	// Search for similar images using base64 data
-	results, err := h.vectorService.SearchSimilarFromBase64(req.Base64Data, req.Format, req.TopK)
+	searchOpts := services.SearchOptions{
+		TopK:       fetchTopK(principal, req.TopK, attrFilters, imageFilter),
+		Diversity:  req.Diversity,
+		Tags:       tags,
+		Partitions: []string{dataset.PartitionName},
+	}
+	results, err := h.vectorService.SearchSimilarFromBase64(req.Base64Data, req.Format, searchOpts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -465,20 +906,29 @@ func (h *SearchHandler) GetRecordDetailsByImage(c *gin.Context) {
 		return
 	}
 
-	// Get the best match (first result)
-	bestMatch := results[0]
+	// Get the best match: the first result whose record satisfies the attribute filters
+	var (
+		bestMatch services.SearchResult
+		image     *models.Image
+		record    *models.Record
+	)
+	for _, result := range results {
+		candidate, err := h.recordService.FindImageByVectorID(tenant.ID, result.ImageID)
+		if err != nil || !imageFilter.Match(candidate) {
+			continue
+		}
 
-	// Find image by vector ID
-	image, err := h.findImageByVectorID(bestMatch.ImageID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "image not found for vector ID"})
-		return
+		candidateRecord, err := h.visibleRecord(principal, candidate.RecordID)
+		if err != nil || !services.MatchAttributes(candidateRecord.Attributes, attrFilters) {
+			continue
+		}
+
+		bestMatch, image, record = result, candidate, candidateRecord
+		break
 	}
 
-	// Get record information
-	record, err := h.recordService.GetRecord(image.RecordID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "record not found"})
+	if record == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no matching records found"})
 		return
 	}
 
@@ -487,6 +937,7 @@ func (h *SearchHandler) GetRecordDetailsByImage(c *gin.Context) {
 			"id":          record.ID,
 			"name":        record.Name,
 			"description": record.Description,
+			"attributes":  record.Attributes,
 			"created_at":  record.CreatedAt,
 			"updated_at":  record.UpdatedAt,
 		},
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"image-rag-backend/internal/api/middleware"
 	"image-rag-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -27,7 +28,8 @@ func NewStatsHandler(statsService *services.StatsService) *StatsHandler {
 // @Failure 500 {object} map[string]string "{"error": "Failed to fetch dashboard statistics"}"
 // @Router /api/v1/stats [get]
 func (h *StatsHandler) GetDashboardStats(c *gin.Context) {
-	stats, err := h.statsService.GetDashboardStats()
+	tenant := middleware.TenantFromContext(c)
+	stats, err := h.statsService.GetDashboardStats(tenant.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to fetch dashboard statistics",
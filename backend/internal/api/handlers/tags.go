@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/authz"
+	"image-rag-backend/internal/logger"
+	"image-rag-backend/internal/models"
+	"image-rag-backend/internal/services"
+)
+
+type TagHandler struct {
+	tagService *services.TagService
+	logger     *logger.Logger
+}
+
+func NewTagHandler(tagService *services.TagService, logger *logger.Logger) *TagHandler {
+	return &TagHandler{
+		tagService: tagService,
+		logger:     logger,
+	}
+}
+
+// ListTags returns all tags with usage counts
+// @Summary List tags
+// @Description List all tags with the number of records and images carrying each tag
+// @Tags Tags
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /tags [get]
+func (h *TagHandler) ListTags(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	tags, err := h.tagService.ListTags(tenant.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  tags,
+		"total": len(tags),
+	})
+}
+
+// CreateTag creates a tag
+// @Summary Create tag
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param tag body models.CreateTagRequest true "Tag name"
+// @Success 201 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Router /tags [post]
+func (h *TagHandler) CreateTag(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	var req models.CreateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag, err := h.tagService.CreateTag(tenant.ID, req.Name)
+	if err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// UpdateTag renames a tag
+// @Summary Rename tag
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Param tag body models.CreateTagRequest true "New tag name"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /tags/{id} [put]
+func (h *TagHandler) UpdateTag(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag ID"})
+		return
+	}
+
+	var req models.CreateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag, err := h.tagService.RenameTag(tenant.ID, uint(id), req.Name)
+	if err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag deletes a tag from all records and images
+// @Summary Delete tag
+// @Tags Tags
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tags/{id} [delete]
+func (h *TagHandler) DeleteTag(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag ID"})
+		return
+	}
+
+	if err := h.tagService.DeleteTag(tenant.ID, uint(id)); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "tag deleted successfully"})
+}
+
+// BulkTag tags or untags many records and images at once
+// @Summary Bulk tag or untag
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param request body models.BulkTagRequest true "Bulk tag request"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tags/bulk [post]
+func (h *TagHandler) BulkTag(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	var req models.BulkTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.RecordIDs) == 0 && len(req.ImageIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "record_ids or image_ids is required"})
+		return
+	}
+
+	// Every target is checked before any is changed
+	if err := h.authorizeTargets(c, req.RecordIDs, req.ImageIDs); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	recordFn, imageFn := h.tagService.TagRecords, h.tagService.TagImages
+	if req.Action == "untag" {
+		recordFn, imageFn = h.tagService.UntagRecords, h.tagService.UntagImages
+	}
+
+	if err := recordFn(tenant.ID, req.RecordIDs, req.Tags); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := imageFn(tenant.ID, req.ImageIDs, req.Tags); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "tags updated successfully",
+		"action":       req.Action,
+		"tags":         req.Tags,
+		"record_count": len(req.RecordIDs),
+		"image_count":  len(req.ImageIDs),
+	})
+}
+
+// TagRecord attaches tags to a record
+// @Summary Tag record
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Record ID"
+// @Param tags body models.TagsRequest true "Tags to attach"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /records/{id}/tags [post]
+func (h *TagHandler) TagRecord(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	recordID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
+		return
+	}
+
+	var req models.TagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authorizeTargets(c, []uint{uint(recordID)}, nil); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.tagService.TagRecords(tenant.ID, []uint{uint(recordID)}, req.Tags); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondRecordTags(c, tenant.ID, uint(recordID))
+}
+
+// UntagRecord detaches a tag from a record
+// @Summary Untag record
+// @Tags Tags
+// @Produce json
+// @Param id path int true "Record ID"
+// @Param tag path string true "Tag name"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /records/{id}/tags/{tag} [delete]
+func (h *TagHandler) UntagRecord(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	recordID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
+		return
+	}
+
+	if err := h.authorizeTargets(c, []uint{uint(recordID)}, nil); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.tagService.UntagRecords(tenant.ID, []uint{uint(recordID)}, []string{c.Param("tag")}); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondRecordTags(c, tenant.ID, uint(recordID))
+}
+
+// TagImage attaches tags to an image
+// @Summary Tag image
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param image_id path int true "Image ID"
+// @Param tags body models.TagsRequest true "Tags to attach"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /images/{image_id}/tags [post]
+func (h *TagHandler) TagImage(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	imageID, err := strconv.ParseUint(c.Param("image_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID"})
+		return
+	}
+
+	var req models.TagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authorizeTargets(c, nil, []uint{uint(imageID)}); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.tagService.TagImages(tenant.ID, []uint{uint(imageID)}, req.Tags); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondImageTags(c, tenant.ID, uint(imageID))
+}
+
+// UntagImage detaches a tag from an image
+// @Summary Untag image
+// @Tags Tags
+// @Produce json
+// @Param image_id path int true "Image ID"
+// @Param tag path string true "Tag name"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /images/{image_id}/tags/{tag} [delete]
+func (h *TagHandler) UntagImage(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	imageID, err := strconv.ParseUint(c.Param("image_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID"})
+		return
+	}
+
+	if err := h.authorizeTargets(c, nil, []uint{uint(imageID)}); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.tagService.UntagImages(tenant.ID, []uint{uint(imageID)}, []string{c.Param("tag")}); err != nil {
+		c.JSON(tagErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondImageTags(c, tenant.ID, uint(imageID))
+}
+
+// authorizeTargets checks that the caller may change the tags of every record and image.
+// Tagging a record updates it; tagging an image manages its record's images. Targets the
+// caller cannot see are reported as not found.
+func (h *TagHandler) authorizeTargets(c *gin.Context, recordIDs, imageIDs []uint) error {
+	principal := middleware.PrincipalFromContext(c)
+	records, err := h.tagService.FindRecords(principal.Tenant.ID, recordIDs)
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		if err := authz.Authorize(principal, &records[i], authz.ActionUpdate); err != nil {
+			return err
+		}
+	}
+
+	records, err = h.tagService.FindImageRecords(principal.Tenant.ID, imageIDs)
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		if err := authz.Authorize(principal, &records[i], authz.ActionManageImages); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				return fmt.Errorf("image not found")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *TagHandler) respondRecordTags(c *gin.Context, tenantID, recordID uint) {
+	tags, err := h.tagService.RecordTagNames(tenantID, recordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"record_id": recordID, "tags": tags})
+}
+
+func (h *TagHandler) respondImageTags(c *gin.Context, tenantID, imageID uint) {
+	tags, err := h.tagService.EffectiveImageTags(tenantID, imageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"image_id": imageID, "tags": tags})
+}
+
+// tagErrorStatus maps tag service errors to HTTP status codes
+func tagErrorStatus(err error) int {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		return http.StatusNotFound
+	case strings.HasPrefix(msg, "forbidden"):
+		return http.StatusForbidden
+	case strings.Contains(msg, "already exists"):
+		return http.StatusConflict
+	case strings.HasPrefix(msg, "tag ") || strings.Contains(msg, "required"):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseTagList splits repeated and comma separated tag values
+func parseTagList(values []string) []string {
+	var tags []string
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// parseTagFilter reads the normalized tags query parameter
+func parseTagFilter(c *gin.Context) ([]string, error) {
+	return services.NormalizeTags(parseTagList(c.QueryArray("tags")))
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/authz"
+	"image-rag-backend/internal/logger"
+	"image-rag-backend/internal/services"
+)
+
+type TrashHandler struct {
+	trashService *services.TrashService
+	logger       *logger.Logger
+}
+
+func NewTrashHandler(trashService *services.TrashService, logger *logger.Logger) *TrashHandler {
+	return &TrashHandler{
+		trashService: trashService,
+		logger:       logger,
+	}
+}
+
+// ListTrash returns the caller's visible trashed records and images
+// @Summary List trash
+// @Description List deleted records and images that can still be restored, with when each will be purged
+// @Tags Trash
+// @Produce json
+// @Success 200 {object} models.TrashResponse
+// @Failure 500 {object} map[string]string
+// @Router /trash [get]
+func (h *TrashHandler) ListTrash(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	trash, err := h.trashService.ListTrash(principal.Tenant.ID, principal)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, trash)
+}
+
+// RestoreRecord takes a record and its images out of the trash; editors may only restore records they own
+// @Summary Restore record
+// @Tags Trash
+// @Produce json
+// @Param id path int true "Record ID"
+// @Success 200 {object} models.Record
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /records/{id}/restore [post]
+func (h *TrashHandler) RestoreRecord(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
+		return
+	}
+
+	record, err := h.trashService.FindRecord(principal.Tenant.ID, uint(id))
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := authz.Authorize(principal, record, authz.ActionDelete); err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	restored, err := h.trashService.RestoreRecord(auditActor(c), principal.Tenant.ID, uint(id))
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, restored)
+}
+
+// RestoreImage takes an image out of the trash; its record must not be in the trash
+// @Summary Restore image
+// @Tags Trash
+// @Produce json
+// @Param image_id path int true "Image ID"
+// @Success 200 {object} models.Image
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /images/{image_id}/restore [post]
+func (h *TrashHandler) RestoreImage(c *gin.Context) {
+	principal := middleware.PrincipalFromContext(c)
+	imageID, err := strconv.ParseUint(c.Param("image_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID"})
+		return
+	}
+
+	image, err := h.trashService.FindImage(principal.Tenant.ID, uint(imageID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		return
+	}
+	record, err := h.trashService.FindRecord(principal.Tenant.ID, image.RecordID)
+	if err == nil {
+		err = authz.Authorize(principal, record, authz.ActionManageImages)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		} else {
+			c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	restored, err := h.trashService.RestoreImage(auditActor(c), principal.Tenant.ID, uint(imageID))
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, restored)
+}
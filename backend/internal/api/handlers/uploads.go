@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/blobstore"
+	"image-rag-backend/internal/services"
+)
+
+type UploadHandler struct {
+	recordService *services.RecordService
+}
+
+func NewUploadHandler(recordService *services.RecordService) *UploadHandler {
+	return &UploadHandler{recordService: recordService}
+}
+
+// ServeUpload serves an uploaded file from the requesting tenant's prefix of the blob store
+func (h *UploadHandler) ServeUpload(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+
+	// Cleaning a rooted path strips any ".." segments
+	key := strings.TrimPrefix(path.Clean("/"+c.Param("filepath")), "/")
+
+	// Files uploaded before tenancy sit directly in the storage root and belong to the default tenant
+	legacy := tenant.Name == services.DefaultTenantName && !strings.Contains(key, "/")
+	if !strings.HasPrefix(key, tenant.Name+"/") && !legacy {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+
+	reader, info, err := h.recordService.OpenImageFile(c.Request.Context(), key)
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": "file not found"})
+		return
+	}
+	defer reader.Close()
+
+	serveBlob(c, reader, info)
+}
+
+// serveBlob writes a blob to the response. Seekable blobs, which both stores return,
+// get conditional and range request support.
+func serveBlob(c *gin.Context, reader io.Reader, info *blobstore.Info) {
+	c.Header("Content-Type", info.ContentType)
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, path.Base(info.Key), info.ModTime, seeker)
+		return
+	}
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+}
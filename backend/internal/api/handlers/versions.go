@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/authz"
+)
+
+// ListVersions returns a record's version history, newest first
+// @Summary List record versions
+// @Tags Records
+// @Produce json
+// @Param id path int true "Record ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /records/{id}/versions [get]
+func (h *RecordHandler) ListVersions(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
+		return
+	}
+	if _, err := h.authorizedRecord(c, uint(id), authz.ActionView); err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	versions, err := h.versionService.ListVersions(tenant.ID, uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  versions,
+		"total": len(versions),
+	})
+}
+
+// GetVersion returns one version of a record
+// @Summary Get record version
+// @Tags Records
+// @Produce json
+// @Param id path int true "Record ID"
+// @Param version path int true "Version number"
+// @Success 200 {object} models.RecordVersion
+// @Failure 404 {object} map[string]string
+// @Router /records/{id}/versions/{version} [get]
+func (h *RecordHandler) GetVersion(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
+		return
+	}
+	version, err := parseVersion(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.authorizedRecord(c, uint(id), authz.ActionView); err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	v, err := h.versionService.GetVersion(tenant.ID, uint(id), version)
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// DiffVersions compares two versions of a record
+// @Summary Diff record versions
+// @Description Field changes and images added or removed between two versions
+// @Tags Records
+// @Produce json
+// @Param id path int true "Record ID"
+// @Param from query int true "Older version"
+// @Param to query int true "Newer version"
+// @Success 200 {object} models.RecordVersionDiff
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /records/{id}/versions/diff [get]
+func (h *RecordHandler) DiffVersions(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
+		return
+	}
+	from, err := parseVersion(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from: " + err.Error()})
+		return
+	}
+	to, err := parseVersion(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to: " + err.Error()})
+		return
+	}
+	if _, err := h.authorizedRecord(c, uint(id), authz.ActionView); err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	diff, err := h.versionService.DiffVersions(tenant.ID, uint(id), from, to)
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// RevertRecord reverts a record's fields and images to an earlier version
+// @Summary Revert record to version
+// @Description Restores the fields and image set of a version as a new version; removed images are taken out of the trash
+// @Tags Records
+// @Produce json
+// @Param id path int true "Record ID"
+// @Param version path int true "Version number"
+// @Success 200 {object} models.RevertRecordResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /records/{id}/versions/{version}/revert [post]
+func (h *RecordHandler) RevertRecord(c *gin.Context) {
+	tenant := middleware.TenantFromContext(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record ID"})
+		return
+	}
+	version, err := parseVersion(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Reverting may change both the record's fields and its images
+	for _, action := range []authz.Action{authz.ActionUpdate, authz.ActionManageImages} {
+		if _, err := h.authorizedRecord(c, uint(id), action); err != nil {
+			c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	result, err := h.versionService.RevertRecord(auditActor(c), tenant.ID, uint(id), version)
+	if err != nil {
+		c.JSON(recordErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func parseVersion(value string) (int, error) {
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid version: %q", value)
+	}
+	return version, nil
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"image-rag-backend/internal/models"
+)
+
+// principalContextKey is the gin context key holding the authenticated caller
+const principalContextKey = "principal"
+
+// Authenticator maps a request credential to the caller it belongs to
+type Authenticator interface {
+	Authenticate(credential string) (*models.Principal, error)
+}
+
+// AuthMiddleware authenticates the request credential and rejects unauthenticated requests
+func AuthMiddleware(authenticator Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := authenticator.Authenticate(Credential(c))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set(principalContextKey, principal)
+		c.Next()
+	}
+}
+
+// RequireScope rejects callers whose credential was not granted the scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := PrincipalFromContext(c)
+		if principal == nil || !principal.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "missing required scope: " + scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// PrincipalFromContext returns the caller authenticated by AuthMiddleware
+func PrincipalFromContext(c *gin.Context) *models.Principal {
+	if value, ok := c.Get(principalContextKey); ok {
+		if principal, ok := value.(*models.Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
+
+// TenantFromContext returns the tenant of the authenticated caller
+func TenantFromContext(c *gin.Context) *models.Tenant {
+	if principal := PrincipalFromContext(c); principal != nil {
+		return principal.Tenant
+	}
+	return nil
+}
+
+// Credential extracts the bearer token or X-API-Key header from a request
+func Credential(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(c.GetHeader("X-API-Key"))
+}
@@ -10,11 +10,15 @@ import (
 	"github.com/google/uuid"
 )
 
+// requestIDContextKey is the gin context key holding the request ID
+const requestIDContextKey = "request_id"
+
 func LoggingMiddleware(log *logger.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Generate request ID
+		// Generate request ID and return it so clients can correlate audit entries and logs
 		requestID := uuid.New().String()
-		c.Set("request_id", requestID)
+		c.Set(requestIDContextKey, requestID)
+		c.Header("X-Request-ID", requestID)
 
 		// Start timer
 		start := time.Now()
@@ -47,9 +51,14 @@ func LoggingMiddleware(log *logger.Logger) gin.HandlerFunc {
 	}
 }
 
+// RequestIDFromContext returns the ID LoggingMiddleware assigned to the request
+func RequestIDFromContext(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
 func ErrorHandlerMiddleware(log *logger.Logger) gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
-		requestID, _ := c.Get("request_id")
+		requestID, _ := c.Get(requestIDContextKey)
 
 		// Log the panic
 		log.ErrorWithContext(map[string]interface{}{
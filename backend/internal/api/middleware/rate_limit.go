@@ -1,76 +1,105 @@
 package middleware
 
 import (
-	"sync"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-)
 
-// RateLimiter implements a simple rate limiter
-// This is a basic implementation - consider using redis for production
+	"image-rag-backend/internal/logger"
+	"image-rag-backend/internal/models"
+	"image-rag-backend/internal/ratelimit"
+)
 
+// RateLimiter applies token-bucket limits per route class and caller, and per client IP
 type RateLimiter struct {
-	requests map[string][]time.Time
-	mu       sync.RWMutex
-	limit    int
-	window   time.Duration
+	store ratelimit.Store
+	// limits holds the default limit of each route class
+	limits map[string]ratelimit.Limit
+	log    *logger.Logger
 }
 
-func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+func NewRateLimiter(store ratelimit.Store, limits map[string]ratelimit.Limit, log *logger.Logger) *RateLimiter {
 	return &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
+		store:  store,
+		limits: limits,
+		log:    log,
 	}
 }
 
-func (rl *RateLimiter) Allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
+// Limit rate limits a route class. It must run after AuthMiddleware so API keys get
+// their own buckets and quotas; other callers are limited per user or per client IP.
+func (rl *RateLimiter) Limit(class string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := PrincipalFromContext(c)
+		rl.take(c, class+":"+rateLimitKey(c, principal), rl.limitFor(principal, class))
+	}
+}
 
-	// Clean old requests
-	requests := rl.requests[ip]
-	var validRequests []time.Time
-	for _, req := range requests {
-		if now.Sub(req) < rl.window {
-			validRequests = append(validRequests, req)
-		}
+// LimitIP rate limits every request per client IP, whoever the caller claims to be. It runs
+// before AuthMiddleware, so unauthenticated requests and failed credential guesses are limited too.
+func (rl *RateLimiter) LimitIP(limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rl.take(c, "ip:"+c.ClientIP(), limit)
 	}
+}
 
-	// Check if limit exceeded
-	if len(validRequests) >= rl.limit {
-		rl.requests[ip] = validRequests
-		return false
+// take removes a token from a bucket, aborting the request with 429 when it is empty
+func (rl *RateLimiter) take(c *gin.Context, key string, limit ratelimit.Limit) {
+	result, err := rl.store.Take(c.Request.Context(), key, limit)
+	if err != nil {
+		// Fail open: an unavailable backend must not take the API down with it
+		rl.log.Error("rate limiter unavailable: %v", err)
+		c.Next()
+		return
 	}
 
-	// Add new request
-	validRequests = append(validRequests, now)
-	rl.requests[ip] = validRequests
-	return true
-}
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, ceilSeconds(limit.Period)))
 
-// RateLimitMiddleware creates a rate limiting middleware
-func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
-	rateLimiter := NewRateLimiter(limit, window)
+	if !result.Allowed {
+		retryAfter := ceilSeconds(result.RetryAfter)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "rate limit exceeded",
+			"retry_after": retryAfter,
+		})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
 
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		if !rateLimiter.Allow(ip) {
-			c.JSON(429, gin.H{
-				"error":       "Rate limit exceeded",
-				"retry_after": window.Seconds(),
-			})
-			c.Abort()
-			return
+// limitFor returns the caller's own quota for a class, falling back to the class default
+func (rl *RateLimiter) limitFor(principal *models.Principal, class string) ratelimit.Limit {
+	if principal != nil {
+		if spec, ok := principal.RateLimits[class]; ok {
+			// Overrides are validated when keys are created
+			if limit, err := ratelimit.ParseLimit(spec); err == nil {
+				return limit
+			}
 		}
-		c.Next()
+	}
+	return rl.limits[class]
+}
+
+// rateLimitKey identifies the bucket owner: the API key, the SSO user or the client IP
+func rateLimitKey(c *gin.Context, principal *models.Principal) string {
+	switch {
+	case principal != nil && principal.APIKeyID != 0:
+		return fmt.Sprintf("key:%d", principal.APIKeyID)
+	case principal != nil && principal.Subject != "":
+		return fmt.Sprintf("user:%d:%s", principal.Tenant.ID, principal.Subject)
+	default:
+		return "ip:" + c.ClientIP()
 	}
 }
 
-// DefaultRateLimit returns a middleware with sensible defaults
-func DefaultRateLimit() gin.HandlerFunc {
-	return RateLimitMiddleware(100, time.Minute)
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
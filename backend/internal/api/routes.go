@@ -3,10 +3,13 @@ package api
 import (
 	"image-rag-backend/internal/api/handlers"
 	"image-rag-backend/internal/api/middleware"
+	"image-rag-backend/internal/blobstore"
 	"image-rag-backend/internal/config"
 	"image-rag-backend/internal/database"
 	"image-rag-backend/internal/logger"
 	"image-rag-backend/internal/milvus"
+	"image-rag-backend/internal/models"
+	"image-rag-backend/internal/ratelimit"
 	"image-rag-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -15,29 +18,96 @@ import (
 )
 
 func SetupRoutes(router *gin.Engine, cfg *config.Config, log *logger.Logger) {
+	blobStore, err := blobstore.NewStore(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize blob storage: %v", err)
+	}
+
 	// Initialize services
-	recordService := services.NewRecordService()
+	recordService := services.NewRecordService(blobStore)
+	attributeSchema, err := services.LoadAttributeSchema(cfg.Attributes.SchemaPath)
+	if err != nil {
+		log.Fatal("Failed to load attribute schema: %v", err)
+	}
+	recordService.SetAttributeSchema(attributeSchema)
+
 	vectorService, err := services.NewVectorService(cfg)
 	if err != nil {
 		log.Fatal("Failed to initialize vector service: %v", err)
 	}
 	statsService := services.NewStatsService(database.DB)
+	tagService := services.NewTagService(vectorService)
+	datasetService := services.NewDatasetService(vectorService, blobStore)
+	tenantService := services.NewTenantService(datasetService)
+	if err := tenantService.Init(cfg.Tenancy.Credentials); err != nil {
+		log.Fatal("Failed to initialize tenants: %v", err)
+	}
+	apiKeyService := services.NewAPIKeyService()
+	jwtService, err := services.NewJWTService(cfg.JWT)
+	if err != nil {
+		log.Fatal("Failed to initialize JWT verification: %v", err)
+	}
+	trashService := services.NewTrashService(vectorService, tagService, blobStore, cfg.Trash.Retention)
+	versionService := services.NewVersionService(vectorService, trashService)
+	imageValidator := services.NewImageValidator(cfg.Upload)
+	thumbnailService, err := services.NewThumbnailService(blobStore, cfg.Thumbnail)
+	if err != nil {
+		log.Fatal("Failed to initialize thumbnails: %v", err)
+	}
+	transformService, err := services.NewTransformService(blobStore, cfg.Transform)
+	if err != nil {
+		log.Fatal("Failed to initialize image transforms: %v", err)
+	}
+	duplicateService, err := services.NewDuplicateService(recordService, vectorService, tagService, cfg.Duplicates)
+	if err != nil {
+		log.Fatal("Failed to initialize duplicate detection: %v", err)
+	}
+	if err := duplicateService.FailInterruptedScans(); err != nil {
+		log.Error("Failed to clean up interrupted duplicate scans: %v", err)
+	}
+	authService := services.NewAuthService(tenantService, apiKeyService, jwtService, cfg.Auth.Required)
+
+	rateLimits, err := ratelimit.ParseLimits(cfg.RateLimit.Limits)
+	if err != nil {
+		log.Fatal("Failed to parse rate limits: %v", err)
+	}
+	ipLimit, err := ratelimit.ParseLimit(cfg.RateLimit.IP)
+	if err != nil {
+		log.Fatal("Failed to parse IP rate limit: %v", err)
+	}
+	rateLimitStore, err := ratelimit.NewStore(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiter: %v", err)
+	}
+	rateLimiter := middleware.NewRateLimiter(rateLimitStore, rateLimits, log)
 
 	// Initialize handlers
-	recordHandler := handlers.NewRecordHandler(recordService, vectorService, log)
-	searchHandler := handlers.NewSearchHandler(recordService, vectorService, log)
+	recordHandler := handlers.NewRecordHandler(recordService, vectorService, tagService, datasetService, versionService,
+		duplicateService, imageValidator, thumbnailService, transformService, log)
+	searchHandler := handlers.NewSearchHandler(recordService, vectorService, datasetService, imageValidator, log)
+	tagHandler := handlers.NewTagHandler(tagService, log)
+	datasetHandler := handlers.NewDatasetHandler(datasetService, log)
+	uploadHandler := handlers.NewUploadHandler(recordService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService, log)
+	authHandler := handlers.NewAuthHandler()
+	auditHandler := handlers.NewAuditHandler(services.NewAuditService(), log)
+	trashHandler := handlers.NewTrashHandler(trashService, log)
+	duplicateHandler := handlers.NewDuplicateHandler(duplicateService, log)
+
+	// Permanently remove trashed records and images once their retention expires
+	trashService.StartPurger(cfg.Trash.PurgeInterval, log)
 
 	// Global middleware
 	router.Use(middleware.LoggingMiddleware(log))
 	router.Use(middleware.ErrorHandlerMiddleware(log))
 	router.Use(middleware.CORSMiddleware())
-	router.Use(middleware.DefaultRateLimit())
 
 	// Set max multipart memory to 64MB
 	router.MaxMultipartMemory = 64 << 20 // 64 MB
 
-	// API routes
-	api := router.Group("/api/v1")
+	// API routes, limited per client IP ahead of authentication so credential guessing is bounded
+	limitIP := rateLimiter.LimitIP(ipLimit)
+	api := router.Group("/api/v1", limitIP)
 
 	// Swagger documentation
 	api.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
@@ -60,31 +130,101 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config, log *logger.Logger) {
 	api.GET("/health/ready", healthHandler.ReadinessCheck)
 	api.GET("/health/live", healthHandler.LivenessCheck)
 
+	// Everything below requires a credential, is scoped to the caller's tenant
+	// and is rate limited per route class and caller
+	authMiddleware := middleware.AuthMiddleware(authService)
+	api = api.Group("", authMiddleware)
+
+	readAPI := api.Group("", middleware.RequireScope(models.ScopeRecordsRead), rateLimiter.Limit(ratelimit.ClassRead))
+	writeAPI := api.Group("", middleware.RequireScope(models.ScopeRecordsWrite),
+		rateLimiter.Limit(ratelimit.ClassWrite))
+	// Upload and search bodies carry images and are capped at MAX_REQUEST_SIZE_MB
+	bodyLimit := middleware.LimitRequestBody(imageValidator.MaxRequestBytes())
+	uploadAPI := api.Group("", middleware.RequireScope(models.ScopeRecordsWrite),
+		rateLimiter.Limit(ratelimit.ClassUpload), bodyLimit)
+	searchAPI := api.Group("", middleware.RequireScope(models.ScopeSearch), rateLimiter.Limit(ratelimit.ClassSearch),
+		bodyLimit)
+	// Transforms decode and re-encode images, so they have their own, tighter limit
+	transformAPI := api.Group("", middleware.RequireScope(models.ScopeRecordsRead),
+		rateLimiter.Limit(ratelimit.ClassTransform))
+	adminAPI := api.Group("", middleware.RequireScope(models.ScopeAdmin), rateLimiter.Limit(ratelimit.ClassWrite))
+
+	// Identity of the caller, used by the web UI after SSO sign-in
+	api.GET("/auth/me", rateLimiter.Limit(ratelimit.ClassRead), authHandler.GetCurrentUser)
+
+	// API key routes
+	adminAPI.GET("/api-keys", apiKeyHandler.ListAPIKeys)
+	adminAPI.POST("/api-keys", apiKeyHandler.CreateAPIKey)
+	adminAPI.DELETE("/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+
+	// Audit log routes
+	adminAPI.GET("/audit", auditHandler.ListAuditEntries)
+	adminAPI.GET("/audit/export", auditHandler.ExportAuditEntries)
+
+	// Dataset routes
+	readAPI.GET("/datasets", datasetHandler.ListDatasets)
+	adminAPI.POST("/datasets", datasetHandler.CreateDataset)
+	adminAPI.PUT("/datasets/:id", datasetHandler.UpdateDataset)
+	adminAPI.DELETE("/datasets/:id", datasetHandler.DeleteDataset)
+
 	// Records routes
-	api.POST("/records", recordHandler.CreateRecord)
-	api.GET("/records", recordHandler.GetRecords)
-	api.GET("/records/:id", recordHandler.GetRecord)
-	api.PUT("/records/:id", recordHandler.UpdateRecord)
-	api.DELETE("/records/:id", recordHandler.DeleteRecord)
+	uploadAPI.POST("/records", recordHandler.CreateRecord)
+	readAPI.GET("/records", recordHandler.GetRecords)
+	readAPI.GET("/records/:id", recordHandler.GetRecord)
+	writeAPI.PUT("/records/:id", recordHandler.UpdateRecord)
+	writeAPI.PATCH("/records/:id", recordHandler.PatchRecord)
+	writeAPI.DELETE("/records/:id", recordHandler.DeleteRecord)
+
+	// Record version history routes
+	readAPI.GET("/records/:id/versions", recordHandler.ListVersions)
+	readAPI.GET("/records/:id/versions/diff", recordHandler.DiffVersions)
+	readAPI.GET("/records/:id/versions/:version", recordHandler.GetVersion)
+	writeAPI.POST("/records/:id/versions/:version/revert", recordHandler.RevertRecord)
 
 	// Image management routes
-	api.POST("/records/:id/images", recordHandler.AddImageToRecord)
-	api.DELETE("/images/:image_id", recordHandler.DeleteImage)
-	api.GET("/images/:id/preview", recordHandler.GetImagePreview)
+	uploadAPI.POST("/records/:id/images", recordHandler.AddImageToRecord)
+	writeAPI.DELETE("/images/:image_id", recordHandler.DeleteImage)
+	readAPI.GET("/images/:id/preview", recordHandler.GetImagePreview)
+	transformAPI.GET("/images/:id/transform", recordHandler.TransformImage)
+	readAPI.GET("/duplicates", duplicateHandler.ListDuplicateClusters)
+
+	// Duplicate scan routes
+	adminAPI.POST("/duplicates/scans", duplicateHandler.StartScan)
+	adminAPI.GET("/duplicates/scans", duplicateHandler.ListScans)
+	adminAPI.GET("/duplicates/scans/:id", duplicateHandler.GetScan)
+	adminAPI.GET("/duplicates/scans/:id/clusters", duplicateHandler.ListScanClusters)
+	adminAPI.POST("/duplicates/scans/:id/resolve", duplicateHandler.ResolveClusters)
+
+	// Trash routes
+	readAPI.GET("/trash", trashHandler.ListTrash)
+	writeAPI.POST("/records/:id/restore", trashHandler.RestoreRecord)
+	writeAPI.POST("/images/:image_id/restore", trashHandler.RestoreImage)
+
+	// Tag routes
+	readAPI.GET("/tags", tagHandler.ListTags)
+	writeAPI.POST("/tags", tagHandler.CreateTag)
+	writeAPI.POST("/tags/bulk", tagHandler.BulkTag)
+	writeAPI.PUT("/tags/:id", tagHandler.UpdateTag)
+	writeAPI.DELETE("/tags/:id", tagHandler.DeleteTag)
+	writeAPI.POST("/records/:id/tags", tagHandler.TagRecord)
+	writeAPI.DELETE("/records/:id/tags/:tag", tagHandler.UntagRecord)
+	writeAPI.POST("/images/:image_id/tags", tagHandler.TagImage)
+	writeAPI.DELETE("/images/:image_id/tags/:tag", tagHandler.UntagImage)
 
 	// Search routes
-	api.POST("/search", searchHandler.SearchImages)
-	api.GET("/search/similar/:id", searchHandler.FindSimilar)
-	api.POST("/search/advanced", searchHandler.AdvancedSearch)
-	api.GET("/search/by-vector/:vector_id", searchHandler.GetImageByVectorID)
-	api.POST("/search/base64", searchHandler.SearchByBase64)
-	api.POST("/search/record-by-image", searchHandler.GetRecordDetailsByImage)
+	searchAPI.POST("/search", searchHandler.SearchImages)
+	searchAPI.GET("/search/similar/:id", searchHandler.FindSimilar)
+	searchAPI.POST("/search/advanced", searchHandler.AdvancedSearch)
+	searchAPI.GET("/search/by-vector/:vector_id", searchHandler.GetImageByVectorID)
+	searchAPI.POST("/search/base64", searchHandler.SearchByBase64)
+	searchAPI.POST("/search/record-by-image", searchHandler.GetRecordDetailsByImage)
 
 	// Stats routes
-	api.GET("/stats", statsHandler.GetDashboardStats)
+	readAPI.GET("/stats", statsHandler.GetDashboardStats)
 
-	// Serve uploaded images
-	router.Static("/uploads", "./uploads")
+	// Serve uploaded images from the tenant's own prefix of the blob store
+	router.GET("/uploads/*filepath", limitIP, authMiddleware, middleware.RequireScope(models.ScopeRecordsRead),
+		rateLimiter.Limit(ratelimit.ClassRead), uploadHandler.ServeUpload)
 }
 
 // Note: The services.NewConfig() should be properly initialized from main.go
@@ -0,0 +1,122 @@
+// Package authz decides what an authenticated caller may do with records.
+//
+// A caller's role follows from its scopes: admin scope makes an admin,
+// records:write an editor and any other scope a viewer. Admins may do anything
+// within their tenant. Editors may change and delete the records they own.
+// Viewers and editors see every tenant-visible record plus their own private
+// ones. Records the caller cannot see are reported as not found.
+package authz
+
+import (
+	"fmt"
+
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Action is an operation on a record
+type Action string
+
+const (
+	ActionView   Action = "view"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+	// ActionManageImages covers adding and removing a record's images
+	ActionManageImages Action = "manage images of"
+)
+
+// Role returns the effective role of a principal
+func Role(p *models.Principal) string {
+	switch {
+	case p == nil:
+		return ""
+	case p.HasScope(models.ScopeAdmin):
+		return models.RoleAdmin
+	case p.HasScope(models.ScopeRecordsWrite):
+		return models.RoleEditor
+	case len(p.Scopes) > 0:
+		return models.RoleViewer
+	default:
+		return ""
+	}
+}
+
+// OwnerID returns the owner ID recorded on records a principal creates. It is
+// empty for static tenant tokens and anonymous development callers, which are admins.
+func OwnerID(p *models.Principal) string {
+	switch {
+	case p == nil:
+		return ""
+	case p.Subject != "":
+		return "user:" + p.Subject
+	case p.APIKeyID != 0:
+		return fmt.Sprintf("apikey:%d", p.APIKeyID)
+	default:
+		return ""
+	}
+}
+
+// Can reports whether a principal may perform an action on a record
+func Can(p *models.Principal, record *models.Record, action Action) bool {
+	if p == nil || p.Tenant == nil || record.TenantID != p.Tenant.ID {
+		return false
+	}
+
+	role := Role(p)
+	if role == models.RoleAdmin {
+		return true
+	}
+
+	owned := record.OwnerID != "" && record.OwnerID == OwnerID(p)
+	switch action {
+	case ActionView:
+		return role != "" && (record.Visibility != models.VisibilityPrivate || owned)
+	case ActionUpdate, ActionDelete, ActionManageImages:
+		return role == models.RoleEditor && owned
+	default:
+		return false
+	}
+}
+
+// Authorize returns an error when a principal may not perform an action on a record.
+// Records the principal cannot see are reported as not found so their existence is not revealed.
+func Authorize(p *models.Principal, record *models.Record, action Action) error {
+	if Can(p, record, action) {
+		return nil
+	}
+	if action != ActionView && Can(p, record, ActionView) {
+		return fmt.Errorf("forbidden: %s role cannot %s record %d", roleName(p), action, record.ID)
+	}
+	return fmt.Errorf("record not found")
+}
+
+// VisibleRecords restricts a query over the records table to the records a principal may see
+func VisibleRecords(p *models.Principal) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if Role(p) == models.RoleAdmin {
+			return db
+		}
+		if owner := OwnerID(p); owner != "" {
+			return db.Where("(records.visibility <> ? OR records.owner_id = ?)", models.VisibilityPrivate, owner)
+		}
+		return db.Where("records.visibility <> ?", models.VisibilityPrivate)
+	}
+}
+
+// ValidateVisibility checks a requested record visibility; empty means unchanged or the default
+func ValidateVisibility(visibility string) error {
+	switch visibility {
+	case "", models.VisibilityTenant, models.VisibilityPrivate:
+		return nil
+	default:
+		return fmt.Errorf("invalid visibility: must be %s or %s", models.VisibilityTenant, models.VisibilityPrivate)
+	}
+}
+
+func roleName(p *models.Principal) string {
+	if role := Role(p); role != "" {
+		return role
+	}
+	return "unprivileged"
+}
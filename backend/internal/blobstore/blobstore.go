@@ -0,0 +1,69 @@
+// Package blobstore keeps image files behind one interface, either on the local
+// filesystem or in an S3-compatible object store so replicas can share them.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"image-rag-backend/internal/config"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// Info describes a stored blob
+type Info struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Store keeps blobs under slash-separated keys such as "<tenant>/<filename>"
+type Store interface {
+	// Put streams r into the blob under key, replacing any existing blob; size is -1 when unknown
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens a blob for reading; the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, *Info, error)
+	Stat(ctx context.Context, key string) (*Info, error)
+	// Delete removes a blob; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every blob whose key starts with prefix, stopping at the first error
+	List(ctx context.Context, prefix string, fn func(Info) error) error
+}
+
+// NewStore creates the blob store selected by the configuration
+func NewStore(cfg *config.Config) (Store, error) {
+	switch cfg.Storage.Backend {
+	case "", "local":
+		return NewLocalStore(cfg.Upload.Path)
+	case "s3":
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s", cfg.Storage.Backend)
+	}
+}
+
+// ValidateKey rejects keys that are empty, absolute or escape the store with ".." segments
+func ValidateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." ||
+		strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid blob key: %q", key)
+	}
+	return nil
+}
+
+// contentTypeOf guesses a blob's content type from the extension of its key
+func contentTypeOf(key string) string {
+	if contentType := mime.TypeByExtension(strings.ToLower(path.Ext(key))); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
@@ -4,16 +4,31 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	Upload   UploadConfig
-	Doubao   DoubaoConfig
-	Milvus   MilvusConfig
+	Database   DatabaseConfig
+	Server     ServerConfig
+	Upload     UploadConfig
+	Doubao     DoubaoConfig
+	Milvus     MilvusConfig
+	Attributes AttributesConfig
+	Tenancy    TenancyConfig
+	Auth       AuthConfig
+	JWT        JWTConfig
+	RateLimit  RateLimitConfig
+	Redis      RedisConfig
+	Trash      TrashConfig
+	Storage    StorageConfig
+	S3         S3Config
+	Duplicates DuplicateConfig
+	Preprocess PreprocessConfig
+	Thumbnail  ThumbnailConfig
+	Transform  TransformConfig
 }
 
 type DatabaseConfig struct {
@@ -29,8 +44,14 @@ type ServerConfig struct {
 }
 
 type UploadConfig struct {
-	Path       string
-	MaxSizeMB  int64
+	Path string
+	// MaxSizeMB limits each uploaded image file
+	MaxSizeMB int64
+	// MaxRequestSizeMB limits the whole body of upload and search requests
+	MaxRequestSizeMB int64
+	// MaxPixels limits width times height, summed over the frames of a GIF, rejecting
+	// decompression bombs before they are decoded
+	MaxPixels  int64
 	AllowedExt map[string]bool
 }
 
@@ -40,6 +61,135 @@ type DoubaoConfig struct {
 	URL    string
 }
 
+type AttributesConfig struct {
+	// SchemaPath points to an optional JSON schema for record and image attributes
+	SchemaPath string
+}
+
+type TenancyConfig struct {
+	// Credentials maps bearer tokens to tenant names; when empty every request belongs to the default tenant
+	Credentials map[string]string
+}
+
+type AuthConfig struct {
+	// Required rejects requests without a credential; disable only for local development
+	Required bool
+}
+
+// JWTConfig configures bearer JWT validation for single sign-on. JWTs are accepted
+// when an HS256 secret, a JWKS URL or a key file is configured.
+type JWTConfig struct {
+	// HMACSecret verifies HS256 tokens
+	HMACSecret string
+	// JWKSURL serves the RS256 signing keys of the identity provider
+	JWKSURL string
+	// KeyFile holds RS256 keys as a JWKS document or a PEM public key
+	KeyFile  string
+	Issuer   string
+	Audience string
+	// TenantClaim and RolesClaim name the claims holding the tenant and roles; dots select nested claims
+	TenantClaim string
+	RolesClaim  string
+}
+
+// Enabled reports whether any JWT verification key is configured
+func (c JWTConfig) Enabled() bool {
+	return c.HMACSecret != "" || c.JWKSURL != "" || c.KeyFile != ""
+}
+
+type RateLimitConfig struct {
+	// Backend stores token buckets in "memory" (per replica) or "redis" (shared by replicas)
+	Backend string
+	// Limits maps route classes to limits such as "100/m"
+	Limits map[string]string
+	// IP limits every request per client IP before authentication, so failed attempts count too
+	IP string
+}
+
+type RedisConfig struct {
+	Host     string
+	Port     string
+	Password string
+}
+
+type TrashConfig struct {
+	// Retention is how long deleted records and images stay restorable before they are purged
+	Retention time.Duration
+	// PurgeInterval is how often expired trash is purged
+	PurgeInterval time.Duration
+}
+
+type StorageConfig struct {
+	// Backend keeps image files in "local" (under the upload path) or "s3" (a bucket shared by replicas)
+	Backend string
+}
+
+// S3Config locates the bucket of an S3-compatible object store such as MinIO
+type S3Config struct {
+	// Endpoint is the host and port of the store, without a scheme
+	Endpoint  string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+}
+
+// DuplicateConfig controls duplicate detection at upload time
+type DuplicateConfig struct {
+	// Policy is the default handling of duplicate uploads: "allow", "link" or "reject"
+	Policy string
+	// MaxHashDistance is the largest perceptual hash Hamming distance (of 64 bits) of a near duplicate
+	MaxHashDistance int
+	// MinSimilarity is the smallest embedding cosine similarity of a near duplicate
+	MinSimilarity float64
+	// Candidates is the number of nearest neighbours checked for near duplicates
+	Candidates int
+}
+
+// PreprocessConfig controls how images are normalized before they are embedded. Corpus and query
+// images go through the same steps.
+type PreprocessConfig struct {
+	// Enabled re-encodes images before embedding; when false the original file is embedded
+	Enabled bool
+	// MaxEdge is the longest side images are downscaled to; zero keeps their size
+	MaxEdge int
+	// Format is the format images are converted to: "jpeg" or "png"
+	Format string
+	// Quality is the JPEG quality, 1 to 100
+	Quality int
+	// Fit makes images square: "none", "crop" (center crop) or "pad" (letterbox)
+	Fit string
+	// MaxFrames is the number of key frames sampled from an animated image, each embedded as its own vector
+	MaxFrames int
+}
+
+// ThumbnailConfig controls the downscaled JPEG renditions served as image previews
+type ThumbnailConfig struct {
+	// Sizes maps the named preview sizes, small, medium and large, to their width in pixels
+	Sizes map[string]int
+	// MaxWidth is the widest rendition a request can ask for
+	MaxWidth int
+	// Quality is the JPEG quality, 1 to 100
+	Quality int
+	// CacheMaxAge is how long clients may cache previews
+	CacheMaxAge time.Duration
+}
+
+// TransformConfig bounds the on-the-fly image transformation endpoint and its disk cache
+type TransformConfig struct {
+	// MaxEdge is the largest width or height of a transformed image
+	MaxEdge int
+	// Quality is the JPEG quality used when a request names none, 1 to 100
+	Quality int
+	// CacheDir holds transformed images; empty disables the cache
+	CacheDir string
+	// CacheMaxMB bounds the size of the cache, evicting the least recently used images past it
+	CacheMaxMB int64
+	// CacheMaxAge is how long clients may cache transformed images
+	CacheMaxAge time.Duration
+}
+
 type MilvusConfig struct {
 	Host     string
 	Port     string
@@ -64,13 +214,19 @@ func Load() *Config {
 			Port: getEnv("SERVER_PORT", "8080"),
 		},
 		Upload: UploadConfig{
-			Path:      getEnv("UPLOAD_PATH", "./uploads"),
-			MaxSizeMB: int64(getEnvInt("MAX_UPLOAD_SIZE_MB", 10)),
+			Path:             getEnv("UPLOAD_PATH", "./uploads"),
+			MaxSizeMB:        int64(getEnvInt("MAX_UPLOAD_SIZE_MB", 10)),
+			MaxRequestSizeMB: int64(getEnvInt("MAX_REQUEST_SIZE_MB", 50)),
+			MaxPixels:        int64(getEnvInt("MAX_IMAGE_PIXELS", 50000000)),
 			AllowedExt: map[string]bool{
 				".jpg":  true,
 				".jpeg": true,
 				".png":  true,
 				".webp": true,
+				".gif":  true,
+				".bmp":  true,
+				".tif":  true,
+				".tiff": true,
 			},
 		},
 		Doubao: DoubaoConfig{
@@ -83,6 +239,86 @@ func Load() *Config {
 			Port:     getEnv("MILVUS_PORT", "19530"),
 			Database: getEnv("MILVUS_DATABASE", "image_rag"),
 		},
+		Attributes: AttributesConfig{
+			SchemaPath: getEnv("ATTRIBUTE_SCHEMA_PATH", ""),
+		},
+		Tenancy: TenancyConfig{
+			Credentials: parseTenantCredentials(getEnv("TENANT_CREDENTIALS", "")),
+		},
+		Auth: AuthConfig{
+			Required: getEnvBool("AUTH_REQUIRED", true),
+		},
+		JWT: JWTConfig{
+			HMACSecret:  getEnv("JWT_HMAC_SECRET", ""),
+			JWKSURL:     getEnv("JWT_JWKS_URL", ""),
+			KeyFile:     getEnv("JWT_KEY_FILE", ""),
+			Issuer:      getEnv("JWT_ISSUER", ""),
+			Audience:    getEnv("JWT_AUDIENCE", ""),
+			TenantClaim: getEnv("JWT_TENANT_CLAIM", "tenant"),
+			RolesClaim:  getEnv("JWT_ROLES_CLAIM", "roles"),
+		},
+		RateLimit: RateLimitConfig{
+			Backend: getEnv("RATE_LIMIT_BACKEND", "memory"),
+			IP:      getEnv("RATE_LIMIT_IP", "600/m"),
+			Limits: map[string]string{
+				"read":      getEnv("RATE_LIMIT_READ", "300/m"),
+				"write":     getEnv("RATE_LIMIT_WRITE", "60/m"),
+				"search":    getEnv("RATE_LIMIT_SEARCH", "60/m"),
+				"upload":    getEnv("RATE_LIMIT_UPLOAD", "20/m"),
+				"transform": getEnv("RATE_LIMIT_TRANSFORM", "60/m"),
+			},
+		},
+		Redis: RedisConfig{
+			Host:     getEnv("REDIS_HOST", "localhost"),
+			Port:     getEnv("REDIS_PORT", "6379"),
+			Password: getEnv("REDIS_PASSWORD", ""),
+		},
+		Trash: TrashConfig{
+			Retention:     getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+			PurgeInterval: getEnvDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		},
+		Duplicates: DuplicateConfig{
+			Policy:          getEnv("DUPLICATE_POLICY", "allow"),
+			MaxHashDistance: getEnvInt("DUPLICATE_MAX_HASH_DISTANCE", 8),
+			MinSimilarity:   getEnvFloat("DUPLICATE_MIN_SIMILARITY", 0.95),
+			Candidates:      getEnvInt("DUPLICATE_CANDIDATES", 10),
+		},
+		Preprocess: PreprocessConfig{
+			Enabled:   getEnvBool("PREPROCESS_ENABLED", true),
+			MaxEdge:   getEnvInt("PREPROCESS_MAX_EDGE", 1024),
+			Format:    getEnv("PREPROCESS_FORMAT", "jpeg"),
+			Quality:   getEnvInt("PREPROCESS_JPEG_QUALITY", 90),
+			Fit:       getEnv("PREPROCESS_FIT", "none"),
+			MaxFrames: getEnvInt("PREPROCESS_MAX_FRAMES", 4),
+		},
+		Thumbnail: ThumbnailConfig{
+			Sizes: map[string]int{
+				"small":  getEnvInt("THUMBNAIL_SMALL_WIDTH", 160),
+				"medium": getEnvInt("THUMBNAIL_MEDIUM_WIDTH", 320),
+				"large":  getEnvInt("THUMBNAIL_LARGE_WIDTH", 640),
+			},
+			MaxWidth:    getEnvInt("THUMBNAIL_MAX_WIDTH", 1920),
+			Quality:     getEnvInt("THUMBNAIL_JPEG_QUALITY", 80),
+			CacheMaxAge: getEnvDuration("THUMBNAIL_CACHE_MAX_AGE", 24*time.Hour),
+		},
+		Transform: TransformConfig{
+			MaxEdge:     getEnvInt("TRANSFORM_MAX_EDGE", 2048),
+			Quality:     getEnvInt("TRANSFORM_JPEG_QUALITY", 85),
+			CacheDir:    getEnv("TRANSFORM_CACHE_DIR", "./cache/transforms"),
+			CacheMaxMB:  int64(getEnvInt("TRANSFORM_CACHE_MAX_MB", 512)),
+			CacheMaxAge: getEnvDuration("TRANSFORM_CACHE_MAX_AGE", 24*time.Hour),
+		},
+		Storage: StorageConfig{
+			Backend: getEnv("STORAGE_BACKEND", "local"),
+		},
+		S3: S3Config{
+			Endpoint:  getEnv("S3_ENDPOINT", "localhost:9000"),
+			Bucket:    getEnv("S3_BUCKET", "image-rag"),
+			AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			SecretKey: getEnv("S3_SECRET_KEY", ""),
+			Region:    getEnv("S3_REGION", ""),
+			UseSSL:    getEnvBool("S3_USE_SSL", false),
+		},
 	}
 }
 
@@ -93,6 +329,46 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// parseTenantCredentials parses comma separated tenant:token pairs
+func parseTenantCredentials(value string) map[string]string {
+	credentials := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		tenant, token, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || tenant == "" || token == "" {
+			continue
+		}
+		credentials[token] = tenant
+	}
+	return credentials
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
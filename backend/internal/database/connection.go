@@ -15,6 +15,9 @@ import (
 
 var DB *gorm.DB
 
+// legacyUploadPrefix began the paths of images stored before the blob store
+const legacyUploadPrefix = "uploads/"
+
 func InitDB(cfg *config.Config) error {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
 		cfg.Database.User,
@@ -50,10 +53,40 @@ func InitDB(cfg *config.Config) error {
 }
 
 func migrate() error {
-	return DB.AutoMigrate(
+	if err := DB.AutoMigrate(
+		&models.Tenant{},
+		&models.Dataset{},
 		&models.Record{},
 		&models.Image{},
-	)
+		&models.Tag{},
+		&models.APIKey{},
+		&models.AuditEntry{},
+		&models.RecordVersion{},
+		&models.Blob{},
+		&models.DuplicateScan{},
+		&models.DuplicateScanCluster{},
+	); err != nil {
+		return err
+	}
+
+	// Names used to be globally unique; they are unique per tenant now
+	for _, legacy := range []struct {
+		model interface{}
+		index string
+	}{
+		{&models.Tag{}, "idx_tags_name"},
+		{&models.Dataset{}, "idx_datasets_name"},
+	} {
+		if DB.Migrator().HasIndex(legacy.model, legacy.index) {
+			if err := DB.Migrator().DropIndex(legacy.model, legacy.index); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Image paths used to include the hardcoded upload directory; they are blob store keys now
+	return DB.Unscoped().Model(&models.Image{}).Where("path LIKE ?", legacyUploadPrefix+"%").
+		UpdateColumn("path", gorm.Expr("SUBSTRING(path, ?)", len(legacyUploadPrefix)+1)).Error
 }
 
 func CloseDB() error {
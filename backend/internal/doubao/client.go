@@ -85,12 +85,17 @@ func (c *Client) GenerateEmbedding(imagePath string) ([]float32, error) {
 }
 
 func (c *Client) GenerateEmbeddingFromFile(file multipart.File, filename string) ([]float32, error) {
+	return c.GenerateEmbeddingFromReader(file, filename)
+}
+
+// GenerateEmbeddingFromReader embeds image data read from r; filename supplies the image format
+func (c *Client) GenerateEmbeddingFromReader(r io.Reader, filename string) ([]float32, error) {
 	if c.apiKey == "" {
 		return nil, fmt.Errorf("doubao api key is required")
 	}
 
 	// Read file content
-	fileContent, err := io.ReadAll(file)
+	fileContent, err := io.ReadAll(r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
@@ -208,7 +213,7 @@ func encodeImageToBase64(imagePath string) (string, error) {
 
 // getImageFormat determines the image format from file extension
 func getImageFormat(filename string) string {
-	ext := getFileExtension(filename)
+	ext := strings.ToLower(getFileExtension(filename))
 	switch ext {
 	case ".jpg", ".jpeg":
 		return "jpeg"
@@ -216,6 +221,12 @@ func getImageFormat(filename string) string {
 		return "png"
 	case ".webp":
 		return "webp"
+	case ".gif":
+		return "gif"
+	case ".bmp":
+		return "bmp"
+	case ".tif", ".tiff":
+		return "tiff"
 	default:
 		return "jpeg" // default fallback
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"image-rag-backend/internal/config"
@@ -12,15 +13,36 @@ import (
 	"github.com/milvus-io/milvus-sdk-go/v2/entity"
 )
 
+const (
+	// maxTags is the capacity of the tags array field
+	maxTags = 64
+	// maxTagLength is the maximum length of a single tag in the vector store
+	maxTagLength = 64
+)
+
 type Client struct {
 	client client.Client
 	cfg    *config.MilvusConfig
 	ctx    context.Context
+	// hasTags reports whether the collection schema carries the tags field;
+	// collections created before tags were introduced do not
+	hasTags bool
 }
 
 type VectorData struct {
 	VectorID string
 	Vector   []float32
+	Tags     []string
+	// Partition is the collection partition to store the vector in; empty means the default partition
+	Partition string
+}
+
+// SearchFilter restricts a similarity search
+type SearchFilter struct {
+	// Tags requires results to carry all of the given tags
+	Tags []string
+	// Partitions limits the search to the given partitions; empty searches the whole collection
+	Partitions []string
 }
 
 type SearchResult struct {
@@ -60,6 +82,16 @@ func (c *Client) CreateCollection() error {
 	}
 
 	if exists {
+		collection, err := c.client.DescribeCollection(ctx, "image_embeddings")
+		if err != nil {
+			return fmt.Errorf("failed to describe collection: %w", err)
+		}
+		for _, field := range collection.Schema.Fields {
+			if field.Name == "tags" {
+				c.hasTags = true
+			}
+		}
+
 		// Collection already exists, ensure it's loaded
 		return c.LoadCollection()
 	}
@@ -89,6 +121,12 @@ func (c *Client) CreateCollection() error {
 					entity.TypeParamDim: "1024",
 				},
 			},
+			entity.NewField().
+				WithName("tags").
+				WithDataType(entity.FieldTypeArray).
+				WithElementType(entity.FieldTypeVarChar).
+				WithMaxCapacity(maxTags).
+				WithMaxLength(maxTagLength),
 		},
 	}
 
@@ -107,24 +145,36 @@ func (c *Client) CreateCollection() error {
 		return fmt.Errorf("failed to create index: %w", err)
 	}
 
+	c.hasTags = true
+
 	// Load collection
 	return c.LoadCollection()
 }
 
-// InsertVector inserts a vector into the collection
-func (c *Client) InsertVector(imageID string, vector []float32) (int64, error) {
+// SupportsTags reports whether vectors carry filterable tags
+func (c *Client) SupportsTags() bool {
+	return c.hasTags
+}
+
+// InsertVector inserts a vector with its tags into the collection
+func (c *Client) InsertVector(data VectorData) (int64, error) {
 	ctx, cancel := context.WithTimeout(c.ctx, 3*time.Second)
 	defer cancel()
 
 	// Prepare data
-	ids := []string{imageID}
-	vectors := [][]float32{vector}
+	ids := []string{data.VectorID}
+	vectors := [][]float32{data.Vector}
 
 	// Insert data
-	columnID := entity.NewColumnVarChar("image_id", ids)
-	columnVector := entity.NewColumnFloatVector("embedding", 1024, vectors)
+	columns := []entity.Column{
+		entity.NewColumnVarChar("image_id", ids),
+		entity.NewColumnFloatVector("embedding", 1024, vectors),
+	}
+	if c.hasTags {
+		columns = append(columns, entity.NewColumnVarCharArray("tags", [][][]byte{tagsToBytes(data.Tags)}))
+	}
 
-	_, err := c.client.Insert(c.ctx, "image_embeddings", "", columnID, columnVector)
+	_, err := c.client.Insert(c.ctx, "image_embeddings", data.Partition, columns...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert vector: %w", err)
 	}
@@ -139,8 +189,8 @@ func (c *Client) InsertVector(imageID string, vector []float32) (int64, error) {
 	return 1, nil
 }
 
-// SearchSimilar searches for similar vectors
-func (c *Client) SearchSimilar(vector []float32, topK int) ([]SearchResult, error) {
+// SearchSimilar searches for similar vectors matching the filter
+func (c *Client) SearchSimilar(vector []float32, topK int, filter SearchFilter) ([]SearchResult, error) {
 	ctx, cancel := context.WithTimeout(c.ctx, 3*time.Second)
 	defer cancel()
 
@@ -154,12 +204,25 @@ func (c *Client) SearchSimilar(vector []float32, topK int) ([]SearchResult, erro
 		return nil, fmt.Errorf("failed to create search parameters: %w", err)
 	}
 
+	expr := ""
+	if len(filter.Tags) > 0 {
+		if !c.hasTags {
+			return nil, fmt.Errorf("tag filtering is unavailable: collection image_embeddings has no tags field")
+		}
+		expr = fmt.Sprintf("array_contains_all(tags, [%s])", quoteList(filter.Tags))
+	}
+
+	partitions := filter.Partitions
+	if partitions == nil {
+		partitions = []string{}
+	}
+
 	// Perform search
 	results, err := c.client.Search(
 		ctx,
 		"image_embeddings",
-		[]string{},
-		"",
+		partitions,
+		expr,
 		[]string{"image_id"},
 		[]entity.Vector{entity.FloatVector(vector)},
 		"embedding",
@@ -197,6 +260,91 @@ func (c *Client) SearchSimilar(vector []float32, topK int) ([]SearchResult, erro
 	return searchResults, nil
 }
 
+// GetVectors fetches the stored embeddings for the given image IDs
+func (c *Client) GetVectors(imageIDs []string) (map[string][]float32, error) {
+	vectors := make(map[string][]float32, len(imageIDs))
+	if len(imageIDs) == 0 {
+		return vectors, nil
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, 5*time.Second)
+	defer cancel()
+
+	expr := fmt.Sprintf("image_id in [%s]", quoteList(imageIDs))
+
+	resultSet, err := c.client.Query(ctx, "image_embeddings", []string{}, expr, []string{"image_id", "embedding"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vectors: %w", err)
+	}
+
+	idColumn, ok := resultSet.GetColumn("image_id").(*entity.ColumnVarChar)
+	if !ok {
+		return nil, fmt.Errorf("image_id column missing from query result")
+	}
+	vectorColumn, ok := resultSet.GetColumn("embedding").(*entity.ColumnFloatVector)
+	if !ok {
+		return nil, fmt.Errorf("embedding column missing from query result")
+	}
+
+	ids := idColumn.Data()
+	data := vectorColumn.Data()
+	for i := 0; i < len(ids) && i < len(data); i++ {
+		vectors[ids[i]] = data[i]
+	}
+
+	return vectors, nil
+}
+
+// ReplaceTags rewrites the tags stored alongside a vector in the given partition.
+// The collection uses auto-generated primary keys, so the entity is re-inserted; see MoveVector.
+func (c *Client) ReplaceTags(imageID string, tags []string, partition string) error {
+	if !c.hasTags {
+		return nil
+	}
+	return c.MoveVector(imageID, tags, partition)
+}
+
+// MoveVector re-inserts a vector with the given tags into another partition. Upsert cannot
+// target auto-generated primary keys, so the new entity is inserted before the old ones are
+// deleted by primary key: a failure at any step leaves at least one copy of the vector. When
+// the delete fails both copies remain, and retrying the move cleans them up.
+func (c *Client) MoveVector(imageID string, tags []string, partition string) error {
+	ctx, cancel := context.WithTimeout(c.ctx, 5*time.Second)
+	defer cancel()
+
+	expr := fmt.Sprintf("image_id == %s", strconv.Quote(imageID))
+	resultSet, err := c.client.Query(ctx, "image_embeddings", []string{}, expr, []string{"id", "embedding"})
+	if err != nil {
+		return fmt.Errorf("failed to query vector: %w", err)
+	}
+	pkColumn, ok := resultSet.GetColumn("id").(*entity.ColumnInt64)
+	if !ok {
+		return fmt.Errorf("id column missing from query result")
+	}
+	vectorColumn, ok := resultSet.GetColumn("embedding").(*entity.ColumnFloatVector)
+	if !ok {
+		return fmt.Errorf("embedding column missing from query result")
+	}
+	oldIDs := pkColumn.Data()
+	if len(oldIDs) == 0 || len(vectorColumn.Data()) == 0 {
+		return fmt.Errorf("vector not found: %s", imageID)
+	}
+
+	if _, err := c.InsertVector(VectorData{VectorID: imageID, Vector: vectorColumn.Data()[0], Tags: tags,
+		Partition: partition}); err != nil {
+		return err
+	}
+
+	ids := make([]string, len(oldIDs))
+	for i, id := range oldIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	if err := c.DeleteByExpr(fmt.Sprintf("id in [%s]", strings.Join(ids, ","))); err != nil {
+		return fmt.Errorf("vector %s was copied but its old copy was not deleted: %w", imageID, err)
+	}
+	return nil
+}
+
 // DeleteVector deletes a vector by image ID
 func (c *Client) DeleteVector(imageID string) error {
 	ctx, cancel := context.WithTimeout(c.ctx, 3*time.Second)
@@ -227,6 +375,24 @@ func (c *Client) GetVectorCount() (int64, error) {
 	return strconv.ParseInt(count, 10, 64)
 }
 
+// quoteList renders strings as a quoted, comma separated list for boolean expressions
+func quoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return strings.Join(quoted, ",")
+}
+
+// tagsToBytes converts tags to the byte slices expected by array columns
+func tagsToBytes(tags []string) [][]byte {
+	values := make([][]byte, len(tags))
+	for i, tag := range tags {
+		values[i] = []byte(tag)
+	}
+	return values
+}
+
 // Close closes the Milvus client connection
 func (c *Client) Close() error {
 	return c.client.Close()
@@ -279,6 +445,53 @@ func (c *Client) LoadCollection() error {
 	return lastErr
 }
 
+// CreatePartition creates a partition in the collection if it does not exist yet
+func (c *Client) CreatePartition(name string) error {
+	ctx, cancel := context.WithTimeout(c.ctx, 5*time.Second)
+	defer cancel()
+
+	exists, err := c.client.HasPartition(ctx, "image_embeddings", name)
+	if err != nil {
+		return fmt.Errorf("failed to check partition existence: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	if err := c.client.CreatePartition(ctx, "image_embeddings", name); err != nil {
+		return fmt.Errorf("failed to create partition: %w", err)
+	}
+
+	// Load the new partition so it is searchable alongside the loaded collection
+	if err := c.client.LoadPartitions(ctx, "image_embeddings", []string{name}, false); err != nil {
+		return fmt.Errorf("failed to load partition: %w", err)
+	}
+	return nil
+}
+
+// DropPartition drops a partition together with all of its vectors
+func (c *Client) DropPartition(name string) error {
+	ctx, cancel := context.WithTimeout(c.ctx, 10*time.Second)
+	defer cancel()
+
+	exists, err := c.client.HasPartition(ctx, "image_embeddings", name)
+	if err != nil {
+		return fmt.Errorf("failed to check partition existence: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	// A loaded partition has to be released before it can be dropped
+	if err := c.client.ReleasePartitions(ctx, "image_embeddings", []string{name}); err != nil {
+		return fmt.Errorf("failed to release partition: %w", err)
+	}
+	if err := c.client.DropPartition(ctx, "image_embeddings", name); err != nil {
+		return fmt.Errorf("failed to drop partition: %w", err)
+	}
+	return nil
+}
+
 // ReleaseCollection releases the collection from memory
 func (c *Client) ReleaseCollection() error {
 	ctx, cancel := context.WithTimeout(c.ctx, 3*time.Second)
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// API key scopes
+const (
+	ScopeRecordsRead  = "records:read"
+	ScopeRecordsWrite = "records:write"
+	ScopeSearch       = "search"
+	// ScopeAdmin grants every other scope and manages API keys and datasets
+	ScopeAdmin = "admin"
+)
+
+// AllScopes lists every scope an API key may carry
+var AllScopes = []string{ScopeRecordsRead, ScopeRecordsWrite, ScopeSearch, ScopeAdmin}
+
+// ScopeList is stored as a comma separated column
+type ScopeList []string
+
+// Value implements driver.Valuer
+func (s ScopeList) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+// Scan implements sql.Scanner
+func (s *ScopeList) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+	case []byte:
+		raw = string(v)
+	case string:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported scopes type: %T", value)
+	}
+
+	*s = nil
+	if raw != "" {
+		*s = strings.Split(raw, ",")
+	}
+	return nil
+}
+
+// APIKey is a hashed credential bound to a tenant and a set of scopes
+type APIKey struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	TenantID uint   `json:"tenant_id" gorm:"not null;index"`
+	Name     string `json:"name" gorm:"not null;size:100"`
+	// Prefix is the start of the key, kept in clear so keys can be told apart
+	Prefix  string    `json:"prefix" gorm:"not null;size:16"`
+	KeyHash string    `json:"-" gorm:"not null;size:64;uniqueIndex"`
+	Scopes  ScopeList `json:"scopes" gorm:"not null;size:255"`
+	// RateLimits overrides the default limit of route classes for this key
+	RateLimits RateLimits `json:"rate_limits,omitempty" gorm:"type:json"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// RateLimits maps route classes (read, write, search, upload) to limits such as "600/m"
+	RateLimits RateLimits `json:"rate_limits"`
+}
+
+// CreateAPIKeyResponse carries the plaintext key, which is only ever shown once
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// RateLimits maps route classes to rate limits such as "600/m", stored as a JSON column
+type RateLimits map[string]string
+
+// Value implements driver.Valuer
+func (r RateLimits) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(r)
+}
+
+// Scan implements sql.Scanner
+func (r *RateLimits) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported rate limits type: %T", value)
+	}
+
+	*r = nil
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, r)
+}
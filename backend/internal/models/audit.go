@@ -0,0 +1,76 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	// AuditActionRestore takes a record or image out of the trash
+	AuditActionRestore = "restore"
+	// AuditActionPurge permanently removes a record or image whose trash retention expired
+	AuditActionPurge = "purge"
+)
+
+// Audited entity types
+const (
+	AuditEntityRecord = "record"
+	AuditEntityImage  = "image"
+)
+
+// AuditChange holds the value of one field before and after a mutation
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditChanges maps field names to their changes, stored as a JSON column
+type AuditChanges map[string]AuditChange
+
+// Value implements driver.Valuer
+func (a AuditChanges) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+// Scan implements sql.Scanner
+func (a *AuditChanges) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported audit changes type: %T", value)
+	}
+
+	*a = nil
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, a)
+}
+
+// AuditEntry is one row of the append-only audit log
+type AuditEntry struct {
+	ID       uint `json:"id" gorm:"primaryKey"`
+	TenantID uint `json:"tenant_id" gorm:"not null;index:idx_audit_tenant_created"`
+	// Actor is the user, API key or tenant admin that performed the mutation
+	Actor      string       `json:"actor" gorm:"not null;size:191;index"`
+	Action     string       `json:"action" gorm:"not null;size:16"`
+	EntityType string       `json:"entity_type" gorm:"not null;size:32;index:idx_audit_entity"`
+	EntityID   uint         `json:"entity_id" gorm:"not null;index:idx_audit_entity"`
+	Changes    AuditChanges `json:"changes" gorm:"type:json"`
+	RequestID  string       `json:"request_id" gorm:"size:64;index"`
+	CreatedAt  time.Time    `json:"created_at" gorm:"index:idx_audit_tenant_created"`
+}
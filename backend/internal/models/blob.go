@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Blob is a content-addressed image file in the blob store. Every image of a tenant with
+// the same bytes shares one blob, which is deleted after the last image referencing it.
+type Blob struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	TenantID uint   `json:"tenant_id" gorm:"not null;uniqueIndex:idx_blobs_tenant_digest"`
+	Digest   string `json:"digest" gorm:"not null;size:64;uniqueIndex:idx_blobs_tenant_digest"`
+	// Path is the blob store key of the file
+	Path string `json:"path" gorm:"not null;size:500"`
+	Size int64  `json:"size" gorm:"not null"`
+	// RefCount is the number of images referencing the blob, trashed ones included. Zero marks a
+	// released blob whose file is about to be deleted.
+	RefCount  int       `json:"ref_count" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// Dataset partitions records and their vectors so separate catalogs do not mix in search results
+type Dataset struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	TenantID    uint   `json:"tenant_id" gorm:"not null;default:0;uniqueIndex:idx_datasets_tenant_name"`
+	Name        string `json:"name" gorm:"not null;size:64;uniqueIndex:idx_datasets_tenant_name"`
+	Description string `json:"description" gorm:"type:text"`
+	// PartitionName is the vector store partition holding the dataset's image vectors
+	PartitionName string    `json:"partition_name" gorm:"not null;size:100"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type DatasetCount struct {
+	Dataset
+	RecordCount int64 `json:"record_count"`
+	ImageCount  int64 `json:"image_count"`
+}
+
+type CreateDatasetRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+type UpdateDatasetRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Kinds of duplicate match
+const (
+	// DuplicateExact images have byte-identical files
+	DuplicateExact = "exact"
+	// DuplicateNear images look the same, e.g. resized or re-compressed copies
+	DuplicateNear = "near"
+)
+
+// PerceptualHash is a 64-bit image fingerprint. It is stored as a signed BIGINT and
+// rendered in JSON as 16 hex digits, since JSON numbers cannot hold every uint64.
+type PerceptualHash uint64
+
+// Value implements driver.Valuer
+func (h PerceptualHash) Value() (driver.Value, error) {
+	return int64(h), nil
+}
+
+// Scan implements sql.Scanner
+func (h *PerceptualHash) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case int64:
+		*h = PerceptualHash(v)
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return err
+		}
+		*h = PerceptualHash(n)
+	default:
+		return fmt.Errorf("unsupported perceptual hash type: %T", value)
+	}
+	return nil
+}
+
+func (h PerceptualHash) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%016x", uint64(h)))
+}
+
+func (h *PerceptualHash) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	n, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid perceptual hash: %s", s)
+	}
+	*h = PerceptualHash(n)
+	return nil
+}
+
+// DuplicateMatch is an existing image that an upload duplicates
+type DuplicateMatch struct {
+	ImageID  uint   `json:"image_id"`
+	RecordID uint   `json:"record_id"`
+	Kind     string `json:"kind"`
+	// DuplicateOf is the image the matched image is itself linked to, if any
+	DuplicateOf *uint `json:"duplicate_of,omitempty"`
+	// PHashDistance and DHashDistance are the Hamming distances between the perceptual hashes
+	PHashDistance *int `json:"phash_distance,omitempty"`
+	DHashDistance *int `json:"dhash_distance,omitempty"`
+	// Similarity is the cosine similarity of the embeddings; omitted for exact matches
+	Similarity float32 `json:"similarity,omitempty"`
+}
+
+// RejectedImage is an uploaded file that was not added because it duplicates existing images
+type RejectedImage struct {
+	Filename   string           `json:"filename"`
+	Duplicates []DuplicateMatch `json:"duplicates"`
+}
+
+// DuplicateCluster is a group of images that are copies of each other
+type DuplicateCluster struct {
+	// ID is the ID of the cluster's oldest image
+	ID     uint    `json:"id"`
+	Size   int     `json:"size"`
+	Images []Image `json:"images"`
+}
+
+// Duplicate scan statuses
+const (
+	ScanStatusRunning   = "running"
+	ScanStatusCompleted = "completed"
+	ScanStatusFailed    = "failed"
+)
+
+// Actions resolving a cluster of duplicates; both move every image but the keeper to the trash
+const (
+	// DuplicateActionDelete only trashes the duplicates
+	DuplicateActionDelete = "delete"
+	// DuplicateActionMerge also carries the duplicates' tags over to the keeper and
+	// trashes the records the duplicates leave without images
+	DuplicateActionMerge = "merge"
+)
+
+// DuplicateScan is a corpus-wide search for clusters of similar images, run in the background
+type DuplicateScan struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	TenantID uint   `json:"tenant_id" gorm:"not null;index"`
+	Status   string `json:"status" gorm:"not null;size:16"`
+	// Threshold is the smallest embedding cosine similarity linking two images into a cluster
+	Threshold float64 `json:"threshold"`
+	// Neighbors is the number of nearest neighbours compared with each image
+	Neighbors     int    `json:"neighbors"`
+	ImagesScanned int    `json:"images_scanned"`
+	ClusterCount  int    `json:"cluster_count"`
+	Error         string `json:"error,omitempty" gorm:"size:1000"`
+	// RequestedBy is the audit actor who started the scan
+	RequestedBy string     `json:"requested_by" gorm:"size:191"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// DuplicateScanCluster is a connected group of similar images found by a scan
+type DuplicateScanCluster struct {
+	ID       uint `json:"id" gorm:"primaryKey"`
+	TenantID uint `json:"tenant_id" gorm:"not null;index"`
+	ScanID   uint `json:"scan_id" gorm:"not null;index"`
+	Size     int  `json:"size"`
+	// KeeperImageID is the suggested image to keep: the largest file, then the oldest image
+	KeeperImageID uint   `json:"keeper_image_id"`
+	ImageIDs      IDList `json:"image_ids" gorm:"type:json"`
+	// Resolution is the action that resolved the cluster, empty while unresolved
+	Resolution string     `json:"resolution,omitempty" gorm:"size:16"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	// Images are the cluster's images that still exist, loaded for the report
+	Images []Image `json:"images,omitempty" gorm:"-"`
+}
+
+// StartDuplicateScanRequest overrides the configured scan parameters
+type StartDuplicateScanRequest struct {
+	Threshold float64 `json:"threshold"`
+	Neighbors int     `json:"neighbors"`
+}
+
+// ResolveDuplicatesRequest resolves clusters of a completed scan
+type ResolveDuplicatesRequest struct {
+	Action string `json:"action" binding:"required"`
+	// ClusterIDs selects the clusters to resolve; empty resolves every unresolved cluster
+	ClusterIDs []uint `json:"cluster_ids"`
+	// Keepers overrides the suggested keeper by cluster ID
+	Keepers map[uint]uint `json:"keepers"`
+}
+
+// SkippedCluster is a cluster a resolution left untouched
+type SkippedCluster struct {
+	ClusterID uint   `json:"cluster_id"`
+	Reason    string `json:"reason"`
+}
+
+type ResolveDuplicatesResponse struct {
+	Resolved       []uint           `json:"resolved"`
+	RemovedImages  []uint           `json:"removed_images"`
+	TrashedRecords []uint           `json:"trashed_records"`
+	Skipped        []SkippedCluster `json:"skipped"`
+}
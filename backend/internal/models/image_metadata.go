@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// ImageMetadata describes an image file; it is extracted on upload. Images uploaded before
+// metadata extraction have zero values.
+type ImageMetadata struct {
+	Width  int `json:"width" gorm:"not null;default:0;index"`
+	Height int `json:"height" gorm:"not null;default:0;index"`
+	// Size is the file size in bytes
+	Size int64 `json:"size" gorm:"not null;default:0"`
+	// MimeType is detected from the file content, not taken from the filename or request
+	MimeType string `json:"mime_type,omitempty" gorm:"size:64"`
+	// ColorMode is gray, rgb, rgba, cmyk or indexed
+	ColorMode string `json:"color_mode,omitempty" gorm:"size:16"`
+	// FrameCount is the number of frames of an animated GIF or WebP; zero for still images
+	FrameCount int `json:"frame_count,omitempty" gorm:"not null;default:0"`
+
+	// The remaining fields come from EXIF tags and are empty when the file has none
+	CameraMake  string     `json:"camera_make,omitempty" gorm:"size:128"`
+	CameraModel string     `json:"camera_model,omitempty" gorm:"size:128"`
+	CapturedAt  *time.Time `json:"captured_at,omitempty" gorm:"index"`
+	// GPSLatitude and GPSLongitude are in decimal degrees, negative south and west
+	GPSLatitude  *float64 `json:"gps_latitude,omitempty"`
+	GPSLongitude *float64 `json:"gps_longitude,omitempty"`
+	// Orientation is the EXIF orientation, 1 (upright) to 8
+	Orientation int `json:"orientation,omitempty" gorm:"not null;default:0"`
+}
@@ -0,0 +1,55 @@
+package models
+
+// User roles carried by SSO tokens
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// RoleScopes lists the scopes granted by each role
+var RoleScopes = map[string][]string{
+	RoleViewer: {ScopeRecordsRead, ScopeSearch},
+	RoleEditor: {ScopeRecordsRead, ScopeRecordsWrite, ScopeSearch},
+	RoleAdmin:  {ScopeAdmin},
+}
+
+// ScopesForRoles returns the scopes granted by a set of roles; unknown roles grant nothing
+func ScopesForRoles(roles []string) []string {
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, role := range roles {
+		for _, scope := range RoleScopes[role] {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Tenant *Tenant
+	// APIKeyID is zero for callers not authenticated by an API key
+	APIKeyID uint
+	// Subject, Name and Email identify a user signed in through SSO
+	Subject string
+	Name    string
+	Email   string
+	Roles   []string
+	Scopes  []string
+	// RateLimits overrides default rate limits per route class
+	RateLimits RateLimits
+}
+
+// HasScope reports whether the principal was granted a scope; admin implies every scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
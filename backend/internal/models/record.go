@@ -1,46 +1,135 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// Record visibilities
+const (
+	// VisibilityTenant records are visible to every user of the tenant
+	VisibilityTenant = "tenant"
+	// VisibilityPrivate records are visible to their owner and admins only
+	VisibilityPrivate = "private"
 )
 
 type Record struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	Name        string    `json:"name" gorm:"not null;size:255"`
-	Description string    `json:"description" gorm:"type:text"`
-	Images      []Image   `json:"images" gorm:"foreignKey:RecordID;constraint:OnDelete:CASCADE"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID        uint `json:"id" gorm:"primaryKey"`
+	TenantID  uint `json:"tenant_id" gorm:"not null;default:0;index"`
+	DatasetID uint `json:"dataset_id" gorm:"not null;default:0;index"`
+	// OwnerID identifies the user or API key that created the record; empty for records created before ownership
+	OwnerID     string     `json:"owner_id" gorm:"not null;default:'';size:191;index"`
+	Visibility  string     `json:"visibility" gorm:"not null;default:tenant;size:16"`
+	Name        string     `json:"name" gorm:"not null;size:255;index:idx_records_fulltext,class:FULLTEXT"`
+	Description string     `json:"description" gorm:"type:text;index:idx_records_fulltext,class:FULLTEXT"`
+	Attributes  Attributes `json:"attributes" gorm:"type:json"`
+	Images      []Image    `json:"images" gorm:"foreignKey:RecordID;constraint:OnDelete:CASCADE"`
+	Tags        []Tag      `json:"tags" gorm:"many2many:record_tags;constraint:OnDelete:CASCADE"`
+	// Versions is the record's change history, loaded through the versions endpoints only
+	Versions  []RecordVersion `json:"-" gorm:"foreignKey:RecordID;constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	// DeletedAt is set while the record is in the trash
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 type Image struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	RecordID  uint      `json:"record_id" gorm:"not null;index"`
-	Filename  string    `json:"filename" gorm:"not null;size:255"`
-	Path      string    `json:"path" gorm:"not null;size:500"`
-	VectorID  string    `json:"vector_id" gorm:"not null;size:100;index"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	TenantID   uint       `json:"tenant_id" gorm:"not null;default:0;index"`
+	RecordID   uint       `json:"record_id" gorm:"not null;index"`
+	Filename   string     `json:"filename" gorm:"not null;size:255"`
+	Path       string     `json:"path" gorm:"not null;size:500"`
+	VectorID   string     `json:"vector_id" gorm:"not null;size:100;index"`
+	Attributes Attributes `json:"attributes,omitempty" gorm:"type:json"`
+	Tags       []Tag      `json:"tags" gorm:"many2many:image_tags;constraint:OnDelete:CASCADE"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Digest is the SHA-256 of the file, naming the blob it shares with identical uploads;
+	// empty for images stored before deduplication, which own their file
+	Digest string `json:"digest,omitempty" gorm:"size:64;index"`
+	// PHash and DHash are perceptual hashes; nil when the file could not be decoded
+	PHash *PerceptualHash `json:"phash,omitempty" gorm:"type:bigint"`
+	DHash *PerceptualHash `json:"dhash,omitempty" gorm:"type:bigint"`
+	// DuplicateOf links an image uploaded with the link duplicate policy to the image it duplicates
+	DuplicateOf *uint `json:"duplicate_of,omitempty" gorm:"index"`
+	// Metadata is extracted from the file on upload
+	Metadata ImageMetadata `json:"metadata" gorm:"embedded"`
+	// EmbeddingTransform describes the preprocessing the file got before its vector was generated;
+	// empty when the file was embedded as uploaded
+	EmbeddingTransform string `json:"embedding_transform,omitempty" gorm:"not null;default:'';size:255"`
+	// KeyFrames is the number of frames of an animation embedded as vectors; the first frame's
+	// vector is VectorID and the others are named by FrameVectorID. Zero for still images.
+	KeyFrames int `json:"key_frames,omitempty" gorm:"not null;default:0"`
+	// Duplicates reports the existing images an upload duplicates; only set in upload responses
+	Duplicates []DuplicateMatch `json:"duplicates,omitempty" gorm:"-"`
+	// DeletedAt is set while the image is in the trash
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// VectorIDs lists the vectors of the image, one per key frame
+func (i *Image) VectorIDs() []string {
+	return ImageVectorIDs(i.VectorID, i.KeyFrames)
+}
+
+// ImageVectorIDs lists the vectors of an image stored under vectorID with the given number of key frames
+func ImageVectorIDs(vectorID string, keyFrames int) []string {
+	ids := []string{vectorID}
+	for frame := 1; frame < keyFrames; frame++ {
+		ids = append(ids, FrameVectorID(vectorID, frame))
+	}
+	return ids
+}
+
+// FrameVectorID names the vector of an animation's key frame; frame 0 is the image's own VectorID
+func FrameVectorID(vectorID string, frame int) string {
+	if frame == 0 {
+		return vectorID
+	}
+	return fmt.Sprintf("%s#%d", vectorID, frame)
+}
+
+// BaseVectorID returns the VectorID of the image a key frame vector belongs to
+func BaseVectorID(vectorID string) string {
+	if i := strings.IndexByte(vectorID, '#'); i != -1 {
+		return vectorID[:i]
+	}
+	return vectorID
 }
 
 type CreateRecordRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
+	Name        string     `json:"name" binding:"required"`
+	Description string     `json:"description"`
+	Attributes  Attributes `json:"attributes"`
+	Visibility  string     `json:"visibility"`
 }
 
 type UpdateRecordRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Attributes replaces the record's attributes when present
+	Attributes Attributes `json:"attributes"`
+	Visibility string     `json:"visibility"`
 }
 
 type RecordResponse struct {
 	ID          uint            `json:"id"`
+	DatasetID   uint            `json:"dataset_id"`
 	Name        string          `json:"name"`
 	Description string          `json:"description"`
+	Attributes  Attributes      `json:"attributes"`
 	Images      []ImageResponse `json:"images"`
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 }
 
+// CreateRecordResponse is the created record along with the uploads rejected as duplicates
+type CreateRecordResponse struct {
+	*Record
+	RejectedImages []RejectedImage `json:"rejected_images,omitempty"`
+}
+
 type ImageResponse struct {
 	ID       uint   `json:"id"`
 	Filename string `json:"filename"`
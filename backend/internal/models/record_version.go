@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// IDList is a list of row IDs stored as a JSON array
+type IDList []uint
+
+// Value implements driver.Valuer
+func (l IDList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan implements sql.Scanner
+func (l *IDList) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported ID list type: %T", value)
+	}
+
+	if len(data) == 0 {
+		*l = nil
+		return nil
+	}
+	return json.Unmarshal(data, l)
+}
+
+// RecordVersion is a snapshot of a record's fields and image set after a change
+type RecordVersion struct {
+	ID       uint `json:"id" gorm:"primaryKey"`
+	TenantID uint `json:"tenant_id" gorm:"not null;index"`
+	RecordID uint `json:"record_id" gorm:"not null;uniqueIndex:idx_record_versions_record_version"`
+	// Version numbers start at 1 and increase by one with every change to the record
+	Version     int        `json:"version" gorm:"not null;uniqueIndex:idx_record_versions_record_version"`
+	Name        string     `json:"name" gorm:"not null;size:255"`
+	Description string     `json:"description" gorm:"type:text"`
+	Visibility  string     `json:"visibility" gorm:"not null;size:16"`
+	Attributes  Attributes `json:"attributes" gorm:"type:json"`
+	// ImageIDs are the record's images at this version, in ascending order
+	ImageIDs  IDList    `json:"image_ids" gorm:"type:json"`
+	Actor     string    `json:"actor" gorm:"not null;size:191"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RecordVersionDiff describes how a record changed between two versions
+type RecordVersionDiff struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	// Changes holds the fields that differ, with their values at From and To
+	Changes       AuditChanges `json:"changes"`
+	ImagesAdded   []uint       `json:"images_added"`
+	ImagesRemoved []uint       `json:"images_removed"`
+}
+
+// RevertRecordResponse is the reverted record along with images that could not be re-attached
+type RevertRecordResponse struct {
+	Record *Record `json:"record"`
+	// Version is the new version created by the revert
+	Version int `json:"version"`
+	// MissingImages were purged from the trash and are gone for good
+	MissingImages []uint `json:"missing_images"`
+}
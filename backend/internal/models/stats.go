@@ -5,4 +5,7 @@ type DashboardStats struct {
 	TotalImages  int64 `json:"total_images"`
 	TodayRecords int64 `json:"today_records"`
 	TodayImages  int64 `json:"today_images"`
+	TotalTags    int64 `json:"total_tags"`
+	// TopTags lists the most used tags by record count
+	TopTags []TagCount `json:"top_tags"`
 }
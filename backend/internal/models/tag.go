@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TenantID  uint      `json:"tenant_id" gorm:"not null;default:0;uniqueIndex:idx_tags_tenant_name"`
+	Name      string    `json:"name" gorm:"not null;size:64;uniqueIndex:idx_tags_tenant_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TagCount struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	RecordCount int64  `json:"record_count"`
+	ImageCount  int64  `json:"image_count"`
+}
+
+type CreateTagRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type TagsRequest struct {
+	Tags []string `json:"tags" binding:"required,min=1"`
+}
+
+type BulkTagRequest struct {
+	Action    string   `json:"action" binding:"required,oneof=tag untag"`
+	Tags      []string `json:"tags" binding:"required,min=1"`
+	RecordIDs []uint   `json:"record_ids"`
+	ImageIDs  []uint   `json:"image_ids"`
+}
+
+// TagNames returns the names of the given tags
+func TagNames(tags []Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
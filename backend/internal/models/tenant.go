@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+// Tenant owns datasets, records, images and tags; no query crosses tenant boundaries
+type Tenant struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null;size:64;uniqueIndex"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// TrashedRecord is a deleted record that can still be restored
+type TrashedRecord struct {
+	Record
+	// PurgeAt is when the record is removed permanently; nil when the trash is kept forever
+	PurgeAt *time.Time `json:"purge_at"`
+}
+
+// TrashedImage is a deleted image that can still be restored
+type TrashedImage struct {
+	Image
+	PurgeAt *time.Time `json:"purge_at"`
+}
+
+type TrashResponse struct {
+	Records []TrashedRecord `json:"records"`
+	Images  []TrashedImage  `json:"images"`
+}
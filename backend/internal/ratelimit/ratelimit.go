@@ -0,0 +1,151 @@
+// Package ratelimit implements token-bucket rate limiting with pluggable bucket storage,
+// so replicas can share limits through Redis or keep them in process memory.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-rag-backend/internal/config"
+)
+
+// Route classes with separately configured limits
+const (
+	ClassRead      = "read"
+	ClassWrite     = "write"
+	ClassSearch    = "search"
+	ClassUpload    = "upload"
+	ClassTransform = "transform"
+)
+
+// Classes lists every route class
+var Classes = []string{ClassRead, ClassWrite, ClassSearch, ClassUpload, ClassTransform}
+
+// Limit is a token bucket holding Burst tokens that refills Burst tokens every Period
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+	// RetryAfter is how long until a token is available; zero when the request was allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps bucket state
+type Store interface {
+	// Take removes one token from the bucket under key, creating a full bucket when none exists
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	Close() error
+}
+
+// ParseLimit parses a limit such as "100/m", "20/30s" or "5000/h"
+func ParseLimit(spec string) (Limit, error) {
+	count, period, ok := strings.Cut(strings.TrimSpace(spec), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: expected <requests>/<period>", spec)
+	}
+
+	burst, err := strconv.Atoi(count)
+	if err != nil || burst < 1 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: requests must be a positive integer", spec)
+	}
+
+	// A bare unit such as "m" means one of it
+	if period != "" && strings.IndexFunc(period[:1], func(r rune) bool { return r >= '0' && r <= '9' }) == -1 {
+		period = "1" + period
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: invalid period", spec)
+	}
+
+	return Limit{Burst: burst, Period: duration}, nil
+}
+
+// ParseLimits parses limits keyed by route class, rejecting unknown classes
+func ParseLimits(specs map[string]string) (map[string]Limit, error) {
+	limits := make(map[string]Limit, len(specs))
+	for class, spec := range specs {
+		if !validClass(class) {
+			return nil, fmt.Errorf("invalid rate limit class: %s", class)
+		}
+		limit, err := ParseLimit(spec)
+		if err != nil {
+			return nil, err
+		}
+		limits[class] = limit
+	}
+	return limits, nil
+}
+
+func validClass(class string) bool {
+	for _, known := range Classes {
+		if class == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// ratePerSecond is the refill rate of the bucket
+func (l Limit) ratePerSecond() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// refill returns the tokens in a bucket after elapsed time, capped at the burst size
+func (l Limit) refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed > 0 {
+		tokens += elapsed.Seconds() * l.ratePerSecond()
+	}
+	return math.Min(tokens, float64(l.Burst))
+}
+
+// result describes a bucket left with tokens after a take
+func (l Limit) result(tokens float64, allowed bool) Result {
+	rate := l.ratePerSecond()
+	result := Result{
+		Allowed:    allowed,
+		Limit:      l.Burst,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: secondsDuration((float64(l.Burst) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = secondsDuration((1 - tokens) / rate)
+	}
+	return result
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// evictInterval is how often the memory store drops idle buckets
+const evictInterval = time.Minute
+
+// NewStore creates the bucket store selected by the configuration
+func NewStore(cfg *config.Config) (Store, error) {
+	switch cfg.RateLimit.Backend {
+	case "", "memory":
+		return NewMemoryStore(evictInterval), nil
+	case "redis":
+		return NewRedisStore(net.JoinHostPort(cfg.Redis.Host, cfg.Redis.Port), cfg.Redis.Password)
+	default:
+		return nil, fmt.Errorf("unsupported rate limit backend: %s", cfg.RateLimit.Backend)
+	}
+}
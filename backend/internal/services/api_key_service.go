@@ -0,0 +1,172 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"image-rag-backend/internal/database"
+	"image-rag-backend/internal/models"
+	"image-rag-backend/internal/ratelimit"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// apiKeyPrefix marks API keys so they are easy to recognise in logs and secret scanners
+	apiKeyPrefix = "irk_"
+	// apiKeyBytes is the amount of randomness in a key
+	apiKeyBytes = 24
+	// apiKeyDisplayLength is the number of leading key characters kept in clear
+	apiKeyDisplayLength = 12
+	// lastUsedResolution limits how often last_used_at is written for a busy key
+	lastUsedResolution = time.Minute
+)
+
+type APIKeyService struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyService() *APIKeyService {
+	return &APIKeyService{db: database.DB}
+}
+
+// NormalizeScopes validates and de-duplicates scope names
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool, len(scopes))
+	var normalized []string
+
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+
+		known := false
+		for _, valid := range models.AllScopes {
+			if scope == valid {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("invalid scope: %s", scope)
+		}
+
+		seen[scope] = true
+		normalized = append(normalized, scope)
+	}
+
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	return normalized, nil
+}
+
+// CreateKey issues a new API key and returns it with its plaintext secret, which is not stored
+func (s *APIKeyService) CreateKey(tenantID uint, name string, scopes []string, expiresAt *time.Time,
+	rateLimits models.RateLimits) (*models.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("key name is required")
+	}
+
+	scopes, err := NormalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("invalid expires_at: must be in the future")
+	}
+	if _, err := ratelimit.ParseLimits(rateLimits); err != nil {
+		return nil, "", err
+	}
+
+	buf := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(buf)
+
+	key := &models.APIKey{
+		TenantID:   tenantID,
+		Name:       name,
+		Prefix:     secret[:apiKeyDisplayLength],
+		KeyHash:    hashAPIKey(secret),
+		Scopes:     scopes,
+		ExpiresAt:  expiresAt,
+		RateLimits: rateLimits,
+	}
+	if err := s.db.Create(key).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+	return key, secret, nil
+}
+
+// ListKeys returns a tenant's API keys, newest first
+func (s *APIKeyService) ListKeys(tenantID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.db.Where("tenant_id = ?", tenantID).Order("id DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeKey disables an API key; revoked keys stay listed for auditing
+func (s *APIKeyService) RevokeKey(tenantID, id uint) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := s.db.Where("tenant_id = ?", tenantID).First(&key, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("API key not found")
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := s.db.Model(&key).Update("revoked_at", now).Error; err != nil {
+			return nil, fmt.Errorf("failed to revoke API key: %w", err)
+		}
+	}
+	return &key, nil
+}
+
+// Authenticate returns the active API key matching a plaintext secret
+func (s *APIKeyService) Authenticate(secret string) (*models.APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	var key models.APIKey
+	if err := s.db.Where("key_hash = ?", hashAPIKey(secret)).First(&key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("invalid credentials")
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("API key has been revoked")
+	}
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, fmt.Errorf("API key has expired")
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedResolution {
+		key.LastUsedAt = &now
+		s.db.Model(&key).Update("last_used_at", now)
+	}
+	return &key, nil
+}
+
+// hashAPIKey returns the hex SHA-256 digest stored for a key. Keys carry enough
+// randomness that a slow password hash is unnecessary.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Attribute types accepted in attribute schemas
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeInteger = "integer"
+	AttributeTypeBoolean = "boolean"
+	AttributeTypeURL     = "url"
+)
+
+// Attribute filter operators
+const (
+	AttributeOpEq  = "eq"
+	AttributeOpGte = "gte"
+	AttributeOpLte = "lte"
+)
+
+// attributeFilterPrefix marks query parameters that filter on attributes, e.g. attr.category=shoes
+const attributeFilterPrefix = "attr."
+
+var attributeKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,64}$`)
+
+// AttributeSpec describes one attribute in a deployment schema
+type AttributeSpec struct {
+	Type     string        `json:"type"`
+	Required bool          `json:"required"`
+	Enum     []interface{} `json:"enum,omitempty"`
+	Min      *float64      `json:"min,omitempty"`
+	Max      *float64      `json:"max,omitempty"`
+	Pattern  string        `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// EntitySchema is the attribute schema for one entity type
+type EntitySchema struct {
+	Attributes map[string]*AttributeSpec `json:"attributes"`
+	// AllowUnknown accepts attributes not listed in the schema
+	AllowUnknown bool `json:"allow_unknown"`
+}
+
+// AttributeSchema is the optional per-deployment schema for record and image attributes
+type AttributeSchema struct {
+	Record *EntitySchema `json:"record,omitempty"`
+	Image  *EntitySchema `json:"image,omitempty"`
+}
+
+// AttributeFilter matches one attribute against a value
+type AttributeFilter struct {
+	Key   string
+	Op    string
+	Value interface{}
+}
+
+// LoadAttributeSchema reads an attribute schema from a JSON file. An empty path disables validation.
+func LoadAttributeSchema(path string) (*AttributeSchema, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attribute schema: %w", err)
+	}
+
+	var schema AttributeSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse attribute schema: %w", err)
+	}
+
+	for _, entity := range []*EntitySchema{schema.Record, schema.Image} {
+		if entity == nil {
+			continue
+		}
+		for key, spec := range entity.Attributes {
+			if err := spec.compile(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &schema, nil
+}
+
+func (spec *AttributeSpec) compile(key string) error {
+	if !attributeKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid attribute name in schema: %s", key)
+	}
+
+	switch spec.Type {
+	case AttributeTypeString, AttributeTypeNumber, AttributeTypeInteger, AttributeTypeBoolean, AttributeTypeURL:
+	default:
+		return fmt.Errorf("attribute %s has unsupported type: %s", key, spec.Type)
+	}
+
+	if spec.Pattern != "" {
+		pattern, err := regexp.Compile(spec.Pattern)
+		if err != nil {
+			return fmt.Errorf("attribute %s has invalid pattern: %w", key, err)
+		}
+		spec.pattern = pattern
+	}
+	return nil
+}
+
+// ValidateRecordAttributes checks record attributes against the schema
+func (s *AttributeSchema) ValidateRecordAttributes(attrs models.Attributes) error {
+	if s == nil {
+		return validateAttributeKeys(attrs)
+	}
+	return s.Record.validate(attrs)
+}
+
+// ValidateImageAttributes checks image attributes against the schema
+func (s *AttributeSchema) ValidateImageAttributes(attrs models.Attributes) error {
+	if s == nil {
+		return validateAttributeKeys(attrs)
+	}
+	return s.Image.validate(attrs)
+}
+
+func (e *EntitySchema) validate(attrs models.Attributes) error {
+	if err := validateAttributeKeys(attrs); err != nil {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+
+	// Check keys in a stable order so errors are deterministic
+	keys := make([]string, 0, len(e.Attributes))
+	for key := range e.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		spec := e.Attributes[key]
+		value, ok := attrs[key]
+		if !ok || value == nil {
+			if spec.Required {
+				return fmt.Errorf("invalid attributes: %s is required", key)
+			}
+			continue
+		}
+		if err := spec.check(key, value); err != nil {
+			return err
+		}
+	}
+
+	if !e.AllowUnknown {
+		for key := range attrs {
+			if _, ok := e.Attributes[key]; !ok {
+				return fmt.Errorf("invalid attributes: unknown attribute %s", key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (spec *AttributeSpec) check(key string, value interface{}) error {
+	switch spec.Type {
+	case AttributeTypeString, AttributeTypeURL:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("invalid attributes: %s must be a string", key)
+		}
+		if spec.Type == AttributeTypeURL {
+			u, err := url.ParseRequestURI(str)
+			if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("invalid attributes: %s must be an http(s) URL", key)
+			}
+		}
+		if spec.pattern != nil && !spec.pattern.MatchString(str) {
+			return fmt.Errorf("invalid attributes: %s does not match %s", key, spec.Pattern)
+		}
+	case AttributeTypeNumber, AttributeTypeInteger:
+		num, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("invalid attributes: %s must be a number", key)
+		}
+		if spec.Type == AttributeTypeInteger && num != float64(int64(num)) {
+			return fmt.Errorf("invalid attributes: %s must be an integer", key)
+		}
+		if spec.Min != nil && num < *spec.Min {
+			return fmt.Errorf("invalid attributes: %s must be at least %v", key, *spec.Min)
+		}
+		if spec.Max != nil && num > *spec.Max {
+			return fmt.Errorf("invalid attributes: %s must be at most %v", key, *spec.Max)
+		}
+	case AttributeTypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("invalid attributes: %s must be a boolean", key)
+		}
+	}
+
+	if len(spec.Enum) > 0 {
+		for _, allowed := range spec.Enum {
+			if allowed == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid attributes: %s is not one of the allowed values", key)
+	}
+	return nil
+}
+
+// validateAttributeKeys rejects attribute names that cannot be used in filters
+func validateAttributeKeys(attrs models.Attributes) error {
+	for key := range attrs {
+		if !attributeKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid attributes: invalid attribute name %q", key)
+		}
+	}
+	return nil
+}
+
+// ParseAttributes decodes a JSON object of attributes, as sent in multipart forms
+func ParseAttributes(raw string) (models.Attributes, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var attrs models.Attributes
+	if err := json.Unmarshal([]byte(raw), &attrs); err != nil {
+		return nil, fmt.Errorf("invalid attributes: must be a JSON object")
+	}
+	return attrs, nil
+}
+
+// ParseAttributeFilters extracts attr.<key>[.gte|.lte]=value filters from query parameters
+func ParseAttributeFilters(query url.Values) ([]AttributeFilter, error) {
+	var filters []AttributeFilter
+
+	for param, values := range query {
+		if !strings.HasPrefix(param, attributeFilterPrefix) || len(values) == 0 {
+			continue
+		}
+
+		key := strings.TrimPrefix(param, attributeFilterPrefix)
+		op := AttributeOpEq
+		if idx := strings.LastIndex(key, "."); idx != -1 {
+			key, op = key[:idx], key[idx+1:]
+		}
+		if !attributeKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid attribute filter: %s", param)
+		}
+
+		filter := AttributeFilter{Key: key, Op: op, Value: parseFilterValue(values[0])}
+		switch op {
+		case AttributeOpEq:
+		case AttributeOpGte, AttributeOpLte:
+			if _, ok := filter.Value.(float64); !ok {
+				return nil, fmt.Errorf("invalid attribute filter: %s requires a number", param)
+			}
+		default:
+			return nil, fmt.Errorf("invalid attribute filter operator: %s", op)
+		}
+		filters = append(filters, filter)
+	}
+
+	// Map iteration order is random; keep filters deterministic
+	sort.Slice(filters, func(i, j int) bool {
+		if filters[i].Key != filters[j].Key {
+			return filters[i].Key < filters[j].Key
+		}
+		return filters[i].Op < filters[j].Op
+	})
+	return filters, nil
+}
+
+// parseFilterValue interprets a query value as a number or boolean when possible
+func parseFilterValue(raw string) interface{} {
+	if num, err := strconv.ParseFloat(raw, 64); err == nil {
+		return num
+	}
+	if b, err := strconv.ParseBool(raw); err == nil {
+		return b
+	}
+	return raw
+}
+
+// MatchAttributes reports whether attributes satisfy every filter
+func MatchAttributes(attrs models.Attributes, filters []AttributeFilter) bool {
+	for _, filter := range filters {
+		value, ok := attrs[filter.Key]
+		if !ok {
+			return false
+		}
+
+		switch filter.Op {
+		case AttributeOpGte, AttributeOpLte:
+			num, ok := value.(float64)
+			if !ok {
+				return false
+			}
+			bound := filter.Value.(float64)
+			if (filter.Op == AttributeOpGte && num < bound) || (filter.Op == AttributeOpLte && num > bound) {
+				return false
+			}
+		default:
+			if fmt.Sprint(value) != fmt.Sprint(filter.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// applyAttributeFilters adds JSON attribute conditions on the given column to a query
+func applyAttributeFilters(query *gorm.DB, column string, filters []AttributeFilter) *gorm.DB {
+	for _, filter := range filters {
+		path := fmt.Sprintf(`$."%s"`, filter.Key)
+		extract := fmt.Sprintf("JSON_EXTRACT(%s, ?)", column)
+
+		switch filter.Op {
+		case AttributeOpGte:
+			query = query.Where(fmt.Sprintf("CAST(%s AS DECIMAL(30,10)) >= ?", extract), path, filter.Value)
+		case AttributeOpLte:
+			query = query.Where(fmt.Sprintf("CAST(%s AS DECIMAL(30,10)) <= ?", extract), path, filter.Value)
+		default:
+			if num, ok := filter.Value.(float64); ok {
+				query = query.Where(fmt.Sprintf("CAST(%s AS DECIMAL(30,10)) = ?", extract), path, num)
+			} else {
+				query = query.Where(fmt.Sprintf("JSON_UNQUOTE(%s) = ?", extract), path, fmt.Sprint(filter.Value))
+			}
+		}
+	}
+	return query
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"image-rag-backend/internal/database"
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// auditExportBatchSize is the number of entries read per query while exporting
+const auditExportBatchSize = 500
+
+// AuditActor identifies who performed a mutation and the request it came from
+type AuditActor struct {
+	ID        string
+	RequestID string
+}
+
+// AuditListOptions filters audit entries
+type AuditListOptions struct {
+	// TenantID is required; the audit log never crosses tenants
+	TenantID   uint
+	Actor      string
+	Action     string
+	EntityType string
+	EntityID   uint
+	RequestID  string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+// AuditService reads the audit log; entries are written by the services performing mutations
+type AuditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService() *AuditService {
+	return &AuditService{db: database.DB}
+}
+
+// ListEntries returns matching audit entries, newest first, with the total match count
+func (s *AuditService) ListEntries(opts AuditListOptions) ([]models.AuditEntry, int64, error) {
+	query := applyAuditFilters(s.db.Model(&models.AuditEntry{}), opts)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	var entries []models.AuditEntry
+	if err := query.Order("id DESC").Limit(opts.Limit).Offset(opts.Offset).Find(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	return entries, total, nil
+}
+
+// Export writes every matching entry as one JSON object per line, oldest first
+func (s *AuditService) Export(opts AuditListOptions, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	var batch []models.AuditEntry
+
+	result := applyAuditFilters(s.db.Model(&models.AuditEntry{}), opts).
+		FindInBatches(&batch, auditExportBatchSize, func(tx *gorm.DB, _ int) error {
+			for _, entry := range batch {
+				if err := encoder.Encode(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to export audit entries: %w", result.Error)
+	}
+	return nil
+}
+
+func applyAuditFilters(query *gorm.DB, opts AuditListOptions) *gorm.DB {
+	query = query.Where("tenant_id = ?", opts.TenantID)
+	if opts.Actor != "" {
+		query = query.Where("actor = ?", opts.Actor)
+	}
+	if opts.Action != "" {
+		query = query.Where("action = ?", opts.Action)
+	}
+	if opts.EntityType != "" {
+		query = query.Where("entity_type = ?", opts.EntityType)
+	}
+	if opts.EntityID != 0 {
+		query = query.Where("entity_id = ?", opts.EntityID)
+	}
+	if opts.RequestID != "" {
+		query = query.Where("request_id = ?", opts.RequestID)
+	}
+	if opts.From != nil {
+		query = query.Where("created_at >= ?", *opts.From)
+	}
+	if opts.To != nil {
+		query = query.Where("created_at < ?", *opts.To)
+	}
+	return query
+}
+
+// writeAudit appends an audit entry inside the transaction of the mutation it describes.
+// before is nil for creations and after is nil for deletions.
+func writeAudit(tx *gorm.DB, actor AuditActor, tenantID uint, action, entityType string, entityID uint,
+	before, after map[string]interface{}) error {
+	entry := &models.AuditEntry{
+		TenantID:   tenantID,
+		Actor:      actor.ID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Changes:    diffSnapshots(before, after),
+		RequestID:  actor.RequestID,
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// diffSnapshots returns the fields whose values differ between two snapshots
+func diffSnapshots(before, after map[string]interface{}) models.AuditChanges {
+	changes := make(models.AuditChanges)
+	for field, value := range before {
+		if !reflect.DeepEqual(value, after[field]) {
+			changes[field] = models.AuditChange{Before: value, After: after[field]}
+		}
+	}
+	for field, value := range after {
+		if _, seen := before[field]; !seen {
+			changes[field] = models.AuditChange{After: value}
+		}
+	}
+	return changes
+}
+
+// recordSnapshot captures the audited fields of a record
+func recordSnapshot(record *models.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"dataset_id":  record.DatasetID,
+		"owner_id":    record.OwnerID,
+		"visibility":  record.Visibility,
+		"name":        record.Name,
+		"description": record.Description,
+		"attributes":  copyAttributes(record.Attributes),
+	}
+}
+
+// imageSnapshot captures the audited fields of an image
+func imageSnapshot(image *models.Image) map[string]interface{} {
+	return map[string]interface{}{
+		"record_id":  image.RecordID,
+		"filename":   image.Filename,
+		"path":       image.Path,
+		"vector_id":  image.VectorID,
+		"attributes": copyAttributes(image.Attributes),
+	}
+}
+
+// copyAttributes copies attributes so later in-place edits do not alter a snapshot
+func copyAttributes(attrs models.Attributes) models.Attributes {
+	if attrs == nil {
+		return nil
+	}
+	copied := make(models.Attributes, len(attrs))
+	for key, value := range attrs {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"image-rag-backend/internal/models"
+)
+
+// AuthService authenticates request credentials against API keys, SSO tokens and static tenant tokens
+type AuthService struct {
+	tenantService *TenantService
+	apiKeyService *APIKeyService
+	jwtService    *JWTService
+	// required rejects requests without credentials even in single-tenant deployments
+	required bool
+}
+
+func NewAuthService(tenantService *TenantService, apiKeyService *APIKeyService, jwtService *JWTService,
+	required bool) *AuthService {
+	return &AuthService{
+		tenantService: tenantService,
+		apiKeyService: apiKeyService,
+		jwtService:    jwtService,
+		required:      required,
+	}
+}
+
+// Authenticate resolves a credential to the calling principal. API keys carry their
+// own scopes, SSO users get the scopes of their roles, and static TENANT_CREDENTIALS tokens act as admin tokens for their tenant.
+// When authentication is not required, anonymous callers act as admin of the default tenant.
+func (s *AuthService) Authenticate(credential string) (*models.Principal, error) {
+	if credential == "" {
+		if s.required || s.tenantService.MultiTenant() {
+			return nil, fmt.Errorf("missing credentials")
+		}
+		return &models.Principal{
+			Tenant: s.tenantService.DefaultTenant(),
+			Scopes: []string{models.ScopeAdmin},
+		}, nil
+	}
+
+	if strings.HasPrefix(credential, apiKeyPrefix) {
+		key, err := s.apiKeyService.Authenticate(credential)
+		if err == nil {
+			tenant, err := s.tenantService.GetTenant(key.TenantID)
+			if err != nil {
+				return nil, err
+			}
+			return &models.Principal{Tenant: tenant, APIKeyID: key.ID, Scopes: key.Scopes, RateLimits: key.RateLimits}, nil
+		}
+		if !strings.Contains(err.Error(), "invalid credentials") {
+			return nil, err
+		}
+	}
+
+	if s.jwtService.Enabled() && LooksLikeJWT(credential) {
+		return s.authenticateJWT(credential)
+	}
+
+	tenant, err := s.tenantService.ResolveTenant(credential)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Principal{Tenant: tenant, Scopes: []string{models.ScopeAdmin}}, nil
+}
+
+// authenticateJWT maps a verified SSO token to a user of the tenant named in its tenant claim
+func (s *AuthService) authenticateJWT(token string) (*models.Principal, error) {
+	identity, err := s.jwtService.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant := s.tenantService.DefaultTenant()
+	if identity.Tenant != "" {
+		if tenant, err = s.tenantService.GetTenantByName(identity.Tenant); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				return nil, fmt.Errorf("invalid token: unknown tenant %s", identity.Tenant)
+			}
+			return nil, err
+		}
+	} else if s.tenantService.MultiTenant() {
+		return nil, fmt.Errorf("invalid token: missing tenant claim")
+	}
+
+	return &models.Principal{
+		Tenant:  tenant,
+		Subject: identity.Subject,
+		Name:    identity.Name,
+		Email:   identity.Email,
+		Roles:   identity.Roles,
+		Scopes:  models.ScopesForRoles(identity.Roles),
+	}, nil
+}
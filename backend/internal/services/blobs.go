@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"image-rag-backend/internal/blobstore"
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StoredImage is an uploaded image file in the blob store holding one reference on its blob.
+// The reference passes to the image created by AddImageToRecord or is dropped by ReleaseImageFile.
+type StoredImage struct {
+	TenantID uint
+	Key      string
+	Filename string
+	Digest   string
+	Size     int64
+	// PHash and DHash are the perceptual hashes; nil when the file could not be decoded
+	PHash *models.PerceptualHash
+	DHash *models.PerceptualHash
+	// Metadata holds the dimensions, content type and EXIF tags read from the file
+	Metadata models.ImageMetadata
+	// EmbeddingTransform is the preprocessing behind the upload's vector, set once it is generated
+	EmbeddingTransform string
+	// KeyFrames is the number of key frame vectors of an animated upload; zero for still images
+	KeyFrames int
+	// DuplicateOf is the image the upload is linked to under the link duplicate policy
+	DuplicateOf *uint
+}
+
+// releasedBlob is a blob that lost its last reference; its file is deleted once the transaction commits
+type releasedBlob struct {
+	tenantID uint
+	digest   string
+	path     string
+}
+
+// hashFile returns the hex SHA-256 digest of r's content and rewinds r
+func hashFile(r io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to rewind file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// acquireBlob takes a reference on the tenant's blob with a digest, creating the blob under path
+// when none exists. Callers store the file under path first. It reports whether the blob is new or
+// revived after its last release, in which case its file may be gone. Taking the reference waits
+// for a deleteReleasedFiles holding the blob's row lock.
+func acquireBlob(tx *gorm.DB, tenantID uint, digest, path string, size int64) (*models.Blob, bool, error) {
+	blob := models.Blob{TenantID: tenantID, Digest: digest, Path: path, Size: size, RefCount: 1}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "digest"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"ref_count": gorm.Expr("ref_count + 1")}),
+	}).Create(&blob).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to reference blob: %w", err)
+	}
+
+	var current models.Blob
+	if err := tx.Where("tenant_id = ? AND digest = ?", tenantID, digest).First(&current).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to get blob: %w", err)
+	}
+	// A count of one is the reference just taken, on a new blob or a released one
+	return &current, current.RefCount == 1, nil
+}
+
+// releaseBlob drops an image's reference on its blob. The last reference leaves the row with a
+// count of zero, for deleteReleasedFiles to lock while it deletes the file.
+// Images stored before deduplication have no digest and release their own file.
+func releaseBlob(tx *gorm.DB, tenantID uint, digest, path string) (*releasedBlob, error) {
+	if digest == "" {
+		return &releasedBlob{tenantID: tenantID, path: path}, nil
+	}
+
+	var blob models.Blob
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("tenant_id = ? AND digest = ?", tenantID, digest).First(&blob).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+
+	if blob.RefCount > 1 {
+		if err := tx.Model(&blob).UpdateColumn("ref_count", gorm.Expr("ref_count - 1")).Error; err != nil {
+			return nil, fmt.Errorf("failed to release blob: %w", err)
+		}
+		return nil, nil
+	}
+	if err := tx.Model(&blob).UpdateColumn("ref_count", 0).Error; err != nil {
+		return nil, fmt.Errorf("failed to release blob: %w", err)
+	}
+	return &releasedBlob{tenantID: tenantID, digest: digest, path: blob.Path}, nil
+}
+
+// deleteReleasedFiles deletes the files and rows of released blobs, skipping any that an upload
+// referenced again after the release committed. The row stays locked until its file is gone,
+// so an upload of the same bytes waits for the deletion and then stores the file again.
+func deleteReleasedFiles(db *gorm.DB, blobs blobstore.Store, released []*releasedBlob) {
+	for _, blob := range released {
+		if blob == nil {
+			continue
+		}
+		if blob.digest == "" {
+			if err := blobs.Delete(context.Background(), blob.path); err != nil {
+				fmt.Printf("Warning: failed to delete file %s: %v\n", blob.path, err)
+			}
+			deleteThumbnailFiles(blobs, blob.path)
+			continue
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			var current models.Blob
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("tenant_id = ? AND digest = ?", blob.tenantID, blob.digest).First(&current).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return nil
+				}
+				return fmt.Errorf("failed to get blob: %w", err)
+			}
+			if current.RefCount > 0 {
+				return nil
+			}
+			// The row outlives a failed delete, so a later upload of the bytes still stores them again
+			if err := blobs.Delete(context.Background(), current.Path); err != nil {
+				return err
+			}
+			deleteThumbnailFiles(blobs, current.Path)
+			return tx.Delete(&current).Error
+		}); err != nil {
+			fmt.Printf("Warning: failed to delete file %s: %v\n", blob.path, err)
+		}
+	}
+}
+
+// deleteThumbnailFiles deletes the thumbnails of an image file, logging failures
+func deleteThumbnailFiles(blobs blobstore.Store, key string) {
+	if err := deleteThumbnails(context.Background(), blobs, key); err != nil {
+		fmt.Printf("Warning: failed to delete thumbnails of %s: %v\n", key, err)
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"image-rag-backend/internal/blobstore"
+	"image-rag-backend/internal/database"
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultDatasetName is used when a request does not name a dataset
+	DefaultDatasetName = "default"
+	// defaultPartitionName is the vector store partition that existed before datasets
+	defaultPartitionName = "_default"
+)
+
+var datasetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type DatasetService struct {
+	db            *gorm.DB
+	vectorService *VectorService
+	blobs         blobstore.Store
+}
+
+func NewDatasetService(vectorService *VectorService, blobs blobstore.Store) *DatasetService {
+	return &DatasetService{db: database.DB, vectorService: vectorService, blobs: blobs}
+}
+
+// EnsureDefaultDataset creates a tenant's default dataset and assigns records created before datasets existed to it
+func (s *DatasetService) EnsureDefaultDataset(tenant *models.Tenant) (*models.Dataset, error) {
+	dataset, err := s.ResolveDataset(tenant.ID, DefaultDatasetName)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		return nil, err
+	}
+
+	if dataset == nil {
+		if tenant.Name == DefaultTenantName {
+			// Vectors stored before datasets existed live in the collection's default partition
+			dataset = &models.Dataset{TenantID: tenant.ID, Name: DefaultDatasetName, PartitionName: defaultPartitionName}
+			if err := s.db.Create(dataset).Error; err != nil {
+				return nil, fmt.Errorf("failed to create default dataset: %w", err)
+			}
+		} else if dataset, err = s.CreateDataset(tenant.ID, DefaultDatasetName, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.db.Model(&models.Record{}).Where("tenant_id = ? AND dataset_id = 0", tenant.ID).
+		Update("dataset_id", dataset.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to assign records to default dataset: %w", err)
+	}
+	return dataset, nil
+}
+
+// ValidateDatasetName checks that a dataset name is a lowercase slug
+func ValidateDatasetName(name string) error {
+	if !datasetNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid dataset name: must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	return nil
+}
+
+// ListDatasets returns every dataset of a tenant with its record and image counts, leaving out the trash
+func (s *DatasetService) ListDatasets(tenantID uint) ([]models.DatasetCount, error) {
+	var datasets []models.DatasetCount
+	if err := s.db.Raw(`SELECT d.*,
+			(SELECT COUNT(*) FROM records r WHERE r.dataset_id = d.id AND r.deleted_at IS NULL) AS record_count,
+			(SELECT COUNT(*) FROM images i JOIN records r ON r.id = i.record_id
+				WHERE r.dataset_id = d.id AND i.deleted_at IS NULL AND r.deleted_at IS NULL) AS image_count
+		FROM datasets d WHERE d.tenant_id = ? ORDER BY d.name`, tenantID).Scan(&datasets).Error; err != nil {
+		return nil, fmt.Errorf("failed to list datasets: %w", err)
+	}
+	return datasets, nil
+}
+
+func (s *DatasetService) GetDataset(tenantID, id uint) (*models.Dataset, error) {
+	var dataset models.Dataset
+	if err := s.db.Where("tenant_id = ?", tenantID).First(&dataset, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("dataset not found")
+		}
+		return nil, fmt.Errorf("failed to get dataset: %w", err)
+	}
+	return &dataset, nil
+}
+
+// ResolveDataset looks a dataset up by name, falling back to the default dataset when name is empty
+func (s *DatasetService) ResolveDataset(tenantID uint, name string) (*models.Dataset, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DefaultDatasetName
+	}
+
+	var dataset models.Dataset
+	if err := s.db.Where("tenant_id = ? AND name = ?", tenantID, name).First(&dataset).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("dataset not found: %s", name)
+		}
+		return nil, fmt.Errorf("failed to get dataset: %w", err)
+	}
+	return &dataset, nil
+}
+
+// CreateDataset creates a dataset together with its vector store partition
+func (s *DatasetService) CreateDataset(tenantID uint, name, description string) (*models.Dataset, error) {
+	name = strings.TrimSpace(name)
+	if err := ValidateDatasetName(name); err != nil {
+		return nil, err
+	}
+	if err := s.checkNameAvailable(tenantID, name, 0); err != nil {
+		return nil, err
+	}
+
+	dataset := &models.Dataset{TenantID: tenantID, Name: name, Description: description}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dataset).Error; err != nil {
+			return fmt.Errorf("failed to create dataset: %w", err)
+		}
+
+		// Partitions are keyed by ID so renaming a dataset never touches the vector store
+		dataset.PartitionName = fmt.Sprintf("tenant_%d_dataset_%d", tenantID, dataset.ID)
+		if err := tx.Model(dataset).Update("partition_name", dataset.PartitionName).Error; err != nil {
+			return fmt.Errorf("failed to create dataset: %w", err)
+		}
+
+		return s.vectorService.CreatePartition(dataset.PartitionName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dataset, nil
+}
+
+// UpdateDataset renames a dataset or changes its description
+func (s *DatasetService) UpdateDataset(tenantID, id uint, name, description string) (*models.Dataset, error) {
+	dataset, err := s.GetDataset(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if name = strings.TrimSpace(name); name != "" && name != dataset.Name {
+		if dataset.Name == DefaultDatasetName {
+			return nil, fmt.Errorf("default dataset cannot be renamed")
+		}
+		if err := ValidateDatasetName(name); err != nil {
+			return nil, err
+		}
+		if err := s.checkNameAvailable(tenantID, name, id); err != nil {
+			return nil, err
+		}
+		dataset.Name = name
+	}
+	if description != "" {
+		dataset.Description = description
+	}
+
+	if err := s.db.Save(dataset).Error; err != nil {
+		return nil, fmt.Errorf("failed to update dataset: %w", err)
+	}
+	return dataset, nil
+}
+
+// DeleteDataset permanently deletes a dataset with all of its records, images and vectors, including trashed ones
+func (s *DatasetService) DeleteDataset(tenantID, id uint) error {
+	dataset, err := s.GetDataset(tenantID, id)
+	if err != nil {
+		return err
+	}
+	if dataset.Name == DefaultDatasetName {
+		return fmt.Errorf("default dataset cannot be deleted")
+	}
+
+	var images []models.Image
+	if err := s.db.Unscoped().Select("images.id", "images.digest", "images.path").
+		Joins("JOIN records ON records.id = images.record_id").
+		Where("records.dataset_id = ?", id).
+		Find(&images).Error; err != nil {
+		return fmt.Errorf("failed to get dataset images: %w", err)
+	}
+
+	// Vectors of trashed images live in the trash partition rather than the dataset's
+	var trashed []models.Image
+	if err := s.db.Unscoped().Select("images.vector_id", "images.key_frames").
+		Joins("JOIN records ON records.id = images.record_id").
+		Where("records.dataset_id = ? AND (images.deleted_at IS NOT NULL OR records.deleted_at IS NOT NULL)", id).
+		Find(&trashed).Error; err != nil {
+		return fmt.Errorf("failed to get trashed dataset images: %w", err)
+	}
+	for _, image := range trashed {
+		for _, vectorID := range image.VectorIDs() {
+			if err := s.vectorService.DeleteVector(vectorID); err != nil {
+				return fmt.Errorf("failed to delete vector %s: %w", vectorID, err)
+			}
+		}
+	}
+
+	if err := s.vectorService.DropPartition(dataset.PartitionName); err != nil {
+		return err
+	}
+
+	// Images elsewhere may share the blobs of this dataset's images, so each drops its reference
+	var released []*releasedBlob
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, image := range images {
+			blob, err := releaseBlob(tx, tenantID, image.Digest, image.Path)
+			if err != nil {
+				return err
+			}
+			released = append(released, blob)
+		}
+		if err := tx.Unscoped().Where("dataset_id = ?", id).Delete(&models.Record{}).Error; err != nil {
+			return fmt.Errorf("failed to delete dataset records: %w", err)
+		}
+		if err := tx.Delete(&models.Dataset{}, id).Error; err != nil {
+			return fmt.Errorf("failed to delete dataset: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	deleteReleasedFiles(s.db, s.blobs, released)
+	return nil
+}
+
+func (s *DatasetService) checkNameAvailable(tenantID uint, name string, exceptID uint) error {
+	var count int64
+	if err := s.db.Model(&models.Dataset{}).Where("tenant_id = ? AND name = ? AND id <> ?", tenantID, name, exceptID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check dataset name: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("dataset already exists: %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"fmt"
+)
+
+const (
+	// mmrCandidateFactor controls how many candidates are over-fetched per requested result
+	mmrCandidateFactor = 4
+	// mmrMaxCandidates caps the over-fetched candidate set
+	mmrMaxCandidates = 400
+)
+
+// ValidateDiversity validates a diversity weight in the range [0, 1]
+func ValidateDiversity(diversity float64) error {
+	if diversity < 0 || diversity > 1 {
+		return fmt.Errorf("diversity must be between 0 and 1, got %v", diversity)
+	}
+	return nil
+}
+
+// CandidatePoolSize returns the number of candidates to over-fetch when results are re-ranked or post-filtered
+func CandidatePoolSize(topK int) int {
+	size := topK * mmrCandidateFactor
+	if size > mmrMaxCandidates {
+		size = mmrMaxCandidates
+	}
+	if size < topK {
+		size = topK
+	}
+	return size
+}
+
+// rerankMMR reorders candidates using maximal marginal relevance.
+// diversity 0 keeps the pure relevance order, diversity 1 maximises dissimilarity
+// between selected results. Candidates without a stored vector are dropped.
+func rerankMMR(query []float32, candidates []SearchResult, vectors map[string][]float32, topK int, diversity float64) []SearchResult {
+	lambda := 1 - diversity
+
+	type scored struct {
+		result    SearchResult
+		vector    []float32
+		relevance float64
+	}
+
+	pool := make([]scored, 0, len(candidates))
+	for _, candidate := range candidates {
+		vector, ok := vectors[candidate.ImageID]
+		if !ok {
+			continue
+		}
+		pool = append(pool, scored{
+			result:    candidate,
+			vector:    vector,
+			relevance: float64(CalculateSimilarity(query, vector)),
+		})
+	}
+
+	selected := make([]SearchResult, 0, topK)
+	selectedVectors := make([][]float32, 0, topK)
+
+	for len(selected) < topK && len(pool) > 0 {
+		bestIndex := 0
+		bestScore := 0.0
+
+		for i, candidate := range pool {
+			// Redundancy is the highest similarity to anything already selected
+			redundancy := 0.0
+			for _, vector := range selectedVectors {
+				if sim := float64(CalculateSimilarity(candidate.vector, vector)); sim > redundancy {
+					redundancy = sim
+				}
+			}
+
+			score := lambda*candidate.relevance - (1-lambda)*redundancy
+			if i == 0 || score > bestScore {
+				bestIndex = i
+				bestScore = score
+			}
+		}
+
+		best := pool[bestIndex]
+		selected = append(selected, best.result)
+		selectedVectors = append(selectedVectors, best.vector)
+		pool = append(pool[:bestIndex], pool[bestIndex+1:]...)
+	}
+
+	return selected
+}
@@ -0,0 +1,555 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// duplicateScanBatchSize is the number of images whose neighbours are searched per round
+const duplicateScanBatchSize = 100
+
+// maxScanNeighbors bounds the neighbours compared with each image during a scan
+const maxScanNeighbors = 100
+
+// scanImage is the part of an image a duplicate scan needs
+type scanImage struct {
+	ID       uint
+	VectorID string
+	Digest   string
+}
+
+// StartScan starts a background scan of the tenant's live images for clusters of duplicates.
+// Only one scan per tenant runs at a time.
+func (s *DuplicateService) StartScan(actor AuditActor, tenantID uint, req models.StartDuplicateScanRequest) (
+	*models.DuplicateScan, error) {
+	threshold := req.Threshold
+	if threshold == 0 {
+		threshold = s.config.MinSimilarity
+	}
+	if threshold <= 0 || threshold > 1 {
+		return nil, fmt.Errorf("invalid scan: threshold must be greater than 0 and at most 1")
+	}
+	neighbors := req.Neighbors
+	if neighbors == 0 {
+		neighbors = s.config.Candidates
+	}
+	if neighbors < 1 || neighbors > maxScanNeighbors {
+		return nil, fmt.Errorf("invalid scan: neighbors must be between 1 and %d", maxScanNeighbors)
+	}
+
+	var running int64
+	if err := s.db.Model(&models.DuplicateScan{}).
+		Where("tenant_id = ? AND status = ?", tenantID, models.ScanStatusRunning).
+		Count(&running).Error; err != nil {
+		return nil, fmt.Errorf("failed to check running scans: %w", err)
+	}
+	if running > 0 {
+		return nil, fmt.Errorf("a duplicate scan is already running")
+	}
+
+	scan := &models.DuplicateScan{
+		TenantID:    tenantID,
+		Status:      models.ScanStatusRunning,
+		Threshold:   threshold,
+		Neighbors:   neighbors,
+		RequestedBy: actor.ID,
+	}
+	if err := s.db.Create(scan).Error; err != nil {
+		return nil, fmt.Errorf("failed to create scan: %w", err)
+	}
+
+	go s.runScan(*scan)
+	return scan, nil
+}
+
+// FailInterruptedScans marks scans left running by a previous process as failed
+func (s *DuplicateService) FailInterruptedScans() error {
+	if err := s.db.Model(&models.DuplicateScan{}).Where("status = ?", models.ScanStatusRunning).
+		Updates(map[string]interface{}{
+			"status":       models.ScanStatusFailed,
+			"error":        "interrupted by a server restart",
+			"completed_at": time.Now(),
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update interrupted scans: %w", err)
+	}
+	return nil
+}
+
+// ListScans returns the tenant's duplicate scans, newest first
+func (s *DuplicateService) ListScans(tenantID uint) ([]models.DuplicateScan, error) {
+	var scans []models.DuplicateScan
+	if err := s.db.Where("tenant_id = ?", tenantID).Order("id DESC").Find(&scans).Error; err != nil {
+		return nil, fmt.Errorf("failed to list scans: %w", err)
+	}
+	return scans, nil
+}
+
+func (s *DuplicateService) GetScan(tenantID, id uint) (*models.DuplicateScan, error) {
+	var scan models.DuplicateScan
+	if err := s.db.Where("tenant_id = ?", tenantID).First(&scan, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("duplicate scan not found")
+		}
+		return nil, fmt.Errorf("failed to get scan: %w", err)
+	}
+	return &scan, nil
+}
+
+// ListScanClusters returns a page of a scan's clusters, largest first, with the total number
+// of clusters. Each cluster carries those of its images that have not been deleted since.
+func (s *DuplicateService) ListScanClusters(tenantID, scanID uint, limit, offset int) (
+	[]models.DuplicateScanCluster, int64, error) {
+	if _, err := s.GetScan(tenantID, scanID); err != nil {
+		return nil, 0, err
+	}
+
+	query := s.db.Model(&models.DuplicateScanCluster{}).Where("tenant_id = ? AND scan_id = ?", tenantID, scanID)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count clusters: %w", err)
+	}
+	var clusters []models.DuplicateScanCluster
+	if err := query.Order("size DESC, id").Limit(limit).Offset(offset).Find(&clusters).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list clusters: %w", err)
+	}
+
+	var imageIDs []uint
+	for _, cluster := range clusters {
+		imageIDs = append(imageIDs, cluster.ImageIDs...)
+	}
+	if len(imageIDs) == 0 {
+		return clusters, total, nil
+	}
+	var images []models.Image
+	if err := s.liveImages(tenantID).Where("images.id IN ?", imageIDs).Find(&images).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get cluster images: %w", err)
+	}
+	byID := make(map[uint]models.Image, len(images))
+	for _, image := range images {
+		byID[image.ID] = image
+	}
+	for i := range clusters {
+		for _, id := range clusters[i].ImageIDs {
+			if image, ok := byID[id]; ok {
+				clusters[i].Images = append(clusters[i].Images, image)
+			}
+		}
+	}
+	return clusters, total, nil
+}
+
+// ResolveClusters resolves clusters of a completed scan by moving every image but the keeper
+// to the trash; merging also tags the keeper with the duplicates' tags and trashes the records
+// left without images. Clusters already resolved, or whose keeper is gone, are skipped.
+func (s *DuplicateService) ResolveClusters(actor AuditActor, tenantID, scanID uint,
+	req models.ResolveDuplicatesRequest) (*models.ResolveDuplicatesResponse, error) {
+	if req.Action != models.DuplicateActionMerge && req.Action != models.DuplicateActionDelete {
+		return nil, fmt.Errorf("invalid action: must be %s or %s", models.DuplicateActionMerge,
+			models.DuplicateActionDelete)
+	}
+	scan, err := s.GetScan(tenantID, scanID)
+	if err != nil {
+		return nil, err
+	}
+	if scan.Status != models.ScanStatusCompleted {
+		return nil, fmt.Errorf("duplicate scan %d is not completed", scanID)
+	}
+
+	query := s.db.Where("tenant_id = ? AND scan_id = ?", tenantID, scanID)
+	if len(req.ClusterIDs) > 0 {
+		query = query.Where("id IN ?", req.ClusterIDs)
+	} else {
+		query = query.Where("resolution = ''")
+	}
+	var clusters []models.DuplicateScanCluster
+	if err := query.Order("id").Find(&clusters).Error; err != nil {
+		return nil, fmt.Errorf("failed to get clusters: %w", err)
+	}
+
+	byID := make(map[uint]*models.DuplicateScanCluster, len(clusters))
+	for i := range clusters {
+		byID[clusters[i].ID] = &clusters[i]
+	}
+	for _, id := range req.ClusterIDs {
+		if byID[id] == nil {
+			return nil, fmt.Errorf("cluster %d not found", id)
+		}
+	}
+	for clusterID, keeperID := range req.Keepers {
+		cluster := byID[clusterID]
+		if cluster == nil {
+			return nil, fmt.Errorf("cluster %d not found", clusterID)
+		}
+		if !containsID(cluster.ImageIDs, keeperID) {
+			return nil, fmt.Errorf("invalid keeper: image %d is not in cluster %d", keeperID, clusterID)
+		}
+	}
+
+	response := &models.ResolveDuplicatesResponse{
+		Resolved:       []uint{},
+		RemovedImages:  []uint{},
+		TrashedRecords: []uint{},
+		Skipped:        []models.SkippedCluster{},
+	}
+	for i := range clusters {
+		cluster := &clusters[i]
+		if cluster.Resolution != "" {
+			response.Skipped = append(response.Skipped, models.SkippedCluster{ClusterID: cluster.ID, Reason: "already resolved"})
+			continue
+		}
+
+		keeperID := cluster.KeeperImageID
+		if id, ok := req.Keepers[cluster.ID]; ok {
+			keeperID = id
+		}
+		keeper, err := s.recordService.GetImage(tenantID, keeperID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				response.Skipped = append(response.Skipped, models.SkippedCluster{
+					ClusterID: cluster.ID,
+					Reason:    fmt.Sprintf("keeper image %d no longer exists", keeperID),
+				})
+				continue
+			}
+			return response, err
+		}
+
+		removed, trashed, err := s.resolveCluster(actor, tenantID, cluster, keeper, req.Action)
+		response.RemovedImages = append(response.RemovedImages, removed...)
+		response.TrashedRecords = append(response.TrashedRecords, trashed...)
+		if err != nil {
+			// The cluster stays unresolved; resolving it again skips the images already removed
+			return response, err
+		}
+
+		now := time.Now()
+		if err := s.db.Model(cluster).Updates(map[string]interface{}{
+			"resolution":  req.Action,
+			"resolved_at": now,
+		}).Error; err != nil {
+			return response, fmt.Errorf("failed to resolve cluster %d: %w", cluster.ID, err)
+		}
+		response.Resolved = append(response.Resolved, cluster.ID)
+	}
+	return response, nil
+}
+
+// resolveCluster trashes every live image of a cluster but the keeper, returning the images
+// removed and, when merging, the records trashed for being left empty. Like restores, each
+// image's vectors are moved before its row, so a failure never leaves a trashed image searchable.
+func (s *DuplicateService) resolveCluster(actor AuditActor, tenantID uint, cluster *models.DuplicateScanCluster,
+	keeper *models.Image, action string) (removed, trashed []uint, err error) {
+	var tags []string
+	var records []uint
+	for _, id := range cluster.ImageIDs {
+		if id == keeper.ID {
+			continue
+		}
+		image, err := s.recordService.GetImage(tenantID, id)
+		if err != nil {
+			// Images deleted since the scan are already gone
+			if strings.Contains(err.Error(), "not found") {
+				continue
+			}
+			return removed, trashed, err
+		}
+		var moved []string
+		for _, vectorID := range image.VectorIDs() {
+			if err := s.vectorService.TrashVector(vectorID); err != nil {
+				return removed, trashed, s.untrashVectors(tenantID, image, moved, err)
+			}
+			moved = append(moved, vectorID)
+		}
+		if err := s.recordService.DeleteImage(actor, tenantID, id); err != nil {
+			return removed, trashed, s.untrashVectors(tenantID, image, moved, err)
+		}
+		removed = append(removed, id)
+		tags = append(tags, models.TagNames(image.Tags)...)
+		if image.RecordID != keeper.RecordID && !containsID(records, image.RecordID) {
+			records = append(records, image.RecordID)
+		}
+	}
+	if action != models.DuplicateActionMerge {
+		return removed, trashed, nil
+	}
+
+	if len(tags) > 0 {
+		if err := s.tagService.TagImages(tenantID, []uint{keeper.ID}, tags); err != nil {
+			return removed, trashed, err
+		}
+	}
+	for _, recordID := range records {
+		var count int64
+		if err := s.db.Model(&models.Image{}).Where("record_id = ?", recordID).Count(&count).Error; err != nil {
+			return removed, trashed, fmt.Errorf("failed to count images of record %d: %w", recordID, err)
+		}
+		if count > 0 {
+			continue
+		}
+		if err := s.recordService.DeleteRecord(actor, tenantID, recordID); err != nil {
+			return removed, trashed, err
+		}
+		trashed = append(trashed, recordID)
+	}
+	return removed, trashed, nil
+}
+
+// untrashVectors moves the vectors of an image that failed to be trashed back into its dataset's
+// partition, returning the original error along with any error of the rollback
+func (s *DuplicateService) untrashVectors(tenantID uint, image *models.Image, vectorIDs []string, cause error) error {
+	if len(vectorIDs) == 0 {
+		return cause
+	}
+	var dataset models.Dataset
+	if err := s.db.Joins("JOIN records ON records.dataset_id = datasets.id").
+		Where("records.id = ? AND datasets.tenant_id = ?", image.RecordID, tenantID).First(&dataset).Error; err != nil {
+		return fmt.Errorf("%w; failed to get dataset to restore vectors: %v", cause, err)
+	}
+	tags, err := s.tagService.EffectiveImageTags(tenantID, image.ID)
+	if err != nil {
+		return fmt.Errorf("%w; failed to restore vectors: %v", cause, err)
+	}
+	for _, vectorID := range vectorIDs {
+		if err := s.vectorService.RestoreVector(vectorID, tags, dataset.PartitionName); err != nil {
+			return fmt.Errorf("%w; %v", cause, err)
+		}
+	}
+	return cause
+}
+
+// runScan runs a scan to completion and records its outcome
+func (s *DuplicateService) runScan(scan models.DuplicateScan) {
+	clusters, scanErr := s.scanClusters(&scan)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"images_scanned": scan.ImagesScanned,
+			"completed_at":   time.Now(),
+		}
+		if scanErr != nil {
+			updates["status"] = models.ScanStatusFailed
+			updates["error"] = truncateText(scanErr.Error(), 1000)
+		} else {
+			if len(clusters) > 0 {
+				if err := tx.CreateInBatches(clusters, duplicateScanBatchSize).Error; err != nil {
+					return fmt.Errorf("failed to save clusters: %w", err)
+				}
+			}
+			updates["status"] = models.ScanStatusCompleted
+			updates["cluster_count"] = len(clusters)
+		}
+		return tx.Model(&models.DuplicateScan{}).Where("id = ?", scan.ID).Updates(updates).Error
+	})
+	if err != nil {
+		s.db.Model(&models.DuplicateScan{}).Where("id = ?", scan.ID).Updates(map[string]interface{}{
+			"status":       models.ScanStatusFailed,
+			"error":        truncateText(err.Error(), 1000),
+			"completed_at": time.Now(),
+		})
+	}
+}
+
+// scanClusters links every live image of the scan's tenant to those of its nearest neighbours
+// at least as similar as the threshold, and to images with the same digest, and returns the
+// connected components of two or more images, largest first
+func (s *DuplicateService) scanClusters(scan *models.DuplicateScan) ([]models.DuplicateScanCluster, error) {
+	partitions, err := s.tenantPartitions(scan.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []scanImage
+	if err := s.liveImages(scan.TenantID).Select("images.id, images.vector_id, images.digest").
+		Order("images.id").Scan(&images).Error; err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	sets := make(idSets, len(images))
+	byVector := make(map[string]uint, len(images))
+	byDigest := make(map[string]uint)
+	for _, image := range images {
+		sets.add(image.ID)
+		byVector[image.VectorID] = image.ID
+		if image.Digest == "" {
+			continue
+		}
+		if first, ok := byDigest[image.Digest]; ok {
+			sets.union(first, image.ID)
+		} else {
+			byDigest[image.Digest] = image.ID
+		}
+	}
+
+	for start := 0; start < len(images); start += duplicateScanBatchSize {
+		end := start + duplicateScanBatchSize
+		if end > len(images) {
+			end = len(images)
+		}
+		if err := s.linkNeighbors(scan, images[start:end], partitions, byVector, sets); err != nil {
+			return nil, err
+		}
+		scan.ImagesScanned = end
+		s.db.Model(&models.DuplicateScan{}).Where("id = ?", scan.ID).Update("images_scanned", end)
+	}
+
+	members := make(map[uint][]uint)
+	for _, image := range images {
+		root := sets.find(image.ID)
+		members[root] = append(members[root], image.ID)
+	}
+	var clusterIDs []uint
+	for _, group := range members {
+		if len(group) > 1 {
+			clusterIDs = append(clusterIDs, group...)
+		}
+	}
+	sizes, err := s.imageFileSizes(clusterIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []models.DuplicateScanCluster
+	for _, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+		// Images were loaded in ID order, so each group is sorted and its first image the oldest
+		keeper := group[0]
+		for _, id := range group[1:] {
+			if sizes[id] > sizes[keeper] {
+				keeper = id
+			}
+		}
+		clusters = append(clusters, models.DuplicateScanCluster{
+			TenantID:      scan.TenantID,
+			ScanID:        scan.ID,
+			Size:          len(group),
+			KeeperImageID: keeper,
+			ImageIDs:      models.IDList(group),
+		})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Size != clusters[j].Size {
+			return clusters[i].Size > clusters[j].Size
+		}
+		return clusters[i].ImageIDs[0] < clusters[j].ImageIDs[0]
+	})
+	return clusters, nil
+}
+
+// linkNeighbors searches the nearest neighbours of a batch of images and unions each image
+// with the neighbours at least as similar as the scan threshold
+func (s *DuplicateService) linkNeighbors(scan *models.DuplicateScan, batch []scanImage, partitions []string,
+	byVector map[string]uint, sets idSets) error {
+	vectorIDs := make([]string, len(batch))
+	for i, image := range batch {
+		vectorIDs[i] = image.VectorID
+	}
+	vectors, err := s.vectorService.GetVectors(vectorIDs)
+	if err != nil {
+		return err
+	}
+
+	type pair struct {
+		imageID  uint
+		vectorID string
+		neighbor string
+	}
+	var pairs []pair
+	var missing []string
+	for _, image := range batch {
+		vector, ok := vectors[image.VectorID]
+		if !ok {
+			continue
+		}
+		// One extra neighbour makes up for the image finding itself
+		results, err := s.vectorService.SearchSimilarWithVector(vector, SearchOptions{
+			TopK:       scan.Neighbors + 1,
+			Partitions: partitions,
+		})
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			neighborID, ok := byVector[result.ImageID]
+			if !ok || neighborID == image.ID || sets.find(neighborID) == sets.find(image.ID) {
+				continue
+			}
+			pairs = append(pairs, pair{imageID: image.ID, vectorID: image.VectorID, neighbor: result.ImageID})
+			if _, ok := vectors[result.ImageID]; !ok {
+				missing = append(missing, result.ImageID)
+				vectors[result.ImageID] = nil
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		fetched, err := s.vectorService.GetVectors(missing)
+		if err != nil {
+			return err
+		}
+		for id, vector := range fetched {
+			vectors[id] = vector
+		}
+	}
+
+	for _, p := range pairs {
+		neighbor := vectors[p.neighbor]
+		if neighbor == nil {
+			continue
+		}
+		if float64(CalculateSimilarity(vectors[p.vectorID], neighbor)) >= scan.Threshold {
+			sets.union(p.imageID, byVector[p.neighbor])
+		}
+	}
+	return nil
+}
+
+// imageFileSizes returns the size of each image's blob; images stored before deduplication have none
+func (s *DuplicateService) imageFileSizes(imageIDs []uint) (map[uint]int64, error) {
+	sizes := make(map[uint]int64, len(imageIDs))
+	for start := 0; start < len(imageIDs); start += duplicateScanBatchSize {
+		end := start + duplicateScanBatchSize
+		if end > len(imageIDs) {
+			end = len(imageIDs)
+		}
+		var rows []struct {
+			ID   uint
+			Size int64
+		}
+		if err := s.db.Table("images").
+			Select("images.id, blobs.size").
+			Joins("JOIN blobs ON blobs.tenant_id = images.tenant_id AND blobs.digest = images.digest").
+			Where("images.id IN ?", imageIDs[start:end]).
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to get file sizes: %w", err)
+		}
+		for _, row := range rows {
+			sizes[row.ID] = row.Size
+		}
+	}
+	return sizes, nil
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateText shortens text to at most n bytes for a bounded column
+func truncateText(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	return text[:n]
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"image-rag-backend/internal/authz"
+	"image-rag-backend/internal/config"
+	"image-rag-backend/internal/database"
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Duplicate policies decide what happens to an upload that duplicates existing images
+const (
+	// DuplicatePolicyAllow adds the upload and reports the duplicates
+	DuplicatePolicyAllow = "allow"
+	// DuplicatePolicyLink adds the upload linked to the image it duplicates
+	DuplicatePolicyLink = "link"
+	// DuplicatePolicyReject refuses the upload
+	DuplicatePolicyReject = "reject"
+)
+
+// ValidateDuplicatePolicy checks a duplicate policy name
+func ValidateDuplicatePolicy(policy string) error {
+	switch policy {
+	case DuplicatePolicyAllow, DuplicatePolicyLink, DuplicatePolicyReject:
+		return nil
+	default:
+		return fmt.Errorf("invalid duplicate policy: must be %s, %s or %s",
+			DuplicatePolicyAllow, DuplicatePolicyLink, DuplicatePolicyReject)
+	}
+}
+
+// DuplicateService finds the existing images an upload duplicates and groups the
+// corpus into clusters of duplicates. Exact duplicates share a digest; near duplicates
+// are close both in embedding space and in perceptual hash.
+type DuplicateService struct {
+	db            *gorm.DB
+	recordService *RecordService
+	vectorService *VectorService
+	tagService    *TagService
+	config        config.DuplicateConfig
+}
+
+func NewDuplicateService(recordService *RecordService, vectorService *VectorService, tagService *TagService,
+	cfg config.DuplicateConfig) (*DuplicateService, error) {
+	if err := ValidateDuplicatePolicy(cfg.Policy); err != nil {
+		return nil, err
+	}
+	return &DuplicateService{
+		db:            database.DB,
+		recordService: recordService,
+		vectorService: vectorService,
+		tagService:    tagService,
+		config:        cfg,
+	}, nil
+}
+
+// Policy returns the requested duplicate policy, or the configured default when none is requested
+func (s *DuplicateService) Policy(requested string) (string, error) {
+	if requested == "" {
+		return s.config.Policy, nil
+	}
+	if err := ValidateDuplicatePolicy(requested); err != nil {
+		return "", err
+	}
+	return requested, nil
+}
+
+// FindDuplicates returns the live images visible to the principal that a stored upload with
+// the given vector duplicates: exact duplicates first, then near duplicates by similarity
+func (s *DuplicateService) FindDuplicates(principal *models.Principal, stored *StoredImage,
+	vectorID string) ([]models.DuplicateMatch, error) {
+	var exact []models.Image
+	if err := s.visibleImages(principal, stored.TenantID).
+		Where("images.digest = ? AND images.vector_id <> ?", stored.Digest, vectorID).
+		Order("images.id").Find(&exact).Error; err != nil {
+		return nil, fmt.Errorf("failed to find exact duplicates: %w", err)
+	}
+
+	matches := make([]models.DuplicateMatch, 0, len(exact))
+	seen := map[uint]bool{}
+	for _, image := range exact {
+		matches = append(matches, models.DuplicateMatch{
+			ImageID:     image.ID,
+			RecordID:    image.RecordID,
+			Kind:        models.DuplicateExact,
+			DuplicateOf: image.DuplicateOf,
+		})
+		seen[image.ID] = true
+	}
+
+	// Images that cannot be decoded have no perceptual hashes to confirm a near match
+	if stored.PHash == nil || s.config.Candidates <= 0 {
+		return matches, nil
+	}
+	near, err := s.findNearDuplicates(principal, stored, vectorID, seen)
+	if err != nil {
+		return nil, err
+	}
+	return append(matches, near...), nil
+}
+
+// findNearDuplicates checks the upload's nearest neighbours across the tenant's datasets,
+// keeping those within both the similarity and the hash distance thresholds
+func (s *DuplicateService) findNearDuplicates(principal *models.Principal, stored *StoredImage, vectorID string,
+	exclude map[uint]bool) ([]models.DuplicateMatch, error) {
+	partitions, err := s.tenantPartitions(stored.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	embedding, err := s.vectorService.GetVectorByID(vectorID)
+	if err != nil {
+		return nil, err
+	}
+	// One extra neighbour makes up for the upload finding itself
+	results, err := s.vectorService.SearchSimilarWithVector(embedding, SearchOptions{
+		TopK:       s.config.Candidates + 1,
+		Partitions: partitions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	candidateIDs := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.ImageID != vectorID {
+			candidateIDs = append(candidateIDs, result.ImageID)
+		}
+	}
+	if len(candidateIDs) == 0 {
+		return nil, nil
+	}
+
+	var images []models.Image
+	if err := s.visibleImages(principal, stored.TenantID).
+		Where("images.vector_id IN ?", candidateIDs).Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("failed to get candidate images: %w", err)
+	}
+	vectors, err := s.vectorService.GetVectors(candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []models.DuplicateMatch
+	for _, image := range images {
+		vector, ok := vectors[image.VectorID]
+		if exclude[image.ID] || !ok || image.PHash == nil || image.DHash == nil {
+			continue
+		}
+		similarity := CalculateSimilarity(embedding, vector)
+		if float64(similarity) < s.config.MinSimilarity {
+			continue
+		}
+		pDistance := HammingDistance(*stored.PHash, *image.PHash)
+		dDistance := HammingDistance(*stored.DHash, *image.DHash)
+		if pDistance > s.config.MaxHashDistance && dDistance > s.config.MaxHashDistance {
+			continue
+		}
+		matches = append(matches, models.DuplicateMatch{
+			ImageID:       image.ID,
+			RecordID:      image.RecordID,
+			Kind:          models.DuplicateNear,
+			DuplicateOf:   image.DuplicateOf,
+			PHashDistance: &pDistance,
+			DHashDistance: &dDistance,
+			Similarity:    similarity,
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Similarity > matches[j].Similarity })
+	return matches, nil
+}
+
+// tenantPartitions returns the vector store partitions of all of a tenant's datasets
+func (s *DuplicateService) tenantPartitions(tenantID uint) ([]string, error) {
+	var partitions []string
+	if err := s.db.Model(&models.Dataset{}).Where("tenant_id = ?", tenantID).
+		Pluck("partition_name", &partitions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get datasets: %w", err)
+	}
+	return partitions, nil
+}
+
+// CanonicalImageID returns the image an upload with these matches links to: the best
+// match, or the image that match is itself linked to, so links never chain
+func CanonicalImageID(matches []models.DuplicateMatch) uint {
+	if matches[0].DuplicateOf != nil {
+		return *matches[0].DuplicateOf
+	}
+	return matches[0].ImageID
+}
+
+// ListClusters groups the live images visible to the principal into clusters of exact
+// duplicates and images linked as duplicates, largest first. It returns a page of clusters
+// with the total number of clusters.
+func (s *DuplicateService) ListClusters(principal *models.Principal, tenantID uint, limit, offset int) (
+	[]models.DuplicateCluster, int, error) {
+	sharedDigests := s.visibleImages(principal, tenantID).
+		Where("images.digest <> ''").
+		Group("images.digest").Having("COUNT(*) > 1").Select("images.digest")
+
+	var images []models.Image
+	if err := s.visibleImages(principal, tenantID).
+		Where("images.digest IN (?) OR images.duplicate_of IS NOT NULL", sharedDigests).
+		Find(&images).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to find duplicate images: %w", err)
+	}
+
+	// Pull in the images that linked duplicates point to
+	loaded := make(map[uint]bool, len(images))
+	for _, image := range images {
+		loaded[image.ID] = true
+	}
+	var targetIDs []uint
+	for _, image := range images {
+		if image.DuplicateOf != nil && !loaded[*image.DuplicateOf] {
+			targetIDs = append(targetIDs, *image.DuplicateOf)
+			loaded[*image.DuplicateOf] = true
+		}
+	}
+	if len(targetIDs) > 0 {
+		var targets []models.Image
+		if err := s.visibleImages(principal, tenantID).Where("images.id IN ?", targetIDs).
+			Find(&targets).Error; err != nil {
+			return nil, 0, fmt.Errorf("failed to find duplicate images: %w", err)
+		}
+		images = append(images, targets...)
+	}
+
+	clusters := clusterImages(images)
+	total := len(clusters)
+	if offset >= total {
+		return []models.DuplicateCluster{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return clusters[offset:end], total, nil
+}
+
+// clusterImages unions images sharing a digest or linked by duplicate_of and returns
+// the clusters of two or more, largest first, each ordered by image ID
+func clusterImages(images []models.Image) []models.DuplicateCluster {
+	sets := make(idSets, len(images))
+	for _, image := range images {
+		sets.add(image.ID)
+	}
+	byDigest := make(map[string]uint)
+	for _, image := range images {
+		if image.Digest != "" {
+			if first, ok := byDigest[image.Digest]; ok {
+				sets.union(first, image.ID)
+			} else {
+				byDigest[image.Digest] = image.ID
+			}
+		}
+		// Links to images the principal cannot see are ignored
+		if image.DuplicateOf != nil {
+			if _, ok := sets[*image.DuplicateOf]; ok {
+				sets.union(*image.DuplicateOf, image.ID)
+			}
+		}
+	}
+
+	members := make(map[uint][]models.Image)
+	for _, image := range images {
+		root := sets.find(image.ID)
+		members[root] = append(members[root], image)
+	}
+
+	clusters := make([]models.DuplicateCluster, 0, len(members))
+	for root, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i].ID < group[j].ID })
+		clusters = append(clusters, models.DuplicateCluster{ID: root, Size: len(group), Images: group})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Size != clusters[j].Size {
+			return clusters[i].Size > clusters[j].Size
+		}
+		return clusters[i].ID < clusters[j].ID
+	})
+	return clusters
+}
+
+// idSets is a union-find over image IDs, mapping each ID to its parent
+type idSets map[uint]uint
+
+func (s idSets) add(id uint) {
+	if _, ok := s[id]; !ok {
+		s[id] = id
+	}
+}
+
+// find returns the root of an added ID's set, compressing the path to it
+func (s idSets) find(id uint) uint {
+	root := id
+	for s[root] != root {
+		root = s[root]
+	}
+	for s[id] != root {
+		s[id], id = root, s[id]
+	}
+	return root
+}
+
+// union merges the sets of two added IDs. The smaller root stays the root, so a set
+// is named after its oldest image.
+func (s idSets) union(a, b uint) {
+	rootA, rootB := s.find(a), s.find(b)
+	switch {
+	case rootA < rootB:
+		s[rootB] = rootA
+	case rootB < rootA:
+		s[rootA] = rootB
+	}
+}
+
+// visibleImages starts a query over the tenant's live images in live records the principal may see
+func (s *DuplicateService) visibleImages(principal *models.Principal, tenantID uint) *gorm.DB {
+	return s.liveImages(tenantID).Scopes(authz.VisibleRecords(principal))
+}
+
+// liveImages starts a query over the tenant's images that are in neither the trash nor a trashed record
+func (s *DuplicateService) liveImages(tenantID uint) *gorm.DB {
+	return s.db.Model(&models.Image{}).
+		Joins("JOIN records ON records.id = images.record_id AND records.deleted_at IS NULL").
+		Where("images.tenant_id = ?", tenantID)
+}
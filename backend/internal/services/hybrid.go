@@ -0,0 +1,132 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FusionMethod selects how vector and full-text scores are combined
+type FusionMethod string
+
+const (
+	FusionRRF      FusionMethod = "rrf"
+	FusionWeighted FusionMethod = "weighted"
+
+	// defaultRRFK is the rank constant from the original reciprocal rank fusion paper
+	defaultRRFK = 60
+)
+
+// HybridOptions tunes score fusion for hybrid search
+type HybridOptions struct {
+	Method       FusionMethod
+	VectorWeight float64
+	TextWeight   float64
+	RRFK         int
+}
+
+// DefaultHybridOptions returns equal-weight reciprocal rank fusion
+func DefaultHybridOptions() HybridOptions {
+	return HybridOptions{
+		Method:       FusionRRF,
+		VectorWeight: 0.5,
+		TextWeight:   0.5,
+		RRFK:         defaultRRFK,
+	}
+}
+
+// Validate checks fusion options for consistency
+func (o HybridOptions) Validate() error {
+	if o.Method != FusionRRF && o.Method != FusionWeighted {
+		return fmt.Errorf("unsupported fusion method: %s", o.Method)
+	}
+	if o.VectorWeight < 0 || o.TextWeight < 0 {
+		return fmt.Errorf("fusion weights must not be negative")
+	}
+	if o.VectorWeight == 0 && o.TextWeight == 0 {
+		return fmt.Errorf("at least one fusion weight must be positive")
+	}
+	if o.RRFK < 1 {
+		return fmt.Errorf("rrf_k must be positive")
+	}
+	return nil
+}
+
+// TextMatch is a record matched by the full-text index
+type TextMatch struct {
+	RecordID uint
+	Score    float64
+}
+
+// HybridCandidate is an image scored by vector similarity and/or full-text relevance
+type HybridCandidate struct {
+	ImageID  uint
+	RecordID uint
+	Distance float32
+	// VectorRank is 1-based, 0 when the image was not retrieved by vector search
+	VectorRank int
+	TextScore  float64
+	// TextRank is 1-based, 0 when the record did not match the text query
+	TextRank int
+	Score    float64
+}
+
+// FuseHybrid scores candidates with the configured fusion method and returns them best first
+func FuseHybrid(candidates []HybridCandidate, opts HybridOptions) []HybridCandidate {
+	switch opts.Method {
+	case FusionWeighted:
+		fuseWeighted(candidates, opts)
+	default:
+		fuseRRF(candidates, opts)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+// fuseRRF applies weighted reciprocal rank fusion
+func fuseRRF(candidates []HybridCandidate, opts HybridOptions) {
+	k := float64(opts.RRFK)
+	for i := range candidates {
+		score := 0.0
+		if candidates[i].VectorRank > 0 {
+			score += opts.VectorWeight / (k + float64(candidates[i].VectorRank))
+		}
+		if candidates[i].TextRank > 0 {
+			score += opts.TextWeight / (k + float64(candidates[i].TextRank))
+		}
+		candidates[i].Score = score
+	}
+}
+
+// fuseWeighted combines max-normalized vector similarity and text relevance
+func fuseWeighted(candidates []HybridCandidate, opts HybridOptions) {
+	var maxVector, maxText float64
+	for _, candidate := range candidates {
+		if candidate.VectorRank > 0 {
+			if sim := distanceToSimilarity(candidate.Distance); sim > maxVector {
+				maxVector = sim
+			}
+		}
+		if candidate.TextScore > maxText {
+			maxText = candidate.TextScore
+		}
+	}
+
+	for i := range candidates {
+		score := 0.0
+		if candidates[i].VectorRank > 0 && maxVector > 0 {
+			score += opts.VectorWeight * distanceToSimilarity(candidates[i].Distance) / maxVector
+		}
+		if candidates[i].TextRank > 0 && maxText > 0 {
+			score += opts.TextWeight * candidates[i].TextScore / maxText
+		}
+		candidates[i].Score = score
+	}
+}
+
+// distanceToSimilarity maps an L2 distance to a similarity in (0, 1]
+func distanceToSimilarity(distance float32) float64 {
+	return 1 / (1 + float64(distance))
+}
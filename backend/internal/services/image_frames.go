@@ -0,0 +1,382 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// sniffImageType detects the content type of an image from its first bytes. It adds TIFF,
+// which http.DetectContentType does not know, to the types that function detects.
+func sniffImageType(head []byte) string {
+	if bytes.HasPrefix(head, []byte("II*\x00")) || bytes.HasPrefix(head, []byte("MM\x00*")) {
+		return "image/tiff"
+	}
+	return http.DetectContentType(head)
+}
+
+// imageFrames describes the frames of an image: one for still images
+type imageFrames struct {
+	Count int
+	// Pixels is the area of all frames together
+	Pixels int64
+}
+
+// scanFrames counts the frames of a GIF or WebP file from its block structure, without decoding
+// any pixels; other images count as a single frame of the given size
+func scanFrames(data []byte, width, height int) (imageFrames, error) {
+	switch sniffImageType(data) {
+	case "image/gif":
+		return scanGIFFrames(data)
+	case "image/webp":
+		animation, err := parseWebPAnimation(data)
+		if err != nil {
+			return imageFrames{}, err
+		}
+		if animation != nil {
+			frames := imageFrames{Count: len(animation.Frames)}
+			for _, frame := range animation.Frames {
+				frames.Pixels += int64(frame.Width) * int64(frame.Height)
+			}
+			return frames, nil
+		}
+	}
+	return imageFrames{Count: 1, Pixels: int64(width) * int64(height)}, nil
+}
+
+// scanGIFFrames walks the blocks of a GIF file, adding up its image descriptors
+func scanGIFFrames(data []byte) (imageFrames, error) {
+	var frames imageFrames
+	truncated := fmt.Errorf("truncated GIF")
+	// Header and logical screen descriptor
+	if len(data) < 13 {
+		return frames, truncated
+	}
+	p := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		p += 3 << ((flags & 0x07) + 1)
+	}
+	skipSubBlocks := func() bool {
+		for p < len(data) {
+			size := int(data[p])
+			p += 1 + size
+			if size == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	for p < len(data) {
+		switch data[p] {
+		case 0x21: // extension: label then data sub-blocks
+			p += 2
+			if !skipSubBlocks() {
+				return frames, truncated
+			}
+		case 0x2C: // image descriptor, optional local color table, LZW code size, data sub-blocks
+			if p+10 > len(data) {
+				return frames, truncated
+			}
+			width := int(binary.LittleEndian.Uint16(data[p+5:]))
+			height := int(binary.LittleEndian.Uint16(data[p+7:]))
+			flags := data[p+9]
+			p += 10
+			if flags&0x80 != 0 {
+				p += 3 << ((flags & 0x07) + 1)
+			}
+			p++
+			if !skipSubBlocks() {
+				return frames, truncated
+			}
+			frames.Count++
+			frames.Pixels += int64(width) * int64(height)
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return frames, fmt.Errorf("invalid GIF block 0x%02x", data[p])
+		}
+	}
+	// Decoders accept a missing trailer
+	return frames, nil
+}
+
+// webpAnimation is the canvas and frames of an animated WebP file
+type webpAnimation struct {
+	Width, Height int
+	Frames        []webpFrame
+}
+
+// webpFrame is an ANMF chunk: where the frame goes on the canvas and its image chunks
+type webpFrame struct {
+	X, Y, Width, Height int
+	// Blend alpha-blends the frame over the canvas rather than replacing the pixels it covers
+	Blend bool
+	// Dispose clears the frame's area to transparent before the next frame
+	Dispose bool
+	// Data holds the frame's ALPH, VP8 or VP8L chunks
+	Data []byte
+}
+
+// parseWebPAnimation reads the canvas and frames of an animated WebP file; nil for still images
+func parseWebPAnimation(data []byte) (*webpAnimation, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("not a WebP file")
+	}
+
+	var animation *webpAnimation
+	for p := 12; p+8 <= len(data); {
+		id, length := string(data[p:p+4]), int(binary.LittleEndian.Uint32(data[p+4:]))
+		p += 8
+		if length < 0 || length > len(data)-p {
+			return nil, fmt.Errorf("truncated WebP chunk %q", id)
+		}
+		chunk := data[p : p+length]
+		// Chunks are padded to an even size
+		p += length + length&1
+
+		switch id {
+		case "VP8X":
+			if length < 10 {
+				return nil, fmt.Errorf("invalid WebP VP8X chunk")
+			}
+			// Only files flagged as animated carry ANMF chunks
+			if chunk[0]&0x02 == 0 {
+				return nil, nil
+			}
+			animation = &webpAnimation{Width: uint24(chunk[4:]) + 1, Height: uint24(chunk[7:]) + 1}
+		case "ANMF":
+			if animation == nil || length < 16 {
+				return nil, fmt.Errorf("invalid WebP ANMF chunk")
+			}
+			animation.Frames = append(animation.Frames, webpFrame{
+				X:       2 * uint24(chunk[0:]),
+				Y:       2 * uint24(chunk[3:]),
+				Width:   uint24(chunk[6:]) + 1,
+				Height:  uint24(chunk[9:]) + 1,
+				Blend:   chunk[15]&0x02 == 0,
+				Dispose: chunk[15]&0x01 != 0,
+				Data:    chunk[16:],
+			})
+		}
+	}
+	if animation != nil && len(animation.Frames) == 0 {
+		return nil, fmt.Errorf("animated WebP has no frames")
+	}
+	return animation, nil
+}
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// decode wraps the frame's chunks into a standalone WebP file and decodes it. The size the
+// bitstream declares must match the ANMF chunk's, which is the size pixel limits were checked
+// against, so a frame cannot claim a small area and decode a large one.
+func (f webpFrame) decode() (image.Image, error) {
+	bitstream := f.Data
+	if bytes.HasPrefix(bitstream, []byte("ALPH")) {
+		if len(bitstream) < 8 {
+			return nil, fmt.Errorf("truncated WebP ALPH chunk")
+		}
+		length := int(binary.LittleEndian.Uint32(bitstream[4:]))
+		if length < 0 || length > len(bitstream)-8 {
+			return nil, fmt.Errorf("truncated WebP ALPH chunk")
+		}
+		bitstream = bitstream[8+length+length&1:]
+	}
+	// The extended header below would report its own size, so the bitstream is checked on its own
+	cfg, err := webp.DecodeConfig(bytes.NewReader(wrapWebP(bitstream)))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width != f.Width || cfg.Height != f.Height {
+		return nil, fmt.Errorf("frame is %dx%d but its ANMF chunk declares %dx%d", cfg.Width, cfg.Height,
+			f.Width, f.Height)
+	}
+
+	chunks := f.Data
+	if len(bitstream) < len(f.Data) {
+		// A lossy frame with an alpha channel needs the extended header to carry it
+		vp8x := []byte{0x10, 0, 0, 0,
+			byte(f.Width - 1), byte((f.Width - 1) >> 8), byte((f.Width - 1) >> 16),
+			byte(f.Height - 1), byte((f.Height - 1) >> 8), byte((f.Height - 1) >> 16)}
+		var header bytes.Buffer
+		header.WriteString("VP8X")
+		_ = binary.Write(&header, binary.LittleEndian, uint32(len(vp8x)))
+		header.Write(vp8x)
+		chunks = append(header.Bytes(), f.Data...)
+	}
+	return webp.Decode(bytes.NewReader(wrapWebP(chunks)))
+}
+
+// wrapWebP wraps chunks into a WebP file
+func wrapWebP(chunks []byte) []byte {
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	_ = binary.Write(&file, binary.LittleEndian, uint32(4+len(chunks)))
+	file.WriteString("WEBP")
+	file.Write(chunks)
+	return file.Bytes()
+}
+
+// decodeImage decodes a still image, or the first frame of an animated one. It differs from
+// image.Decode in decoding animated WebP, which golang.org/x/image/webp rejects.
+func decodeImage(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	frames, err := decodeKeyFrames(data, 1)
+	if err != nil {
+		return nil, err
+	}
+	return frames[0], nil
+}
+
+// decodeKeyFrames decodes up to maxFrames frames of an animated GIF or WebP, evenly spaced from
+// the first, each composited onto the full canvas as it is displayed. Still images give their only frame.
+func decodeKeyFrames(data []byte, maxFrames int) ([]image.Image, error) {
+	switch sniffImageType(data) {
+	case "image/gif":
+		if maxFrames > 1 {
+			return decodeGIFFrames(data, maxFrames)
+		}
+	case "image/webp":
+		animation, err := parseWebPAnimation(data)
+		if err != nil {
+			return nil, err
+		}
+		if animation != nil {
+			return animation.decodeFrames(maxFrames)
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return []image.Image{img}, nil
+}
+
+// keyFrameIndexes picks up to maxFrames indexes out of count frames, evenly spaced from the first
+func keyFrameIndexes(count, maxFrames int) map[int]bool {
+	if maxFrames < 1 {
+		maxFrames = 1
+	}
+	if maxFrames > count {
+		maxFrames = count
+	}
+	indexes := make(map[int]bool, maxFrames)
+	for i := 0; i < maxFrames; i++ {
+		indexes[i*count/maxFrames] = true
+	}
+	return indexes
+}
+
+func decodeGIFFrames(data []byte, maxFrames int) ([]image.Image, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+
+	keep := keyFrameIndexes(len(g.Image), maxFrames)
+	canvas := image.NewNRGBA(bounds)
+	frames := make([]image.Image, 0, len(keep))
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		if keep[i] {
+			frames = append(frames, cloneNRGBA(canvas))
+			if len(frames) == len(keep) {
+				break
+			}
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames, nil
+}
+
+func (a *webpAnimation) decodeFrames(maxFrames int) ([]image.Image, error) {
+	keep := keyFrameIndexes(len(a.Frames), maxFrames)
+	canvas := image.NewNRGBA(image.Rect(0, 0, a.Width, a.Height))
+	frames := make([]image.Image, 0, len(keep))
+	for i, frame := range a.Frames {
+		img, err := frame.decode()
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		area := image.Rect(frame.X, frame.Y, frame.X+frame.Width, frame.Y+frame.Height)
+		op := draw.Over
+		if !frame.Blend {
+			op = draw.Src
+		}
+		draw.Draw(canvas, area, img, img.Bounds().Min, op)
+		if keep[i] {
+			frames = append(frames, cloneNRGBA(canvas))
+			if len(frames) == len(keep) {
+				break
+			}
+		}
+
+		if frame.Dispose {
+			draw.Draw(canvas, area, image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return frames, nil
+}
+
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	clone := image.NewNRGBA(img.Bounds())
+	copy(clone.Pix, img.Pix)
+	return clone
+}
+
+// decodeAllFrames decodes every frame of an image and discards the pixels, rejecting truncated
+// and corrupt files
+func decodeAllFrames(data []byte) error {
+	switch sniffImageType(data) {
+	case "image/gif":
+		_, err := gif.DecodeAll(bytes.NewReader(data))
+		return err
+	case "image/webp":
+		animation, err := parseWebPAnimation(data)
+		if err != nil {
+			return err
+		}
+		if animation != nil {
+			for i, frame := range animation.Frames {
+				if _, err := frame.decode(); err != nil {
+					return fmt.Errorf("frame %d: %w", i, err)
+				}
+			}
+			return nil
+		}
+	}
+	_, _, err := image.Decode(bytes.NewReader(data))
+	return err
+}
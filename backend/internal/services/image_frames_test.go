@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// riffChunk encodes a RIFF chunk, padded to an even size
+func riffChunk(id string, data []byte) []byte {
+	chunk := []byte(id)
+	chunk = binary.LittleEndian.AppendUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func putUint24(b []byte, v int) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16))
+}
+
+// vp8xChunk is an extended header for a canvas, flagged as animated when animated is set
+func vp8xChunk(width, height int, animated bool) []byte {
+	var flags byte
+	if animated {
+		flags = 0x02
+	}
+	data := []byte{flags, 0, 0, 0}
+	data = putUint24(data, width-1)
+	data = putUint24(data, height-1)
+	return riffChunk("VP8X", data)
+}
+
+// anmfChunk is an animation frame at x, y of the given size; flags holds the blend and dispose bits
+func anmfChunk(x, y, width, height int, flags byte, frame []byte) []byte {
+	data := putUint24(nil, x/2)
+	data = putUint24(data, y/2)
+	data = putUint24(data, width-1)
+	data = putUint24(data, height-1)
+	data = putUint24(data, 100)
+	data = append(data, flags)
+	return riffChunk("ANMF", append(data, frame...))
+}
+
+// vp8lChunk is a lossless bitstream whose header declares a size; it carries no pixel data
+func vp8lChunk(width, height int) []byte {
+	bits := uint32(width-1) | uint32(height-1)<<14
+	header := []byte{0x2f}
+	header = binary.LittleEndian.AppendUint32(header, bits)
+	return riffChunk("VP8L", header)
+}
+
+func webpFile(chunks ...[]byte) []byte {
+	return wrapWebP(bytes.Join(chunks, nil))
+}
+
+func encodeGIF(t *testing.T, sizes ...image.Rectangle) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{Config: image.Config{ColorModel: palette, Width: 40, Height: 30}}
+	for _, size := range sizes {
+		g.Image = append(g.Image, image.NewPaletted(size, palette))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("failed to encode GIF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestScanGIFFrames(t *testing.T) {
+	animated := encodeGIF(t, image.Rect(0, 0, 40, 30), image.Rect(5, 5, 15, 25), image.Rect(0, 0, 40, 30))
+	still := encodeGIF(t, image.Rect(0, 0, 40, 30))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    imageFrames
+		wantErr string
+	}{
+		{name: "still", data: still, want: imageFrames{Count: 1, Pixels: 1200}},
+		{name: "animated", data: animated, want: imageFrames{Count: 3, Pixels: 1200 + 200 + 1200}},
+		{name: "missing trailer", data: animated[:len(animated)-1], want: imageFrames{Count: 3, Pixels: 2600}},
+		{name: "truncated frame", data: animated[:len(animated)-20], wantErr: "truncated GIF"},
+		{name: "truncated header", data: animated[:10], wantErr: "truncated GIF"},
+		{name: "invalid block", data: append(append([]byte{}, still[:len(still)-1]...), 0x99), wantErr: "invalid GIF block"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scanGIFFrames(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("scanGIFFrames() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("scanGIFFrames() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("scanGIFFrames() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWebPAnimation(t *testing.T) {
+	frame := vp8lChunk(4, 4)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *webpAnimation
+		wantErr string
+	}{
+		{name: "not webp", data: []byte("GIF89a"), wantErr: "not a WebP file"},
+		{name: "still", data: webpFile(vp8lChunk(4, 4))},
+		{name: "extended still", data: webpFile(vp8xChunk(4, 4, false), vp8lChunk(4, 4))},
+		{
+			name: "animated",
+			data: webpFile(vp8xChunk(20, 10, true), riffChunk("ANIM", make([]byte, 6)),
+				anmfChunk(0, 0, 4, 4, 0x00, frame), anmfChunk(6, 2, 4, 4, 0x03, frame)),
+			want: &webpAnimation{Width: 20, Height: 10, Frames: []webpFrame{
+				{X: 0, Y: 0, Width: 4, Height: 4, Blend: true, Dispose: false, Data: frame},
+				{X: 6, Y: 2, Width: 4, Height: 4, Blend: false, Dispose: true, Data: frame},
+			}},
+		},
+		{
+			name: "odd chunk padding",
+			data: webpFile(vp8xChunk(4, 4, true), riffChunk("EXIF", []byte{1, 2, 3}), anmfChunk(0, 0, 4, 4, 0, frame)),
+			want: &webpAnimation{Width: 4, Height: 4, Frames: []webpFrame{
+				{Width: 4, Height: 4, Blend: true, Data: frame},
+			}},
+		},
+		{name: "no frames", data: webpFile(vp8xChunk(4, 4, true)), wantErr: "has no frames"},
+		{name: "frame without header", data: webpFile(anmfChunk(0, 0, 4, 4, 0, frame)), wantErr: "invalid WebP ANMF chunk"},
+		{name: "short frame", data: webpFile(vp8xChunk(4, 4, true), riffChunk("ANMF", make([]byte, 8))),
+			wantErr: "invalid WebP ANMF chunk"},
+		{name: "short header", data: webpFile(riffChunk("VP8X", make([]byte, 4))), wantErr: "invalid WebP VP8X chunk"},
+		{name: "truncated chunk", data: webpFile(vp8xChunk(4, 4, true), anmfChunk(0, 0, 4, 4, 0, frame))[:40],
+			wantErr: "truncated WebP chunk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWebPAnimation(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseWebPAnimation() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseWebPAnimation() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWebPAnimation() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebPFrameSizeMismatch(t *testing.T) {
+	// A frame declaring 2x2 in its ANMF chunk whose bitstream claims 16383x16383
+	data := webpFile(vp8xChunk(2, 2, true), anmfChunk(0, 0, 2, 2, 0, vp8lChunk(16383, 16383)))
+	frames, err := scanFrames(data, 2, 2)
+	if err != nil {
+		t.Fatalf("scanFrames() error = %v", err)
+	}
+	if frames.Pixels != 4 {
+		t.Fatalf("scanFrames() pixels = %d, want 4", frames.Pixels)
+	}
+	if err := decodeAllFrames(data); err == nil || !strings.Contains(err.Error(), "ANMF chunk declares 2x2") {
+		t.Fatalf("decodeAllFrames() error = %v, want a size mismatch", err)
+	}
+	if _, err := decodeKeyFrames(data, 4); err == nil || !strings.Contains(err.Error(), "ANMF chunk declares 2x2") {
+		t.Fatalf("decodeKeyFrames() error = %v, want a size mismatch", err)
+	}
+}
+
+func TestKeyFrameIndexes(t *testing.T) {
+	tests := []struct {
+		count, maxFrames int
+		want             []int
+	}{
+		{count: 1, maxFrames: 4, want: []int{0}},
+		{count: 3, maxFrames: 4, want: []int{0, 1, 2}},
+		{count: 4, maxFrames: 4, want: []int{0, 1, 2, 3}},
+		{count: 10, maxFrames: 4, want: []int{0, 2, 5, 7}},
+		{count: 10, maxFrames: 1, want: []int{0}},
+		{count: 10, maxFrames: 0, want: []int{0}},
+	}
+	for _, tt := range tests {
+		got := keyFrameIndexes(tt.count, tt.maxFrames)
+		want := make(map[int]bool, len(tt.want))
+		for _, i := range tt.want {
+			want[i] = true
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("keyFrameIndexes(%d, %d) = %v, want %v", tt.count, tt.maxFrames, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"image-rag-backend/internal/models"
+)
+
+// pHashSize is the side of the grayscale thumbnail transformed by the pHash DCT
+const pHashSize = 32
+
+// ImageHashes are the perceptual hashes of an image. Visually similar images have hashes
+// a small Hamming distance apart, however they were resized or re-encoded.
+type ImageHashes struct {
+	// PHash compares the low frequencies of the image's discrete cosine transform
+	PHash models.PerceptualHash
+	// DHash compares the brightness of horizontally adjacent cells
+	DHash models.PerceptualHash
+}
+
+// ComputeImageHashes decodes the image read from r and returns its perceptual hashes; animations
+// are hashed by their first frame
+func ComputeImageHashes(r io.Reader) (*ImageHashes, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return &ImageHashes{PHash: pHash(img), DHash: dHash(img)}, nil
+}
+
+// HammingDistance is the number of bits that differ between two hashes
+func HammingDistance(a, b models.PerceptualHash) int {
+	return bits.OnesCount64(uint64(a) ^ uint64(b))
+}
+
+// pHash sets a bit for each of the 8x8 lowest DCT frequencies of a 32x32 grayscale thumbnail
+// that is above the median of those frequencies, ignoring the DC term which only carries brightness
+func pHash(img image.Image) models.PerceptualHash {
+	pixels := grayThumbnail(img, pHashSize, pHashSize)
+
+	// The 2-D DCT is separable: transform the rows, then the columns of the result
+	var cosines [8][pHashSize]float64
+	for u := 0; u < 8; u++ {
+		for x := 0; x < pHashSize; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * pHashSize))
+		}
+	}
+	var rows [pHashSize][8]float64
+	for y := 0; y < pHashSize; y++ {
+		for u := 0; u < 8; u++ {
+			sum := 0.0
+			for x := 0; x < pHashSize; x++ {
+				sum += pixels[y*pHashSize+x] * cosines[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+	var coefficients [64]float64
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			sum := 0.0
+			for y := 0; y < pHashSize; y++ {
+				sum += rows[y][u] * cosines[v][y]
+			}
+			coefficients[v*8+u] = sum
+		}
+	}
+
+	ac := append([]float64(nil), coefficients[1:]...)
+	sort.Float64s(ac)
+	median := ac[len(ac)/2]
+
+	var hash uint64
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << uint(63-i)
+		}
+	}
+	return models.PerceptualHash(hash)
+}
+
+// dHash sets a bit for each cell of a 9x8 grayscale thumbnail that is darker than its right neighbour
+func dHash(img image.Image) models.PerceptualHash {
+	pixels := grayThumbnail(img, 9, 8)
+
+	var hash uint64
+	bit := 63
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if pixels[y*9+x] < pixels[y*9+x+1] {
+				hash |= 1 << uint(bit)
+			}
+			bit--
+		}
+	}
+	return models.PerceptualHash(hash)
+}
+
+// grayThumbnail shrinks an image to width x height luminance values, row by row, averaging
+// the source pixels of each cell. Cells of images smaller than the thumbnail take the nearest pixel.
+func grayThumbnail(img image.Image, width, height int) []float64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	sums := make([]float64, width*height)
+	counts := make([]int, width*height)
+	if w == 0 || h == 0 {
+		return sums
+	}
+
+	for y := 0; y < h; y++ {
+		row := y * height / h * width
+		for x := 0; x < w; x++ {
+			cell := row + x*width/w
+			sums[cell] += luminance(img, bounds.Min.X+x, bounds.Min.Y+y)
+			counts[cell]++
+		}
+	}
+
+	for cy := 0; cy < height; cy++ {
+		for cx := 0; cx < width; cx++ {
+			cell := cy*width + cx
+			if counts[cell] > 0 {
+				sums[cell] /= float64(counts[cell])
+			} else {
+				sums[cell] = luminance(img, bounds.Min.X+cx*w/width, bounds.Min.Y+cy*h/height)
+			}
+		}
+	}
+	return sums
+}
+
+// luminance returns the brightness of a pixel in [0, 255], reading the luma plane
+// directly for the JPEG and grayscale images that make up most uploads
+func luminance(img image.Image, x, y int) float64 {
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return float64(m.Y[m.YOffset(x, y)])
+	case *image.Gray:
+		return float64(m.Pix[m.PixOffset(x, y)])
+	}
+	r, g, b, _ := img.At(x, y).RGBA()
+	return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+}
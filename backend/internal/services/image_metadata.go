@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"gorm.io/gorm"
+
+	"image-rag-backend/internal/models"
+)
+
+// maxEXIFSize bounds the EXIF chunk read from PNG and WebP files
+const maxEXIFSize = 1 << 20
+
+// ExtractImageMetadata reads the size, content type, dimensions, color mode, frame count and
+// EXIF tags of an image file. Parts that cannot be read are left empty; r is left at an arbitrary offset.
+func ExtractImageMetadata(r io.ReadSeeker, size int64) (models.ImageMetadata, error) {
+	metadata := models.ImageMetadata{Size: size}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return metadata, fmt.Errorf("failed to read file: %w", err)
+	}
+	metadata.MimeType = sniffImageType(head[:n])
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return metadata, fmt.Errorf("failed to rewind file: %w", err)
+	}
+	if config, _, err := image.DecodeConfig(r); err == nil {
+		metadata.Width, metadata.Height = config.Width, config.Height
+		metadata.ColorMode = colorModeName(config.ColorModel)
+	}
+
+	if metadata.MimeType == "image/gif" || metadata.MimeType == "image/webp" {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return metadata, fmt.Errorf("failed to rewind file: %w", err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return metadata, fmt.Errorf("failed to read file: %w", err)
+		}
+		if frames, err := scanFrames(data, metadata.Width, metadata.Height); err == nil && frames.Count > 1 {
+			metadata.FrameCount = frames.Count
+		}
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return metadata, fmt.Errorf("failed to rewind file: %w", err)
+	}
+	if x := readEXIF(r, metadata.MimeType); x != nil {
+		applyEXIF(&metadata, x)
+	}
+	return metadata, nil
+}
+
+// colorModeName names the color model an image decodes to
+func colorModeName(model color.Model) string {
+	switch model {
+	case color.GrayModel, color.Gray16Model:
+		return "gray"
+	case color.YCbCrModel, color.RGBAModel, color.RGBA64Model:
+		return "rgb"
+	case color.NRGBAModel, color.NRGBA64Model, color.NYCbCrAModel, color.AlphaModel, color.Alpha16Model:
+		return "rgba"
+	case color.CMYKModel:
+		return "cmyk"
+	}
+	if _, ok := model.(color.Palette); ok {
+		return "indexed"
+	}
+	return ""
+}
+
+// readEXIF parses the EXIF block of a JPEG, PNG, WebP or TIFF file; nil when there is none
+func readEXIF(r io.Reader, mimeType string) *exif.Exif {
+	var x *exif.Exif
+	var err error
+	switch mimeType {
+	case "image/jpeg", "image/tiff":
+		// A TIFF file's own directory holds its EXIF tags
+		x, err = exif.Decode(r)
+	case "image/png":
+		var raw []byte
+		if raw, err = pngEXIFChunk(r); err == nil {
+			x, err = exif.Decode(bytes.NewReader(raw))
+		}
+	case "image/webp":
+		var raw []byte
+		if raw, err = webpEXIFChunk(r); err == nil {
+			x, err = exif.Decode(bytes.NewReader(raw))
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	return x
+}
+
+// pngEXIFChunk returns the content of a PNG file's eXIf chunk
+func pngEXIFChunk(r io.Reader) ([]byte, error) {
+	signature := make([]byte, 8)
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return nil, err
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		switch string(header[4:]) {
+		case "eXIf":
+			return readChunk(r, length)
+		case "IDAT", "IEND":
+			// eXIf must precede the image data
+			return nil, fmt.Errorf("no EXIF chunk")
+		}
+		// Skip the chunk data and its CRC
+		if _, err := io.CopyN(io.Discard, r, int64(length)+4); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// webpEXIFChunk returns the content of a WebP file's EXIF chunk
+func webpEXIFChunk(r io.Reader) ([]byte, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WEBP" {
+		return nil, fmt.Errorf("not a WebP file")
+	}
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, err
+		}
+		length := binary.LittleEndian.Uint32(chunk[4:])
+		if string(chunk[:4]) == "EXIF" {
+			return readChunk(r, length)
+		}
+		// Chunks are padded to an even size
+		if _, err := io.CopyN(io.Discard, r, int64(length)+int64(length&1)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readChunk(r io.Reader, length uint32) ([]byte, error) {
+	if length > maxEXIFSize {
+		return nil, fmt.Errorf("EXIF chunk too large")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// applyEXIF copies the camera, capture time, location and orientation tags into the metadata
+func applyEXIF(metadata *models.ImageMetadata, x *exif.Exif) {
+	metadata.CameraMake = exifString(x, exif.Make)
+	metadata.CameraModel = exifString(x, exif.Model)
+	metadata.CapturedAt = exifCaptureTime(x)
+	if lat, long, err := x.LatLong(); err == nil {
+		metadata.GPSLatitude, metadata.GPSLongitude = &lat, &long
+	}
+	metadata.Orientation = exifOrientation(x)
+}
+
+// exifOrientation reads the orientation tag, 1 (upright) to 8; zero when it is missing or invalid
+func exifOrientation(x *exif.Exif) int {
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 0
+	}
+	orientation, err := tag.Int(0)
+	if err != nil || orientation < 1 || orientation > 8 {
+		return 0
+	}
+	return orientation
+}
+
+// exifCaptureTime reads the original capture time, falling back to the modification time.
+// EXIF times carry no zone, so the camera's wall clock is taken as UTC.
+func exifCaptureTime(x *exif.Exif) *time.Time {
+	value := exifString(x, exif.DateTimeOriginal)
+	if value == "" {
+		value = exifString(x, exif.DateTime)
+	}
+	capturedAt, err := time.Parse("2006:01:02 15:04:05", value)
+	if err != nil {
+		return nil
+	}
+	return &capturedAt
+}
+
+// exifString reads an ASCII tag, dropping the padding cameras leave around it
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return truncateText(strings.TrimSpace(strings.Trim(value, "\x00")), 128)
+}
+
+// ImageMetadataFilter restricts images by their extracted metadata; unset fields do not restrict
+type ImageMetadataFilter struct {
+	MinWidth       *int
+	MinHeight      *int
+	MimeType       string
+	CapturedAfter  *time.Time
+	CapturedBefore *time.Time
+}
+
+// IsZero reports whether the filter lets every image through
+func (f ImageMetadataFilter) IsZero() bool {
+	return f.MinWidth == nil && f.MinHeight == nil && f.MimeType == "" &&
+		f.CapturedAfter == nil && f.CapturedBefore == nil
+}
+
+// Match reports whether an image passes the filter
+func (f ImageMetadataFilter) Match(image *models.Image) bool {
+	m := image.Metadata
+	if f.MinWidth != nil && m.Width < *f.MinWidth {
+		return false
+	}
+	if f.MinHeight != nil && m.Height < *f.MinHeight {
+		return false
+	}
+	if f.MimeType != "" && m.MimeType != f.MimeType {
+		return false
+	}
+	if f.CapturedAfter != nil && (m.CapturedAt == nil || m.CapturedAt.Before(*f.CapturedAfter)) {
+		return false
+	}
+	if f.CapturedBefore != nil && (m.CapturedAt == nil || !m.CapturedAt.Before(*f.CapturedBefore)) {
+		return false
+	}
+	return true
+}
+
+// apply adds the filter's conditions to a query over the images table
+func (f ImageMetadataFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.MinWidth != nil {
+		query = query.Where("images.width >= ?", *f.MinWidth)
+	}
+	if f.MinHeight != nil {
+		query = query.Where("images.height >= ?", *f.MinHeight)
+	}
+	if f.MimeType != "" {
+		query = query.Where("images.mime_type = ?", f.MimeType)
+	}
+	if f.CapturedAfter != nil {
+		query = query.Where("images.captured_at >= ?", *f.CapturedAfter)
+	}
+	if f.CapturedBefore != nil {
+		query = query.Where("images.captured_at < ?", *f.CapturedBefore)
+	}
+	return query
+}
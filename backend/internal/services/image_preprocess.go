@@ -0,0 +1,275 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+
+	"image-rag-backend/internal/config"
+)
+
+// Fit modes of the preprocessor
+const (
+	FitNone = "none"
+	FitCrop = "crop"
+	FitPad  = "pad"
+)
+
+// ImagePreprocessor normalizes images before they are embedded: it applies the EXIF orientation,
+// optionally crops or pads to a square, downscales to a maximum edge and re-encodes the pixels
+// alone, which drops every metadata block. Corpus and query images must go through the same
+// preprocessor for their vectors to be comparable. Formats the embedding API does not take, and
+// the frames of animations, are always re-encoded, as PNG when preprocessing is disabled.
+type ImagePreprocessor struct {
+	config config.PreprocessConfig
+}
+
+func NewImagePreprocessor(cfg config.PreprocessConfig) (*ImagePreprocessor, error) {
+	// Animations are split into frames whether or not the rest of preprocessing is enabled
+	if cfg.MaxFrames < 1 {
+		return nil, fmt.Errorf("invalid preprocess max frames %d", cfg.MaxFrames)
+	}
+	if !cfg.Enabled {
+		return &ImagePreprocessor{config: cfg}, nil
+	}
+	switch cfg.Format {
+	case "jpeg", "png":
+	default:
+		return nil, fmt.Errorf("invalid preprocess format %q: expected jpeg or png", cfg.Format)
+	}
+	switch cfg.Fit {
+	case FitNone, FitCrop, FitPad:
+	default:
+		return nil, fmt.Errorf("invalid preprocess fit %q: expected none, crop or pad", cfg.Fit)
+	}
+	if cfg.MaxEdge < 0 {
+		return nil, fmt.Errorf("invalid preprocess max edge %d", cfg.MaxEdge)
+	}
+	if cfg.Format == "jpeg" && (cfg.Quality < 1 || cfg.Quality > 100) {
+		return nil, fmt.Errorf("invalid preprocess JPEG quality %d: expected 1 to 100", cfg.Quality)
+	}
+	return &ImagePreprocessor{config: cfg}, nil
+}
+
+// Transform describes the preprocessing applied, e.g. "orient;fit=none;max_edge=1024;format=jpeg;quality=90".
+// It is recorded with each image so vectors made under another transform can be told apart;
+// it is empty when images are embedded as uploaded.
+func (p *ImagePreprocessor) Transform() string {
+	if !p.config.Enabled {
+		return ""
+	}
+	transform := fmt.Sprintf("orient;fit=%s;max_edge=%d;format=%s", p.config.Fit, p.config.MaxEdge, p.config.Format)
+	if p.config.Format == "jpeg" {
+		transform += fmt.Sprintf(";quality=%d", p.config.Quality)
+	}
+	return transform
+}
+
+// embeddableFormats are the formats the embedding API takes as they are
+var embeddableFormats = map[string]bool{"jpeg": true, "png": true, "webp": true}
+
+// Process returns the image to embed and its format, e.g. "jpeg"; animations give their first
+// frame. format is the format of data and is passed through when preprocessing is disabled.
+func (p *ImagePreprocessor) Process(data []byte, format string) ([]byte, string, error) {
+	frames, format, err := p.process(data, format, 1)
+	if err != nil {
+		return nil, "", err
+	}
+	return frames[0], format, nil
+}
+
+// KeyFrames returns the frames to embed and their format: up to the configured number of key
+// frames of an animated GIF or WebP, or the single frame Process returns for a still image
+func (p *ImagePreprocessor) KeyFrames(data []byte, format string) ([][]byte, string, error) {
+	return p.process(data, format, p.config.MaxFrames)
+}
+
+func (p *ImagePreprocessor) process(data []byte, format string, maxFrames int) ([][]byte, string, error) {
+	if !p.config.Enabled && embeddableFormats[format] {
+		if frames, err := scanFrames(data, 0, 0); err == nil && frames.Count <= 1 {
+			return [][]byte{data}, format, nil
+		}
+	}
+
+	images, err := decodeKeyFrames(data, maxFrames)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	orientation := 0
+	if x := readEXIF(bytes.NewReader(data), sniffImageType(data)); x != nil {
+		orientation = exifOrientation(x)
+	}
+
+	frames := make([][]byte, len(images))
+	for i, img := range images {
+		if p.config.Enabled {
+			img = p.normalize(img, orientation)
+		}
+		if frames[i], err = p.encode(img); err != nil {
+			return nil, "", fmt.Errorf("failed to encode image: %w", err)
+		}
+	}
+	return frames, p.outputFormat(), nil
+}
+
+// normalize applies the orientation, fit and maximum edge to an image
+func (p *ImagePreprocessor) normalize(img image.Image, orientation int) image.Image {
+	// Crop and scale before rotating so the per-pixel rotation runs on the small image;
+	// both commute with the EXIF transforms
+	if p.config.Fit == FitCrop {
+		img = centerSquare(img)
+	}
+	img = downscale(img, p.config.MaxEdge)
+	if p.config.Fit == FitPad {
+		img = padSquare(img)
+	}
+	return orient(img, orientation)
+}
+
+// outputFormat is the format images are re-encoded to
+func (p *ImagePreprocessor) outputFormat() string {
+	if !p.config.Enabled {
+		return "png"
+	}
+	return p.config.Format
+}
+
+func (p *ImagePreprocessor) encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch p.outputFormat() {
+	case "png":
+		err = png.Encode(&buf, img)
+	default:
+		err = jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: p.config.Quality})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// imageFormat names the format of an image file from its extension, defaulting to jpeg
+func imageFormat(filename string) string {
+	if contentType, ok := imageContentTypes[strings.ToLower(filepath.Ext(filename))]; ok {
+		return strings.TrimPrefix(contentType, "image/")
+	}
+	return "jpeg"
+}
+
+// centerSquare crops the largest centered square out of an image
+func centerSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x, y := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+	square := image.Rect(x, y, x+side, y+side)
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(square)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, square.Min, draw.Src)
+	return dst
+}
+
+// padSquare centers an image on a black square canvas
+func padSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	if b.Dx() == b.Dy() {
+		return img
+	}
+	side := b.Dx()
+	if b.Dy() > side {
+		side = b.Dy()
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	offset := image.Pt((side-b.Dx())/2, (side-b.Dy())/2)
+	draw.Draw(dst, b.Sub(b.Min).Add(offset), img, b.Min, draw.Src)
+	return dst
+}
+
+// downscale shrinks an image so its longest edge is at most maxEdge; zero leaves it as is
+func downscale(img image.Image, maxEdge int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxEdge <= 0 || (w <= maxEdge && h <= maxEdge) {
+		return img
+	}
+	if w >= h {
+		w, h = maxEdge, (h*maxEdge+w/2)/w
+	} else {
+		w, h = (w*maxEdge+h/2)/h, maxEdge
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// orient turns an image stored with the given EXIF orientation upright
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Orientations 5 to 8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = dw-1-x, y
+			case 3: // rotated 180
+				sx, sy = dw-1-x, dh-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, dh-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // needs a 90 degree clockwise turn
+				sx, sy = y, dw-1-x
+			case 7: // transversed
+				sx, sy = dh-1-y, dw-1-x
+			case 8: // needs a 90 degree counterclockwise turn
+				sx, sy = dh-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// flatten composites an image over white, since JPEG has no transparency
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/draw"
+
+	"image-rag-backend/internal/blobstore"
+	"image-rag-backend/internal/config"
+	"image-rag-backend/internal/models"
+)
+
+// Fit modes of an image transform with both a width and a height
+const (
+	// TransformFitContain scales the image to fit inside the box, keeping its aspect ratio
+	TransformFitContain = "contain"
+	// TransformFitCover scales the image to fill the box, cropping what overflows around the center
+	TransformFitCover = "cover"
+	// TransformFitFill stretches the image to the box
+	TransformFitFill = "fill"
+)
+
+// rotateOrientations maps clockwise rotations to the EXIF orientations orient applies them with
+var rotateOrientations = map[int]int{0: 1, 90: 6, 180: 3, 270: 8}
+
+// ImageTransform describes a rendition of a stored image. Steps run in field order on the
+// upright image: crop, rotate, resize, encode. Zero values skip a step.
+type ImageTransform struct {
+	// Crop is a rectangle of the upright image, with its origin at the top left
+	Crop image.Rectangle
+	// Rotate turns the image clockwise by 90, 180 or 270 degrees
+	Rotate int
+	// Width and Height are the output size; with only one, the other follows the aspect ratio
+	Width, Height int
+	// Fit is how the image meets a box of Width and Height: contain, cover or fill
+	Fit string
+	// Format is jpeg or png
+	Format string
+	// Quality is the JPEG quality, 1 to 100
+	Quality int
+}
+
+// String is the canonical form of a transform, identifying its output
+func (t ImageTransform) String() string {
+	s := fmt.Sprintf("crop=%d,%d,%d,%d;rotate=%d;w=%d;h=%d;fit=%s;format=%s", t.Crop.Min.X, t.Crop.Min.Y,
+		t.Crop.Dx(), t.Crop.Dy(), t.Rotate, t.Width, t.Height, t.Fit, t.Format)
+	if t.Format == "jpeg" {
+		s += ";q=" + strconv.Itoa(t.Quality)
+	}
+	return s
+}
+
+// ContentType is the media type of the transform's output
+func (t ImageTransform) ContentType() string {
+	return "image/" + t.Format
+}
+
+// TransformService renders crops, resizes, rotations and format conversions of stored images.
+// Outputs are bounded in size and kept in a disk cache of bounded size.
+type TransformService struct {
+	blobs  blobstore.Store
+	config config.TransformConfig
+	cache  *transformCache
+}
+
+func NewTransformService(blobs blobstore.Store, cfg config.TransformConfig) (*TransformService, error) {
+	if cfg.MaxEdge < 1 {
+		return nil, fmt.Errorf("invalid transform max edge %d: expected at least 1", cfg.MaxEdge)
+	}
+	if cfg.Quality < 1 || cfg.Quality > 100 {
+		return nil, fmt.Errorf("invalid transform JPEG quality %d: expected 1 to 100", cfg.Quality)
+	}
+	s := &TransformService{blobs: blobs, config: cfg}
+	if cfg.CacheDir != "" && cfg.CacheMaxMB > 0 {
+		cache, err := newTransformCache(cfg.CacheDir, cfg.CacheMaxMB<<20)
+		if err != nil {
+			return nil, err
+		}
+		s.cache = cache
+	}
+	return s, nil
+}
+
+// CacheMaxAge is how long clients may cache transformed images
+func (s *TransformService) CacheMaxAge() time.Duration {
+	return s.config.CacheMaxAge
+}
+
+// Normalize checks a transform against the limits and fills in its defaults.
+// Errors start with "invalid transform".
+func (s *TransformService) Normalize(t ImageTransform) (ImageTransform, error) {
+	if t.Crop != (image.Rectangle{}) && (t.Crop.Min.X < 0 || t.Crop.Min.Y < 0 || t.Crop.Empty()) {
+		return t, fmt.Errorf("invalid transform: crop needs a positive width and height inside the image")
+	}
+	if _, ok := rotateOrientations[t.Rotate]; !ok {
+		return t, fmt.Errorf("invalid transform: rotate must be 0, 90, 180 or 270")
+	}
+	if t.Width < 0 || t.Height < 0 || t.Width > s.config.MaxEdge || t.Height > s.config.MaxEdge {
+		return t, fmt.Errorf("invalid transform: w and h must be 1 to %d", s.config.MaxEdge)
+	}
+
+	switch t.Fit {
+	case "":
+		t.Fit = TransformFitContain
+	case TransformFitContain:
+	case TransformFitCover, TransformFitFill:
+		if t.Width == 0 || t.Height == 0 {
+			return t, fmt.Errorf("invalid transform: fit %s needs both w and h", t.Fit)
+		}
+	default:
+		return t, fmt.Errorf("invalid transform: fit must be contain, cover or fill")
+	}
+
+	switch t.Format {
+	case "", "jpg", "jpeg":
+		t.Format = "jpeg"
+		if t.Quality == 0 {
+			t.Quality = s.config.Quality
+		}
+		if t.Quality < 1 || t.Quality > 100 {
+			return t, fmt.Errorf("invalid transform: quality must be 1 to 100")
+		}
+	case "png":
+		// PNG is lossless, so quality does not apply
+		t.Quality = 0
+	default:
+		return t, fmt.Errorf("invalid transform: format must be jpeg or png")
+	}
+	return t, nil
+}
+
+// ETag is the entity tag of a transform of an image. Image files never change, so the tag
+// only depends on the file and the transform.
+func (s *TransformService) ETag(img *models.Image, t ImageTransform) string {
+	return strconv.Quote(transformCacheKey(img.Path, t)[:32])
+}
+
+// Transform renders a normalized transform of an image, from the cache when it was rendered before
+func (s *TransformService) Transform(ctx context.Context, img *models.Image, t ImageTransform) ([]byte, error) {
+	key := transformCacheKey(img.Path, t)
+	if s.cache != nil {
+		if data, ok := s.cache.get(key); ok {
+			return data, nil
+		}
+	}
+
+	data, err := s.render(ctx, img.Path, t)
+	if err != nil {
+		return nil, err
+	}
+	if s.cache != nil {
+		// A failed write only costs the next request another render
+		if err := s.cache.put(key, data); err != nil {
+			fmt.Printf("Warning: failed to cache transform of %s: %v\n", img.Path, err)
+		}
+	}
+	return data, nil
+}
+
+// transformCacheKey names the output of a transform of an image file
+func transformCacheKey(imageKey string, t ImageTransform) string {
+	sum := sha256.Sum256([]byte(imageKey + "|" + t.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *TransformService) render(ctx context.Context, key string, t ImageTransform) ([]byte, error) {
+	reader, _, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return nil, fmt.Errorf("image file not found")
+		}
+		return nil, err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+
+	img, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if x := readEXIF(bytes.NewReader(data), sniffImageType(data)); x != nil {
+		img = orient(img, exifOrientation(x))
+	}
+
+	if t.Crop != (image.Rectangle{}) {
+		b := img.Bounds()
+		crop := t.Crop.Add(b.Min)
+		if !crop.In(b) {
+			return nil, fmt.Errorf("invalid transform: crop %dx%d at %d,%d is outside the %dx%d image",
+				t.Crop.Dx(), t.Crop.Dy(), t.Crop.Min.X, t.Crop.Min.Y, b.Dx(), b.Dy())
+		}
+		cropped := image.NewNRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+		draw.Draw(cropped, cropped.Bounds(), img, crop.Min, draw.Src)
+		img = cropped
+	}
+	img = orient(img, rotateOrientations[t.Rotate])
+	img = s.resize(img, t)
+
+	var buf bytes.Buffer
+	if t.Format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: t.Quality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transformed image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// resize scales an image to the transform's size and fit. Missing sides are bounded by the maximum
+// edge, so every output fits in a square of that size.
+func (s *TransformService) resize(img image.Image, t ImageTransform) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	boxW, boxH := t.Width, t.Height
+	if boxW == 0 {
+		boxW = s.config.MaxEdge
+	}
+	if boxH == 0 {
+		boxH = s.config.MaxEdge
+	}
+
+	src := b
+	switch {
+	case t.Fit == TransformFitFill:
+	case t.Fit == TransformFitCover:
+		// Cut the source to the box's aspect ratio around its center
+		if w*boxH > h*boxW {
+			cw := (h*boxW + boxH/2) / boxH
+			src = image.Rect(b.Min.X+(w-cw)/2, b.Min.Y, b.Min.X+(w-cw)/2+cw, b.Max.Y)
+		} else {
+			ch := (w*boxH + boxW/2) / boxW
+			src = image.Rect(b.Min.X, b.Min.Y+(h-ch)/2, b.Max.X, b.Min.Y+(h-ch)/2+ch)
+		}
+	default:
+		// Contain: the side that fits the box more tightly sets the scale
+		if w*boxH > h*boxW {
+			boxH = (h*boxW + w/2) / w
+		} else {
+			boxW = (w*boxH + h/2) / h
+		}
+		if boxW < 1 {
+			boxW = 1
+		}
+		if boxH < 1 {
+			boxH = 1
+		}
+		// Without a requested size, only images past the maximum edge are scaled
+		if t.Width == 0 && t.Height == 0 && boxW >= w && boxH >= h {
+			return img
+		}
+	}
+	if src == b && w == boxW && h == boxH {
+		return img
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, boxW, boxH))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"image-rag-backend/internal/config"
+)
+
+// imageContentTypes maps the extensions of supported image files to the content type their bytes must have
+var imageContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+	".gif":  "image/gif",
+	".bmp":  "image/bmp",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+}
+
+// ImageValidator checks uploaded images against the upload limits before anything is stored or embedded.
+// Its errors start with "unsupported image type", "file too large", "image too large" or "invalid image".
+type ImageValidator struct {
+	config config.UploadConfig
+}
+
+func NewImageValidator(cfg config.UploadConfig) *ImageValidator {
+	return &ImageValidator{config: cfg}
+}
+
+// MaxRequestBytes is the largest request body accepted by upload and search endpoints; zero means no limit
+func (v *ImageValidator) MaxRequestBytes() int64 {
+	if v.config.MaxRequestSizeMB <= 0 {
+		return 0
+	}
+	return v.config.MaxRequestSizeMB << 20
+}
+
+// Validate checks an uploaded file: its extension, its size, that its bytes are an image of the
+// type the extension names, and that every frame decodes within the pixel limit. r is rewound.
+func (v *ImageValidator) Validate(r io.ReadSeeker, filename string, size int64) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !v.config.AllowedExt[ext] || imageContentTypes[ext] == "" {
+		return fmt.Errorf("unsupported image type: extension %q is not allowed", ext)
+	}
+	_, err := v.validate(r, size, imageContentTypes[ext])
+	return err
+}
+
+// ValidateBase64 decodes and checks a base64 image, optionally wrapped in a data URL. format names
+// the expected type, e.g. "png"; when empty any supported type is accepted. It returns the
+// format of the decoded image.
+func (v *ImageValidator) ValidateBase64(data, format string) (string, error) {
+	decoded, err := decodeBase64Image(data)
+	if err != nil {
+		return "", err
+	}
+
+	expected := ""
+	if format != "" {
+		ext := "." + strings.ToLower(format)
+		if !v.config.AllowedExt[ext] || imageContentTypes[ext] == "" {
+			return "", fmt.Errorf("unsupported image type: format %q is not allowed", format)
+		}
+		expected = imageContentTypes[ext]
+	}
+	contentType, err := v.validate(bytes.NewReader(decoded), int64(len(decoded)), expected)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(contentType, "image/"), nil
+}
+
+// validate checks the size and content of an image, requiring the expected content type unless it
+// is empty, and returns the sniffed content type
+func (v *ImageValidator) validate(r io.ReadSeeker, size int64, expected string) (string, error) {
+	if limit := v.maxFileBytes(); limit > 0 && size > limit {
+		return "", fmt.Errorf("file too large: %d bytes exceeds the %d MB limit", size, v.config.MaxSizeMB)
+	}
+
+	// The size was checked, so the file can be held in memory for the frame checks
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	contentType := sniffImageType(data)
+	if !v.allowsContentType(contentType) {
+		return "", fmt.Errorf("unsupported image type: content is %s", contentType)
+	}
+	if expected != "" && contentType != expected {
+		return "", fmt.Errorf("unsupported image type: content is %s, not %s", contentType, expected)
+	}
+
+	// Check the dimensions from the header before decoding allocates memory for every pixel
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("invalid image: %v", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return "", fmt.Errorf("invalid image: %dx%d has no pixels", cfg.Width, cfg.Height)
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); v.config.MaxPixels > 0 && pixels > v.config.MaxPixels {
+		return "", fmt.Errorf("image too large: %dx%d exceeds the %d pixel limit", cfg.Width, cfg.Height,
+			v.config.MaxPixels)
+	}
+
+	// Animations decode every frame, so their frames count against the limit together
+	frames, err := scanFrames(data, cfg.Width, cfg.Height)
+	if err != nil {
+		return "", fmt.Errorf("invalid image: %v", err)
+	}
+	if v.config.MaxPixels > 0 && frames.Pixels > v.config.MaxPixels {
+		return "", fmt.Errorf("image too large: %d frames of %dx%d exceed the %d pixel limit", frames.Count,
+			cfg.Width, cfg.Height, v.config.MaxPixels)
+	}
+
+	if err := decodeAllFrames(data); err != nil {
+		return "", fmt.Errorf("invalid image: %v", err)
+	}
+	return contentType, rewind(r)
+}
+
+func (v *ImageValidator) maxFileBytes() int64 {
+	if v.config.MaxSizeMB <= 0 {
+		return 0
+	}
+	return v.config.MaxSizeMB << 20
+}
+
+// allowsContentType reports whether an allowed extension names the content type
+func (v *ImageValidator) allowsContentType(contentType string) bool {
+	for ext, allowed := range v.config.AllowedExt {
+		if allowed && imageContentTypes[ext] == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeBase64Image decodes base64 image data, optionally wrapped in a data URL
+func decodeBase64Image(data string) ([]byte, error) {
+	if i := strings.Index(data, "base64,"); i != -1 {
+		data = data[i+len("base64,"):]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: malformed base64 data")
+	}
+	return decoded, nil
+}
+
+func rewind(r io.Seeker) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"image-rag-backend/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksRefreshInterval is how long fetched JWKS keys are trusted before they are fetched again
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefreshInterval limits refetches triggered by tokens with unknown key IDs
+	jwksMinRefreshInterval = time.Minute
+	// jwtLeeway tolerates clock skew between the identity provider and this service
+	jwtLeeway = 30 * time.Second
+)
+
+// JWTIdentity is the user identity carried by a verified token
+type JWTIdentity struct {
+	Subject string
+	Name    string
+	Email   string
+	// Tenant is the tenant name from the tenant claim; empty when the claim is absent
+	Tenant string
+	Roles  []string
+}
+
+// JWTService verifies HS256 and RS256 bearer tokens issued by an SSO identity provider
+type JWTService struct {
+	config     config.JWTConfig
+	parser     *jwt.Parser
+	httpClient *http.Client
+
+	mu sync.RWMutex
+	// keys maps key IDs to RSA public keys; a PEM key file is stored under the empty ID
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	// fetchMu lets a single JWKS fetch run at a time, outside mu so verification never waits on it
+	fetchMu sync.Mutex
+}
+
+// jsonWebKey is one entry of a JWKS document
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// NewJWTService loads the configured verification keys. JWKS URLs are fetched eagerly
+// so a misconfigured identity provider fails at startup.
+func NewJWTService(cfg config.JWTConfig) (*JWTService, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	s := &JWTService{
+		config:     cfg,
+		parser:     jwt.NewParser(options...),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		keys:       make(map[string]*rsa.PublicKey),
+	}
+
+	if cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT key file: %w", err)
+		}
+		if err := s.loadKeys(data); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JWKSURL != "" {
+		if err := s.refreshJWKS(time.Time{}, true); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Enabled reports whether JWTs are accepted
+func (s *JWTService) Enabled() bool {
+	return s != nil && s.config.Enabled()
+}
+
+// LooksLikeJWT reports whether a credential has the three-part shape of a compact JWT
+func LooksLikeJWT(credential string) bool {
+	return strings.Count(credential, ".") == 2 && !strings.HasPrefix(credential, apiKeyPrefix)
+}
+
+// Verify checks a token's signature, expiry, issuer and audience and maps its claims to an identity
+func (s *JWTService) Verify(tokenString string) (*JWTIdentity, error) {
+	claims := jwt.MapClaims{}
+	if _, err := s.parser.ParseWithClaims(tokenString, claims, s.verificationKey); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("invalid token: missing sub claim")
+	}
+
+	identity := &JWTIdentity{Subject: subject, Roles: claimStrings(lookupClaim(claims, s.config.RolesClaim))}
+	identity.Name, _ = claims["name"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Tenant, _ = lookupClaim(claims, s.config.TenantClaim).(string)
+	return identity, nil
+}
+
+// verificationKey selects the key matching a token's algorithm and key ID
+func (s *JWTService) verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		if s.config.HMACSecret == "" {
+			return nil, fmt.Errorf("HS256 tokens are not accepted")
+		}
+		return []byte(s.config.HMACSecret), nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		return s.rsaKey(kid)
+	default:
+		return nil, fmt.Errorf("unsupported signing method: %s", token.Method.Alg())
+	}
+}
+
+func (s *JWTService) rsaKey(kid string) (*rsa.PublicKey, error) {
+	key, stale, fetchedAt := s.cachedKey(kid)
+	if s.config.JWKSURL != "" && stale {
+		if key != nil {
+			// The cached key stays valid while the JWKS is refreshed in the background
+			go s.refreshJWKS(fetchedAt, false)
+			return key, nil
+		}
+		// Unknown key IDs usually mean the provider rotated its keys
+		if err := s.refreshJWKS(fetchedAt, true); err != nil {
+			return nil, err
+		}
+		key, _, _ = s.cachedKey(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	return key, nil
+}
+
+// cachedKey returns the key with an ID, whether the JWKS should be refetched and when it was last fetched
+func (s *JWTService) cachedKey(kid string) (*rsa.PublicKey, bool, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := s.keys[kid]
+	if key == nil && len(s.keys) == 1 && kid == "" {
+		// Tokens without a key ID are accepted when there is only one key to choose from
+		for _, only := range s.keys {
+			key = only
+		}
+	}
+	if key == nil {
+		key = s.keys[""]
+	}
+
+	age := time.Since(s.fetchedAt)
+	stale := age > jwksRefreshInterval || (key == nil && age > jwksMinRefreshInterval)
+	return key, stale, s.fetchedAt
+}
+
+// refreshJWKS fetches the JWKS unless another request fetched it since fetchedAt. With wait
+// false it returns at once when a fetch is already running instead of queueing behind it.
+func (s *JWTService) refreshJWKS(fetchedAt time.Time, wait bool) error {
+	if wait {
+		s.fetchMu.Lock()
+	} else if !s.fetchMu.TryLock() {
+		return nil
+	}
+	defer s.fetchMu.Unlock()
+
+	s.mu.RLock()
+	current := s.fetchedAt
+	s.mu.RUnlock()
+	if !current.Equal(fetchedAt) {
+		return nil
+	}
+
+	keys, err := s.fetchJWKS()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Record the attempt even on failure so an unreachable provider is not hammered
+	s.fetchedAt = time.Now()
+	for kid, key := range keys {
+		s.keys[kid] = key
+	}
+	return err
+}
+
+func (s *JWTService) fetchJWKS() (map[string]*rsa.PublicKey, error) {
+	resp, err := s.httpClient.Get(s.config.JWKSURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	return parseJWKS(data)
+}
+
+// loadKeys adds the keys of a JWKS document or PEM public key
+func (s *JWTService) loadKeys(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse JWT key file: %w", err)
+		}
+		s.keys[""] = key
+		return nil
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	for kid, key := range keys {
+		s.keys[kid] = key
+	}
+	return nil
+}
+
+// parseJWKS extracts the RSA signing keys of a JWKS document
+func parseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range doc.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWKS key %s: invalid modulus", jwk.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("failed to parse JWKS key %s: invalid exponent", jwk.Kid)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("failed to parse JWKS: no RSA signing keys")
+	}
+	return keys, nil
+}
+
+// lookupClaim resolves a dotted claim path such as realm_access.roles
+func lookupClaim(claims jwt.MapClaims, path string) interface{} {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+	return value
+}
+
+// claimStrings reads a claim holding a list of strings or a space or comma separated string
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok && str != "" {
+				values = append(values, str)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
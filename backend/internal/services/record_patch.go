@@ -0,0 +1,167 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"image-rag-backend/internal/authz"
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// patchableRecordFields are the record fields a merge patch may change; the rest are read-only
+var patchableRecordFields = map[string]bool{
+	"name":        true,
+	"description": true,
+	"visibility":  true,
+	"attributes":  true,
+}
+
+// RecordETag is the entity tag of a record's current state, derived from its stored update time
+func RecordETag(record *models.Record) string {
+	return fmt.Sprintf(`"%d-%d"`, record.ID, record.UpdatedAt.UnixNano())
+}
+
+// PatchRecord applies a JSON Merge Patch (RFC 7396) to a record's name, description,
+// visibility and attributes. A non-empty ifMatch must match the record's current ETag.
+func (s *RecordService) PatchRecord(actor AuditActor, tenantID, id uint, patch []byte, ifMatch string) (*models.Record, error) {
+	var changes map[string]interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil || changes == nil {
+		return nil, fmt.Errorf("invalid patch: body must be a JSON object")
+	}
+	for field := range changes {
+		if !patchableRecordFields[field] {
+			return nil, fmt.Errorf("invalid patch: field %q cannot be changed", field)
+		}
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		record, err := lockRecord(tx, tenantID, id, ifMatch)
+		if err != nil {
+			return err
+		}
+		before := recordSnapshot(record)
+
+		patched := applyMergePatch(map[string]interface{}{
+			"name":        record.Name,
+			"description": record.Description,
+			"visibility":  record.Visibility,
+			"attributes":  map[string]interface{}(copyAttributes(record.Attributes)),
+		}, changes)
+		if err := s.applyRecordDocument(record, patched); err != nil {
+			return err
+		}
+
+		if err := tx.Save(record).Error; err != nil {
+			return fmt.Errorf("failed to update record: %w", err)
+		}
+		if err := writeAudit(tx, actor, tenantID, models.AuditActionUpdate, models.AuditEntityRecord, record.ID,
+			before, recordSnapshot(record)); err != nil {
+			return err
+		}
+		_, err = writeVersion(tx, actor, record.ID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	// Reload so the returned update time, and thus the ETag, is the one the database stored
+	return s.GetRecord(tenantID, id)
+}
+
+// applyRecordDocument copies a patched record document back onto the record, validating each field
+func (s *RecordService) applyRecordDocument(record *models.Record, doc map[string]interface{}) error {
+	name, ok := doc["name"].(string)
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid patch: name must be a non-empty string")
+	}
+
+	description := ""
+	if value, present := doc["description"]; present {
+		if description, ok = value.(string); !ok {
+			return fmt.Errorf("invalid patch: description must be a string")
+		}
+	}
+
+	visibility, ok := doc["visibility"].(string)
+	if !ok {
+		return fmt.Errorf("invalid patch: visibility must be %s or %s", models.VisibilityTenant, models.VisibilityPrivate)
+	}
+	if err := authz.ValidateVisibility(visibility); err != nil || visibility == "" {
+		return fmt.Errorf("invalid patch: visibility must be %s or %s", models.VisibilityTenant, models.VisibilityPrivate)
+	}
+
+	var attributes models.Attributes
+	if value, present := doc["attributes"]; present {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid patch: attributes must be an object")
+		}
+		attributes = models.Attributes(object)
+	}
+	if err := s.attributeSchema.ValidateRecordAttributes(attributes); err != nil {
+		return err
+	}
+
+	record.Name = name
+	record.Description = description
+	record.Visibility = visibility
+	record.Attributes = attributes
+	return nil
+}
+
+// lockRecord loads a record for update inside a transaction and checks an If-Match precondition
+func lockRecord(tx *gorm.DB, tenantID, id uint, ifMatch string) (*models.Record, error) {
+	var record models.Record
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("tenant_id = ?", tenantID).First(&record, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("record not found")
+		}
+		return nil, fmt.Errorf("failed to get record: %w", err)
+	}
+	if ifMatch != "" && !etagMatches(ifMatch, RecordETag(&record)) {
+		return nil, fmt.Errorf("precondition failed: record %d has been modified", id)
+	}
+	return &record, nil
+}
+
+// etagMatches evaluates an If-Match header value against an entity tag using strong comparison
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMergePatch applies an RFC 7396 merge patch to a JSON object: null removes a
+// member, objects are merged recursively and any other value replaces the member
+func applyMergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = make(map[string]interface{})
+	}
+	for key, value := range patch {
+		switch v := value.(type) {
+		case nil:
+			delete(target, key)
+		case map[string]interface{}:
+			// Merge into a copy so objects shared with the original document are left untouched
+			merged := make(map[string]interface{})
+			if existing, ok := target[key].(map[string]interface{}); ok {
+				for k, item := range existing {
+					merged[k] = item
+				}
+			}
+			target[key] = applyMergePatch(merged, v)
+		default:
+			target[key] = v
+		}
+	}
+	return target
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-rag-backend/internal/authz"
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Sort fields supported by record listing
+const (
+	SortByCreatedAt  = "created_at"
+	SortByUpdatedAt  = "updated_at"
+	SortByName       = "name"
+	SortByImageCount = "image_count"
+)
+
+// imageCountExpr counts the images attached to each record row, leaving out trashed ones
+const imageCountExpr = "(SELECT COUNT(*) FROM images WHERE images.record_id = records.id AND images.deleted_at IS NULL)"
+
+// RecordListOptions filters, sorts and paginates record listings
+type RecordListOptions struct {
+	// TenantID is required; listings never cross tenants
+	TenantID uint
+	// DatasetID restricts results to one dataset; zero lists every dataset
+	DatasetID uint
+	// Principal hides records the caller may not see; nil applies no visibility rules
+	Principal     *models.Principal
+	Keyword       string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	MinImages     *int
+	MaxImages     *int
+	// Tags restricts results to records carrying all of the tags, or any of them when TagMatchAny is set
+	Tags        []string
+	TagMatchAny bool
+	Attributes  []AttributeFilter
+	// Images restricts results to records with at least one image matching the metadata filter
+	Images    ImageMetadataFilter
+	SortBy    string
+	Ascending bool
+	Limit     int
+	// Offset is ignored when Cursor is set
+	Offset int
+	Cursor string
+}
+
+// RecordPage is one page of a record listing
+type RecordPage struct {
+	Records []models.Record
+	// Total counts every record matching the filters, regardless of pagination
+	Total      int64
+	NextCursor string
+}
+
+// recordCursor is the keyset position encoded into an opaque pagination cursor
+type recordCursor struct {
+	SortBy string `json:"s"`
+	Value  string `json:"v"`
+	ID     uint   `json:"id"`
+}
+
+// Validate normalizes defaults and rejects unsupported options
+func (o *RecordListOptions) Validate() error {
+	switch o.SortBy {
+	case "":
+		o.SortBy = SortByCreatedAt
+	case SortByCreatedAt, SortByUpdatedAt, SortByName, SortByImageCount:
+	default:
+		return fmt.Errorf("unsupported sort field: %s", o.SortBy)
+	}
+
+	if o.MinImages != nil && o.MaxImages != nil && *o.MinImages > *o.MaxImages {
+		return fmt.Errorf("min_images must not exceed max_images")
+	}
+	if o.Limit < 1 {
+		o.Limit = 10
+	}
+	return nil
+}
+
+// ListRecords returns records matching the options using keyset pagination when a cursor is given
+func (s *RecordService) ListRecords(opts RecordListOptions) (*RecordPage, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	query := applyRecordFilters(s.db.Model(&models.Record{}), opts)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count records: %w", err)
+	}
+
+	sortExpr := recordSortExpr(opts.SortBy)
+	direction := "DESC"
+	comparator := "<"
+	if opts.Ascending {
+		direction = "ASC"
+		comparator = ">"
+	}
+
+	if opts.Cursor != "" {
+		cursor, err := decodeRecordCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.SortBy != opts.SortBy {
+			return nil, fmt.Errorf("cursor does not match sort field %s", opts.SortBy)
+		}
+
+		value, err := cursorSortValue(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(
+			fmt.Sprintf("(%s %s ?) OR (%s = ? AND records.id %s ?)", sortExpr, comparator, sortExpr, comparator),
+			value, value, cursor.ID,
+		)
+	} else if opts.Offset > 0 {
+		query = query.Offset(opts.Offset)
+	}
+
+	// Fetch one extra row to know whether another page follows
+	var records []models.Record
+	if err := query.Preload("Images.Tags").Preload("Tags").
+		Order(fmt.Sprintf("%s %s, records.id %s", sortExpr, direction, direction)).
+		Limit(opts.Limit + 1).
+		Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to get records: %w", err)
+	}
+
+	page := &RecordPage{Records: records, Total: total}
+	if len(records) > opts.Limit {
+		page.Records = records[:opts.Limit]
+		page.NextCursor = encodeRecordCursor(opts.SortBy, page.Records[opts.Limit-1])
+	}
+
+	return page, nil
+}
+
+// applyRecordFilters adds the WHERE clauses for the listing filters
+func applyRecordFilters(query *gorm.DB, opts RecordListOptions) *gorm.DB {
+	query = query.Where("records.tenant_id = ?", opts.TenantID)
+	if opts.Principal != nil {
+		query = query.Scopes(authz.VisibleRecords(opts.Principal))
+	}
+	if opts.DatasetID != 0 {
+		query = query.Where("records.dataset_id = ?", opts.DatasetID)
+	}
+	if keyword := strings.TrimSpace(opts.Keyword); keyword != "" {
+		pattern := "%" + escapeLike(keyword) + "%"
+		query = query.Where("records.name LIKE ? OR records.description LIKE ?", pattern, pattern)
+	}
+	if opts.CreatedAfter != nil {
+		query = query.Where("records.created_at >= ?", *opts.CreatedAfter)
+	}
+	if opts.CreatedBefore != nil {
+		query = query.Where("records.created_at < ?", *opts.CreatedBefore)
+	}
+	if opts.UpdatedAfter != nil {
+		query = query.Where("records.updated_at >= ?", *opts.UpdatedAfter)
+	}
+	if opts.UpdatedBefore != nil {
+		query = query.Where("records.updated_at < ?", *opts.UpdatedBefore)
+	}
+	if opts.MinImages != nil {
+		query = query.Where(imageCountExpr+" >= ?", *opts.MinImages)
+	}
+	if opts.MaxImages != nil {
+		query = query.Where(imageCountExpr+" <= ?", *opts.MaxImages)
+	}
+	if len(opts.Tags) > 0 {
+		required := len(opts.Tags)
+		if opts.TagMatchAny {
+			required = 1
+		}
+		query = query.Where(`records.id IN (SELECT rt.record_id FROM record_tags rt
+			JOIN tags t ON t.id = rt.tag_id
+			WHERE t.name IN ?
+			GROUP BY rt.record_id
+			HAVING COUNT(DISTINCT t.id) >= ?)`, opts.Tags, required)
+	}
+	if !opts.Images.IsZero() {
+		images := opts.Images.apply(query.Session(&gorm.Session{NewDB: true}).Table("images").
+			Select("images.record_id").Where("images.deleted_at IS NULL"))
+		query = query.Where("records.id IN (?)", images)
+	}
+	return applyAttributeFilters(query, "records.attributes", opts.Attributes)
+}
+
+// recordSortExpr maps a sort field to its SQL expression
+func recordSortExpr(sortBy string) string {
+	if sortBy == SortByImageCount {
+		return imageCountExpr
+	}
+	return "records." + sortBy
+}
+
+// escapeLike escapes LIKE wildcards in user input
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(value)
+}
+
+// encodeRecordCursor builds the opaque cursor pointing after the given record
+func encodeRecordCursor(sortBy string, record models.Record) string {
+	cursor := recordCursor{SortBy: sortBy, ID: record.ID}
+	switch sortBy {
+	case SortByName:
+		cursor.Value = record.Name
+	case SortByUpdatedAt:
+		cursor.Value = record.UpdatedAt.Format(time.RFC3339Nano)
+	case SortByImageCount:
+		cursor.Value = strconv.Itoa(len(record.Images))
+	default:
+		cursor.Value = record.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeRecordCursor parses an opaque pagination cursor
+func decodeRecordCursor(encoded string) (*recordCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var cursor recordCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// cursorSortValue converts the cursor value back to the type of its sort column
+func cursorSortValue(cursor *recordCursor) (interface{}, error) {
+	switch cursor.SortBy {
+	case SortByName:
+		return cursor.Value, nil
+	case SortByImageCount:
+		count, err := strconv.Atoi(cursor.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		return count, nil
+	default:
+		t, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		return t, nil
+	}
+}
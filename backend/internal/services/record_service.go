@@ -1,46 +1,99 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io"
+	"path"
 	"strings"
 
+	"image-rag-backend/internal/authz"
+	"image-rag-backend/internal/blobstore"
 	"image-rag-backend/internal/database"
 	"image-rag-backend/internal/models"
 
-	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type RecordService struct {
-	db *gorm.DB
+	db              *gorm.DB
+	attributeSchema *AttributeSchema
+	blobs           blobstore.Store
 }
 
-func NewRecordService() *RecordService {
-	return &RecordService{db: database.DB}
+func NewRecordService(blobs blobstore.Store) *RecordService {
+	return &RecordService{db: database.DB, blobs: blobs}
+}
+
+// SetAttributeSchema enables validation of record and image attributes
+func (s *RecordService) SetAttributeSchema(schema *AttributeSchema) {
+	s.attributeSchema = schema
+}
+
+// ValidateImageAttributes checks image attributes against the configured schema
+func (s *RecordService) ValidateImageAttributes(attributes models.Attributes) error {
+	return s.attributeSchema.ValidateImageAttributes(attributes)
 }
 
 func (s *RecordService) GetDB() *gorm.DB {
 	return s.db
 }
 
-func (s *RecordService) CreateRecord(name, description string) (*models.Record, error) {
+// FindImageByVectorID returns the tenant's image stored under a vector ID, which may name any of its key frames
+func (s *RecordService) FindImageByVectorID(tenantID uint, vectorID string) (*models.Image, error) {
+	var image models.Image
+	if err := s.db.Where("tenant_id = ? AND vector_id = ?", tenantID, models.BaseVectorID(vectorID)).
+		First(&image).Error; err != nil {
+		return nil, fmt.Errorf("image not found for vector ID: %s", vectorID)
+	}
+	return &image, nil
+}
+
+// CreateRecord creates a record owned by ownerID; an empty visibility makes it visible to the whole tenant
+func (s *RecordService) CreateRecord(actor AuditActor, tenantID, datasetID uint, ownerID, name, description,
+	visibility string, attributes models.Attributes) (*models.Record, error) {
+	if err := s.attributeSchema.ValidateRecordAttributes(attributes); err != nil {
+		return nil, err
+	}
+	if err := authz.ValidateVisibility(visibility); err != nil {
+		return nil, err
+	}
+	if visibility == "" {
+		visibility = models.VisibilityTenant
+	}
+
 	record := &models.Record{
+		TenantID:    tenantID,
+		DatasetID:   datasetID,
+		OwnerID:     ownerID,
+		Visibility:  visibility,
 		Name:        name,
 		Description: description,
+		Attributes:  attributes,
 	}
 
-	if err := s.db.Create(record).Error; err != nil {
-		return nil, fmt.Errorf("failed to create record: %w", err)
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(record).Error; err != nil {
+			return fmt.Errorf("failed to create record: %w", err)
+		}
+		if err := writeAudit(tx, actor, tenantID, models.AuditActionCreate, models.AuditEntityRecord, record.ID,
+			nil, recordSnapshot(record)); err != nil {
+			return err
+		}
+		_, err := writeVersion(tx, actor, record.ID)
+		return err
+	}); err != nil {
+		return nil, err
 	}
 
 	return record, nil
 }
 
-func (s *RecordService) GetRecord(id uint) (*models.Record, error) {
+func (s *RecordService) GetRecord(tenantID, id uint) (*models.Record, error) {
 	var record models.Record
-	if err := s.db.Preload("Images").First(&record, id).Error; err != nil {
+	if err := s.db.Preload("Images.Tags").Preload("Tags").
+		Where("tenant_id = ?", tenantID).First(&record, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("record not found")
 		}
@@ -49,9 +102,9 @@ func (s *RecordService) GetRecord(id uint) (*models.Record, error) {
 	return &record, nil
 }
 
-func (s *RecordService) GetImage(id uint) (*models.Image, error) {
+func (s *RecordService) GetImage(tenantID, id uint) (*models.Image, error) {
 	var image models.Image
-	if err := s.db.First(&image, id).Error; err != nil {
+	if err := s.db.Preload("Tags").Where("tenant_id = ?", tenantID).First(&image, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("image not found")
 		}
@@ -60,147 +113,300 @@ func (s *RecordService) GetImage(id uint) (*models.Image, error) {
 	return &image, nil
 }
 
-func (s *RecordService) GetRecords(limit, offset int) ([]models.Record, int64, error) {
-	var records []models.Record
-	var total int64
-
-	s.db.Model(&models.Record{}).Count(&total)
+// SearchText runs a BM25-style natural language full-text query over the record names and descriptions of a dataset
+func (s *RecordService) SearchText(query string, limit int, datasetID uint) ([]TextMatch, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
 
-	if err := s.db.Preload("Images").
-		Order("created_at DESC").
+	var rows []struct {
+		ID    uint
+		Score float64
+	}
+	if err := s.db.Model(&models.Record{}).
+		Select("id, MATCH(name, description) AGAINST (? IN NATURAL LANGUAGE MODE) AS score", query).
+		Where("MATCH(name, description) AGAINST (? IN NATURAL LANGUAGE MODE)", query).
+		Where("dataset_id = ?", datasetID).
+		Order("score DESC").
 		Limit(limit).
-		Offset(offset).
-		Find(&records).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to get records: %w", err)
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to run full-text search: %w", err)
 	}
 
-	return records, total, nil
+	matches := make([]TextMatch, len(rows))
+	for i, row := range rows {
+		matches[i] = TextMatch{RecordID: row.ID, Score: row.Score}
+	}
+	return matches, nil
 }
 
-func (s *RecordService) UpdateRecord(id uint, name, description string) (*models.Record, error) {
-	record, err := s.GetRecord(id)
-	if err != nil {
+// UpdateRecord replaces the non-empty fields given; PatchRecord can also clear them.
+// A non-empty ifMatch must match the record's current ETag.
+func (s *RecordService) UpdateRecord(actor AuditActor, tenantID, id uint, name, description, visibility string,
+	attributes models.Attributes, ifMatch string) (*models.Record, error) {
+	if err := authz.ValidateVisibility(visibility); err != nil {
 		return nil, err
 	}
-
-	if name != "" {
-		record.Name = name
-	}
-	if description != "" {
-		record.Description = description
+	if attributes != nil {
+		if err := s.attributeSchema.ValidateRecordAttributes(attributes); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := s.db.Save(record).Error; err != nil {
-		return nil, fmt.Errorf("failed to update record: %w", err)
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		record, err := lockRecord(tx, tenantID, id, ifMatch)
+		if err != nil {
+			return err
+		}
+		before := recordSnapshot(record)
+
+		if name != "" {
+			record.Name = name
+		}
+		if description != "" {
+			record.Description = description
+		}
+		if visibility != "" {
+			record.Visibility = visibility
+		}
+		if attributes != nil {
+			record.Attributes = attributes
+		}
+
+		if err := tx.Save(record).Error; err != nil {
+			return fmt.Errorf("failed to update record: %w", err)
+		}
+		if err := writeAudit(tx, actor, tenantID, models.AuditActionUpdate, models.AuditEntityRecord, record.ID,
+			before, recordSnapshot(record)); err != nil {
+			return err
+		}
+		_, err = writeVersion(tx, actor, record.ID)
+		return err
+	}); err != nil {
+		return nil, err
 	}
 
-	return record, nil
+	// Reload so the returned update time, and thus the ETag, is the one the database stored
+	return s.GetRecord(tenantID, id)
 }
 
-func (s *RecordService) DeleteRecord(id uint) error {
-	result := s.db.Delete(&models.Record{}, id)
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete record: %w", result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("record not found")
+// DeleteRecord moves a record to the trash; its images stay attached and are restored with it
+func (s *RecordService) DeleteRecord(actor AuditActor, tenantID, id uint) error {
+	var record models.Record
+	if err := s.db.Where("tenant_id = ?", tenantID).First(&record, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("record not found")
+		}
+		return fmt.Errorf("failed to get record: %w", err)
 	}
-	return nil
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&record).Error; err != nil {
+			return fmt.Errorf("failed to delete record: %w", err)
+		}
+		return writeAudit(tx, actor, tenantID, models.AuditActionDelete, models.AuditEntityRecord, record.ID,
+			recordSnapshot(&record), nil)
+	})
 }
 
-func (s *RecordService) AddImageToRecord(recordID uint, filename string, vectorID string) (*models.Image, error) {
+// AddImageToRecord records an image stored by StoreImageFile; the image takes over the blob reference
+func (s *RecordService) AddImageToRecord(actor AuditActor, tenantID, recordID uint, stored *StoredImage, vectorID string,
+	attributes models.Attributes) (*models.Image, error) {
 	// Ensure record exists
-	_, err := s.GetRecord(recordID)
+	_, err := s.GetRecord(tenantID, recordID)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := s.attributeSchema.ValidateImageAttributes(attributes); err != nil {
+		return nil, err
+	}
+
 	image := &models.Image{
-		RecordID: recordID,
-		Filename: filename,
-		Path:     filepath.Join("uploads", filename),
-		VectorID: vectorID,
+		TenantID:           tenantID,
+		RecordID:           recordID,
+		Filename:           stored.Filename,
+		Path:               stored.Key,
+		Digest:             stored.Digest,
+		PHash:              stored.PHash,
+		DHash:              stored.DHash,
+		DuplicateOf:        stored.DuplicateOf,
+		Metadata:           stored.Metadata,
+		EmbeddingTransform: stored.EmbeddingTransform,
+		KeyFrames:          stored.KeyFrames,
+		VectorID:           vectorID,
+		Attributes:         attributes,
 	}
 
-	if err := s.db.Create(image).Error; err != nil {
-		return nil, fmt.Errorf("failed to add image: %w", err)
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(image).Error; err != nil {
+			return fmt.Errorf("failed to add image: %w", err)
+		}
+		if err := writeAudit(tx, actor, tenantID, models.AuditActionCreate, models.AuditEntityImage, image.ID,
+			nil, imageSnapshot(image)); err != nil {
+			return err
+		}
+		_, err := writeVersion(tx, actor, recordID)
+		return err
+	}); err != nil {
+		return nil, err
 	}
 
 	return image, nil
 }
 
-func (s *RecordService) DeleteImage(id uint) error {
+// DeleteImage moves an image to the trash; its file is kept until the trash is purged
+func (s *RecordService) DeleteImage(actor AuditActor, tenantID, id uint) error {
 	var image models.Image
-	if err := s.db.First(&image, id).Error; err != nil {
+	if err := s.db.Where("tenant_id = ?", tenantID).First(&image, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return fmt.Errorf("image not found")
 		}
 		return fmt.Errorf("failed to get image: %w", err)
 	}
 
-	// Delete file from filesystem
-	if err := os.Remove(image.Path); err != nil && !os.IsNotExist(err) {
-		// Log error but don't fail the operation
-		fmt.Printf("Warning: failed to delete file %s: %v\n", image.Path, err)
-	}
-
-	if err := s.db.Delete(&image, id).Error; err != nil {
-		return fmt.Errorf("failed to delete image: %w", err)
-	}
-
-	return nil
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&image, id).Error; err != nil {
+			return fmt.Errorf("failed to delete image: %w", err)
+		}
+		if err := writeAudit(tx, actor, tenantID, models.AuditActionDelete, models.AuditEntityImage, image.ID,
+			imageSnapshot(&image), nil); err != nil {
+			return err
+		}
+		_, err := writeVersion(tx, actor, image.RecordID)
+		return err
+	})
 }
 
-func (s *RecordService) GetImagesByRecordID(recordID uint) ([]models.Image, error) {
+func (s *RecordService) GetImagesByRecordID(tenantID, recordID uint) ([]models.Image, error) {
 	var images []models.Image
-	if err := s.db.Where("record_id = ?", recordID).Find(&images).Error; err != nil {
+	if err := s.db.Where("tenant_id = ? AND record_id = ?", tenantID, recordID).Find(&images).Error; err != nil {
 		return nil, fmt.Errorf("failed to get images: %w", err)
 	}
 	return images, nil
 }
 
-// ValidateImageFile validates image file extension and size
-func ValidateImageFile(filename string) error {
-	ext := strings.ToLower(filepath.Ext(filename))
-	allowed := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".webp": true,
+// StoreImageFile stores an uploaded image in the tenant's prefix of the blob store under the
+// SHA-256 digest of its bytes and takes a reference on the blob. Bytes the tenant uploaded
+// before are not stored again. The perceptual hashes and image metadata are computed on the way.
+// The file is written before the reference is taken, so a blob row always points at a stored
+// file and concurrent uploads of the same bytes never reference one that is still being written.
+func (s *RecordService) StoreImageFile(ctx context.Context, tenant *models.Tenant, filename string, r io.ReadSeeker,
+	size int64) (*StoredImage, error) {
+	digest, err := hashFile(r)
+	if err != nil {
+		return nil, err
+	}
+	// Files that do not decode are still stored; they just take no part in near-duplicate detection
+	hashes, hashErr := ComputeImageHashes(r)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind file: %w", err)
+	}
+	metadata, err := ExtractImageMetadata(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind file: %w", err)
 	}
 
-	if !allowed[ext] {
-		return fmt.Errorf("unsupported file format: %s", ext)
+	// Bytes of a referenced blob are already stored; blobs are only referenced once their file is.
+	// A released blob's file may be being deleted, so its bytes are written again.
+	key := TenantBlobKey(tenant, digest+strings.ToLower(path.Ext(filename)))
+	var count int64
+	if err := s.db.Model(&models.Blob{}).Where("tenant_id = ? AND digest = ? AND ref_count > 0", tenant.ID, digest).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+	written := count == 0
+	if written {
+		if err := s.blobs.Put(ctx, key, r, size, ""); err != nil {
+			return nil, fmt.Errorf("failed to save file: %w", err)
+		}
 	}
 
-	return nil
-}
+	var blob *models.Blob
+	created := false
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		blob, created, err = acquireBlob(tx, tenant.ID, digest, key, size)
+		return err
+	}); err != nil {
+		// A file just written stays: with no blob row to lock, a concurrent upload of the same
+		// bytes may be referencing it. The next upload of the bytes overwrites it.
+		return nil, err
+	}
+	if written && blob.Path != key {
+		// A concurrent upload of the same bytes under another extension created the blob first
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			fmt.Printf("Warning: failed to delete file %s: %v\n", key, err)
+		}
+	}
 
-// EnsureDirectoryExists creates directory if it doesn't exist
-func EnsureDirectoryExists(dir string) error {
-	return os.MkdirAll(dir, 0755)
+	stored := &StoredImage{TenantID: tenant.ID, Key: blob.Path, Filename: path.Base(filename), Digest: digest, Size: size,
+		Metadata: metadata}
+	if hashErr == nil {
+		stored.PHash, stored.DHash = &hashes.PHash, &hashes.DHash
+	}
+	if created {
+		// The blob's last reference may have been released, and its file deleted, between the
+		// lookup above and taking this reference; store the file again in that case. Files are
+		// only deleted under the row lock while the count is zero, so the file now stays.
+		if err := s.restoreBlobFile(ctx, blob.Path, r, size); err != nil {
+			_ = s.ReleaseImageFile(stored)
+			return nil, fmt.Errorf("failed to save file: %w", err)
+		}
+	}
+	return stored, nil
 }
 
-// DeleteImageByPath deletes image file by path
-func (s *RecordService) DeleteImageByPath(path string) error {
-	return os.Remove(path)
+// restoreBlobFile stores an upload under key unless the file is already there
+func (s *RecordService) restoreBlobFile(ctx context.Context, key string, r io.ReadSeeker, size int64) error {
+	_, err := s.blobs.Stat(ctx, key)
+	if err == nil || !errors.Is(err, blobstore.ErrNotFound) {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind file: %w", err)
+	}
+	return s.blobs.Put(ctx, key, r, size, "")
 }
 
-// FileExists checks if file exists
-func (s *RecordService) FileExists(path string) (bool, error) {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return false, nil
+// ReleaseImageFile drops the reference StoreImageFile took for an upload that was not added
+// to a record, deleting the file when nothing else references it
+func (s *RecordService) ReleaseImageFile(stored *StoredImage) error {
+	var released *releasedBlob
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		released, err = releaseBlob(tx, stored.TenantID, stored.Digest, stored.Key)
+		return err
+	}); err != nil {
+		return err
 	}
-	return err == nil, err
+	deleteReleasedFiles(s.db, s.blobs, []*releasedBlob{released})
+	return nil
 }
 
-// GenerateUniqueFilename generates a unique filename to prevent collisions
-func GenerateUniqueFilename(originalFilename string) string {
-	ext := filepath.Ext(originalFilename)
-	name := strings.TrimSuffix(originalFilename, ext)
-	name = strings.ReplaceAll(name, " ", "_")
-	name = strings.ReplaceAll(name, "..", "_")
+// FindImageByDigest returns an image, possibly trashed, stored in the tenant's blob with a digest
+// whose vector was generated under the given preprocessing transform
+func (s *RecordService) FindImageByDigest(tenantID uint, digest, transform string) (*models.Image, error) {
+	var image models.Image
+	if err := s.db.Unscoped().
+		Where("tenant_id = ? AND digest = ? AND embedding_transform = ?", tenantID, digest, transform).
+		First(&image).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("image not found")
+		}
+		return nil, fmt.Errorf("failed to get image: %w", err)
+	}
+	return &image, nil
+}
 
-	return fmt.Sprintf("%s_%s%s", uuid.New().String()[:8], name, ext)
+// OpenImageFile opens a stored image file by its key; the caller must close it
+func (s *RecordService) OpenImageFile(ctx context.Context, key string) (io.ReadCloser, *blobstore.Info, error) {
+	reader, info, err := s.blobs.Get(ctx, key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return nil, nil, fmt.Errorf("image file not found")
+	}
+	return reader, info, err
 }
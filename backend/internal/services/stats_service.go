@@ -8,6 +8,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// topTagsLimit is the number of tags reported in dashboard stats
+const topTagsLimit = 10
+
 type StatsService struct {
 	db *gorm.DB
 }
@@ -16,19 +19,24 @@ func NewStatsService(db *gorm.DB) *StatsService {
 	return &StatsService{db: db}
 }
 
-func (s *StatsService) GetDashboardStats() (*models.DashboardStats, error) {
+// GetDashboardStats returns the dashboard counters of one tenant
+func (s *StatsService) GetDashboardStats(tenantID uint) (*models.DashboardStats, error) {
 	stats := &models.DashboardStats{}
 
 	// Get total records count
 	var totalRecords int64
-	if err := s.db.Model(&models.Record{}).Count(&totalRecords).Error; err != nil {
+	if err := s.db.Model(&models.Record{}).Where("tenant_id = ?", tenantID).Count(&totalRecords).Error; err != nil {
 		return nil, err
 	}
 	stats.TotalRecords = totalRecords
 
+	// Images of trashed records are left out along with the records
+	liveRecords := s.db.Model(&models.Record{}).Select("id").Where("tenant_id = ?", tenantID)
+
 	// Get total images count
 	var totalImages int64
-	if err := s.db.Model(&models.Image{}).Count(&totalImages).Error; err != nil {
+	if err := s.db.Model(&models.Image{}).Where("tenant_id = ? AND record_id IN (?)", tenantID, liveRecords).
+		Count(&totalImages).Error; err != nil {
 		return nil, err
 	}
 	stats.TotalImages = totalImages
@@ -41,7 +49,7 @@ func (s *StatsService) GetDashboardStats() (*models.DashboardStats, error) {
 	// Get today's records count
 	var todayRecords int64
 	if err := s.db.Model(&models.Record{}).
-		Where("created_at >= ? AND created_at < ?", startOfDay, endOfDay).
+		Where("tenant_id = ? AND created_at >= ? AND created_at < ?", tenantID, startOfDay, endOfDay).
 		Count(&todayRecords).Error; err != nil {
 		return nil, err
 	}
@@ -50,11 +58,27 @@ func (s *StatsService) GetDashboardStats() (*models.DashboardStats, error) {
 	// Get today's images count
 	var todayImages int64
 	if err := s.db.Model(&models.Image{}).
-		Where("created_at >= ? AND created_at < ?", startOfDay, endOfDay).
+		Where("tenant_id = ? AND created_at >= ? AND created_at < ?", tenantID, startOfDay, endOfDay).
+		Where("record_id IN (?)", liveRecords).
 		Count(&todayImages).Error; err != nil {
 		return nil, err
 	}
 	stats.TodayImages = todayImages
 
+	// Get tag usage counts
+	if err := s.db.Model(&models.Tag{}).Where("tenant_id = ?", tenantID).Count(&stats.TotalTags).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Raw(`SELECT t.id, t.name,
+			(SELECT COUNT(*) FROM record_tags rt JOIN records r ON r.id = rt.record_id
+				WHERE rt.tag_id = t.id AND r.deleted_at IS NULL) AS record_count,
+			(SELECT COUNT(*) FROM image_tags it JOIN images i ON i.id = it.image_id
+				WHERE it.tag_id = t.id AND i.deleted_at IS NULL) AS image_count
+		FROM tags t WHERE t.tenant_id = ? ORDER BY record_count DESC, image_count DESC, t.name
+		LIMIT ?`, tenantID, topTagsLimit).Scan(&stats.TopTags).Error; err != nil {
+		return nil, err
+	}
+
 	return stats, nil
 }
@@ -0,0 +1,409 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"image-rag-backend/internal/database"
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// maxTagLength matches the tag length accepted by the vector store
+const maxTagLength = 64
+
+type TagService struct {
+	db            *gorm.DB
+	vectorService *VectorService
+}
+
+func NewTagService(vectorService *VectorService) *TagService {
+	return &TagService{db: database.DB, vectorService: vectorService}
+}
+
+// NormalizeTags trims, lowercases and de-duplicates tag names
+func NormalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	var normalized []string
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if len(name) > maxTagLength {
+			return nil, fmt.Errorf("tag %q exceeds %d characters", name, maxTagLength)
+		}
+		if strings.ContainsAny(name, ",\"") {
+			return nil, fmt.Errorf("tag %q contains invalid characters", name)
+		}
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+
+	return normalized, nil
+}
+
+// ListTags returns every tag of a tenant with the number of records and images outside the trash carrying it
+func (s *TagService) ListTags(tenantID uint) ([]models.TagCount, error) {
+	var counts []models.TagCount
+	if err := s.db.Raw(`SELECT t.id, t.name,
+			(SELECT COUNT(*) FROM record_tags rt JOIN records r ON r.id = rt.record_id
+				WHERE rt.tag_id = t.id AND r.deleted_at IS NULL) AS record_count,
+			(SELECT COUNT(*) FROM image_tags it JOIN images i ON i.id = it.image_id
+				WHERE it.tag_id = t.id AND i.deleted_at IS NULL) AS image_count
+		FROM tags t WHERE t.tenant_id = ? ORDER BY t.name`, tenantID).Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	return counts, nil
+}
+
+func (s *TagService) GetTag(tenantID, id uint) (*models.Tag, error) {
+	var tag models.Tag
+	if err := s.db.Where("tenant_id = ?", tenantID).First(&tag, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("tag not found")
+		}
+		return nil, fmt.Errorf("failed to get tag: %w", err)
+	}
+	return &tag, nil
+}
+
+func (s *TagService) CreateTag(tenantID uint, name string) (*models.Tag, error) {
+	names, err := NormalizeTags([]string{name})
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("tag name is required")
+	}
+
+	tags, err := s.ensureTags(s.db, tenantID, names)
+	if err != nil {
+		return nil, err
+	}
+	return &tags[0], nil
+}
+
+// RenameTag renames a tag and refreshes the tags stored with affected vectors
+func (s *TagService) RenameTag(tenantID, id uint, name string) (*models.Tag, error) {
+	names, err := NormalizeTags([]string{name})
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("tag name is required")
+	}
+
+	tag, err := s.GetTag(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	s.db.Model(&models.Tag{}).Where("tenant_id = ? AND name = ? AND id <> ?", tenantID, names[0], id).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("tag already exists: %s", names[0])
+	}
+
+	tag.Name = names[0]
+	if err := s.db.Save(tag).Error; err != nil {
+		return nil, fmt.Errorf("failed to rename tag: %w", err)
+	}
+
+	imageIDs, err := s.imagesWithTag(id)
+	if err != nil {
+		return nil, err
+	}
+	return tag, s.syncVectorTags(tenantID, imageIDs)
+}
+
+// DeleteTag removes a tag from every record and image
+func (s *TagService) DeleteTag(tenantID, id uint) error {
+	if _, err := s.GetTag(tenantID, id); err != nil {
+		return err
+	}
+
+	imageIDs, err := s.imagesWithTag(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Delete(&models.Tag{}, id).Error; err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+
+	return s.syncVectorTags(tenantID, imageIDs)
+}
+
+// TagRecords attaches tags to records, creating missing tags
+func (s *TagService) TagRecords(tenantID uint, recordIDs []uint, names []string) error {
+	return s.updateRecordTags(tenantID, recordIDs, names, true)
+}
+
+// UntagRecords detaches tags from records
+func (s *TagService) UntagRecords(tenantID uint, recordIDs []uint, names []string) error {
+	return s.updateRecordTags(tenantID, recordIDs, names, false)
+}
+
+// TagImages attaches tags to images, creating missing tags
+func (s *TagService) TagImages(tenantID uint, imageIDs []uint, names []string) error {
+	return s.updateImageTags(tenantID, imageIDs, names, true)
+}
+
+// UntagImages detaches tags from images
+func (s *TagService) UntagImages(tenantID uint, imageIDs []uint, names []string) error {
+	return s.updateImageTags(tenantID, imageIDs, names, false)
+}
+
+// RecordTagNames returns the names of the tags attached to a record
+func (s *TagService) RecordTagNames(tenantID, recordID uint) ([]string, error) {
+	var names []string
+	if err := s.db.Raw(`SELECT t.name FROM tags t
+		JOIN record_tags rt ON rt.tag_id = t.id
+		WHERE t.tenant_id = ? AND rt.record_id = ? ORDER BY t.name`, tenantID, recordID).
+		Scan(&names).Error; err != nil {
+		return nil, fmt.Errorf("failed to get record tags: %w", err)
+	}
+	return names, nil
+}
+
+// EffectiveImageTags returns an image's own tags merged with the tags of its record
+func (s *TagService) EffectiveImageTags(tenantID, imageID uint) ([]string, error) {
+	var names []string
+	if err := s.db.Raw(`SELECT t.name FROM tags t
+			JOIN image_tags it ON it.tag_id = t.id
+			WHERE t.tenant_id = ? AND it.image_id = ?
+		UNION
+		SELECT t.name FROM tags t
+			JOIN record_tags rt ON rt.tag_id = t.id
+			JOIN images i ON i.record_id = rt.record_id
+			WHERE t.tenant_id = ? AND i.id = ?`, tenantID, imageID, tenantID, imageID).
+		Scan(&names).Error; err != nil {
+		return nil, fmt.Errorf("failed to get image tags: %w", err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// FindRecords returns the records with the given IDs, failing when any is missing
+func (s *TagService) FindRecords(tenantID uint, ids []uint) ([]models.Record, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var records []models.Record
+	if err := s.db.Where("tenant_id = ? AND id IN ?", tenantID, ids).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to get records: %w", err)
+	}
+	if len(records) != len(uniqueIDs(ids)) {
+		return nil, fmt.Errorf("record not found")
+	}
+	return records, nil
+}
+
+// FindImageRecords returns the records of the images with the given IDs, failing when any image is missing
+func (s *TagService) FindImageRecords(tenantID uint, imageIDs []uint) ([]models.Record, error) {
+	if len(imageIDs) == 0 {
+		return nil, nil
+	}
+	var images []models.Image
+	if err := s.db.Where("tenant_id = ? AND id IN ?", tenantID, imageIDs).Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("failed to get images: %w", err)
+	}
+	if len(images) != len(uniqueIDs(imageIDs)) {
+		return nil, fmt.Errorf("image not found")
+	}
+
+	recordIDs := make([]uint, 0, len(images))
+	for _, image := range images {
+		recordIDs = append(recordIDs, image.RecordID)
+	}
+	records, err := s.FindRecords(tenantID, recordIDs)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, fmt.Errorf("image not found")
+		}
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *TagService) updateRecordTags(tenantID uint, recordIDs []uint, names []string, attach bool) error {
+	names, err := NormalizeTags(names)
+	if err != nil {
+		return err
+	}
+	if len(recordIDs) == 0 || len(names) == 0 {
+		return nil
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureAllExist(tx, &models.Record{}, tenantID, recordIDs, "record"); err != nil {
+			return err
+		}
+
+		tags, err := s.resolveTags(tx, tenantID, names, attach)
+		if err != nil || len(tags) == 0 {
+			return err
+		}
+
+		for _, id := range recordIDs {
+			association := tx.Model(&models.Record{ID: id}).Association("Tags")
+			if attach {
+				err = association.Append(tags)
+			} else {
+				err = association.Delete(tags)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to update record tags: %w", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var imageIDs []uint
+	if err := s.db.Model(&models.Image{}).Where("record_id IN ?", recordIDs).Pluck("id", &imageIDs).Error; err != nil {
+		return fmt.Errorf("failed to get record images: %w", err)
+	}
+	return s.syncVectorTags(tenantID, imageIDs)
+}
+
+func (s *TagService) updateImageTags(tenantID uint, imageIDs []uint, names []string, attach bool) error {
+	names, err := NormalizeTags(names)
+	if err != nil {
+		return err
+	}
+	if len(imageIDs) == 0 || len(names) == 0 {
+		return nil
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureAllExist(tx, &models.Image{}, tenantID, imageIDs, "image"); err != nil {
+			return err
+		}
+
+		tags, err := s.resolveTags(tx, tenantID, names, attach)
+		if err != nil || len(tags) == 0 {
+			return err
+		}
+
+		for _, id := range imageIDs {
+			association := tx.Model(&models.Image{ID: id}).Association("Tags")
+			if attach {
+				err = association.Append(tags)
+			} else {
+				err = association.Delete(tags)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to update image tags: %w", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return s.syncVectorTags(tenantID, imageIDs)
+}
+
+// resolveTags creates missing tags when attaching, and only looks up existing ones when detaching
+func (s *TagService) resolveTags(tx *gorm.DB, tenantID uint, names []string, create bool) ([]models.Tag, error) {
+	if create {
+		return s.ensureTags(tx, tenantID, names)
+	}
+
+	var tags []models.Tag
+	if err := tx.Where("tenant_id = ? AND name IN ?", tenantID, names).Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+	return tags, nil
+}
+
+// ensureTags returns the named tags, creating those that do not exist yet
+func (s *TagService) ensureTags(tx *gorm.DB, tenantID uint, names []string) ([]models.Tag, error) {
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		tag := models.Tag{TenantID: tenantID, Name: name}
+		if err := tx.Where(models.Tag{TenantID: tenantID, Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return nil, fmt.Errorf("failed to create tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// imagesWithTag returns images carrying a tag directly or through their record
+func (s *TagService) imagesWithTag(tagID uint) ([]uint, error) {
+	var imageIDs []uint
+	if err := s.db.Raw(`SELECT it.image_id FROM image_tags it WHERE it.tag_id = ?
+		UNION
+		SELECT i.id FROM images i JOIN record_tags rt ON rt.record_id = i.record_id WHERE rt.tag_id = ?`,
+		tagID, tagID).Scan(&imageIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get tagged images: %w", err)
+	}
+	return imageIDs, nil
+}
+
+// syncVectorTags pushes the effective tags of each image into the vector store.
+// Trashed images are skipped so their vectors stay in the trash partition.
+func (s *TagService) syncVectorTags(tenantID uint, imageIDs []uint) error {
+	if s.vectorService == nil || len(imageIDs) == 0 {
+		return nil
+	}
+
+	// Vectors live in the partition of their record's dataset
+	var images []struct {
+		ID            uint
+		VectorID      string
+		KeyFrames     int
+		PartitionName string
+	}
+	if err := s.db.Raw(`SELECT i.id, i.vector_id, i.key_frames, d.partition_name FROM images i
+		JOIN records r ON r.id = i.record_id
+		JOIN datasets d ON d.id = r.dataset_id
+		WHERE i.tenant_id = ? AND i.id IN ? AND i.deleted_at IS NULL AND r.deleted_at IS NULL`, tenantID, imageIDs).Scan(&images).Error; err != nil {
+		return fmt.Errorf("failed to get images: %w", err)
+	}
+
+	for _, image := range images {
+		tags, err := s.EffectiveImageTags(tenantID, image.ID)
+		if err != nil {
+			return err
+		}
+		for _, vectorID := range models.ImageVectorIDs(image.VectorID, image.KeyFrames) {
+			if err := s.vectorService.UpdateVectorTags(vectorID, tags, image.PartitionName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ensureAllExist verifies that every ID refers to an existing row owned by the tenant
+func ensureAllExist(tx *gorm.DB, model interface{}, tenantID uint, ids []uint, entity string) error {
+	var count int64
+	if err := tx.Model(model).Where("tenant_id = ? AND id IN ?", tenantID, ids).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check %ss: %w", entity, err)
+	}
+	if count != int64(len(uniqueIDs(ids))) {
+		return fmt.Errorf("%s not found", entity)
+	}
+	return nil
+}
+
+// uniqueIDs removes duplicate IDs while preserving order
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+
+	"image-rag-backend/internal/database"
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTenantName owns all data in single-tenant deployments and data created before tenancy
+const DefaultTenantName = "default"
+
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// reservedTenantNames collide with directories under the local storage root
+var reservedTenantNames = map[string]bool{"temp": true}
+
+type TenantService struct {
+	db             *gorm.DB
+	datasetService *DatasetService
+	// credentials maps SHA-256 token digests to tenants
+	credentials   map[[sha256.Size]byte]*models.Tenant
+	defaultTenant *models.Tenant
+}
+
+func NewTenantService(datasetService *DatasetService) *TenantService {
+	return &TenantService{db: database.DB, datasetService: datasetService}
+}
+
+// Init creates the default tenant and the tenants named in credentials, assigns
+// pre-existing data to the default tenant, and loads the credential table.
+// credentials maps bearer tokens to tenant names.
+func (s *TenantService) Init(credentials map[string]string) error {
+	defaultTenant, err := s.ensureTenant(DefaultTenantName)
+	if err != nil {
+		return err
+	}
+	s.defaultTenant = defaultTenant
+
+	for _, table := range []string{"datasets", "records", "images", "tags"} {
+		if err := s.db.Table(table).Where("tenant_id = 0").
+			Update("tenant_id", defaultTenant.ID).Error; err != nil {
+			return fmt.Errorf("failed to assign %s to default tenant: %w", table, err)
+		}
+	}
+	if _, err := s.datasetService.EnsureDefaultDataset(defaultTenant); err != nil {
+		return err
+	}
+
+	// Resolve tenants in a stable order so startup failures are deterministic
+	tokens := make([]string, 0, len(credentials))
+	for token := range credentials {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+
+	s.credentials = make(map[[sha256.Size]byte]*models.Tenant, len(tokens))
+	for _, token := range tokens {
+		tenant, err := s.ensureTenant(credentials[token])
+		if err != nil {
+			return err
+		}
+		if _, err := s.datasetService.EnsureDefaultDataset(tenant); err != nil {
+			return err
+		}
+		s.credentials[sha256.Sum256([]byte(token))] = tenant
+	}
+	return nil
+}
+
+// MultiTenant reports whether requests must carry a tenant credential
+func (s *TenantService) MultiTenant() bool {
+	return len(s.credentials) > 0
+}
+
+// DefaultTenant returns the tenant owning data in single-tenant deployments
+func (s *TenantService) DefaultTenant() *models.Tenant {
+	return s.defaultTenant
+}
+
+// ResolveTenant returns the tenant a static TENANT_CREDENTIALS token belongs to
+func (s *TenantService) ResolveTenant(credential string) (*models.Tenant, error) {
+	// Tokens are looked up by digest so lookups do not leak token prefixes through timing
+	tenant, ok := s.credentials[sha256.Sum256([]byte(credential))]
+	if !ok {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	return tenant, nil
+}
+
+func (s *TenantService) GetTenant(id uint) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := s.db.First(&tenant, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("tenant not found")
+		}
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	return &tenant, nil
+}
+
+// GetTenantByName looks a tenant up by name
+func (s *TenantService) GetTenantByName(name string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := s.db.Where("name = ?", name).First(&tenant).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("tenant not found: %s", name)
+		}
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	return &tenant, nil
+}
+
+func (s *TenantService) ensureTenant(name string) (*models.Tenant, error) {
+	if !tenantNamePattern.MatchString(name) || reservedTenantNames[name] {
+		return nil, fmt.Errorf("invalid tenant name: %s", name)
+	}
+
+	tenant := models.Tenant{Name: name}
+	if err := s.db.Where(models.Tenant{Name: name}).FirstOrCreate(&tenant).Error; err != nil {
+		return nil, fmt.Errorf("failed to create tenant %s: %w", name, err)
+	}
+	return &tenant, nil
+}
+
+// TenantBlobKey returns the blob key of a file uploaded by a tenant; each tenant's files share its name as prefix
+func TenantBlobKey(tenant *models.Tenant, filename string) string {
+	return path.Join(tenant.Name, filename)
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"path"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/draw"
+
+	"image-rag-backend/internal/blobstore"
+	"image-rag-backend/internal/config"
+	"image-rag-backend/internal/models"
+)
+
+// thumbnailWidthStep rounds requested widths up, so arbitrary widths share a bounded set of renditions
+const thumbnailWidthStep = 32
+
+// ThumbnailService renders downscaled JPEG previews of stored images. Renditions are generated on
+// first request and cached in the blob store next to the image file, so every image sharing the
+// file shares them; they are deleted along with the file.
+type ThumbnailService struct {
+	blobs  blobstore.Store
+	config config.ThumbnailConfig
+}
+
+func NewThumbnailService(blobs blobstore.Store, cfg config.ThumbnailConfig) (*ThumbnailService, error) {
+	for name, width := range cfg.Sizes {
+		if width < 1 || width > cfg.MaxWidth {
+			return nil, fmt.Errorf("invalid %s thumbnail width %d: expected 1 to %d", name, width, cfg.MaxWidth)
+		}
+	}
+	if cfg.Quality < 1 || cfg.Quality > 100 {
+		return nil, fmt.Errorf("invalid thumbnail JPEG quality %d: expected 1 to 100", cfg.Quality)
+	}
+	return &ThumbnailService{blobs: blobs, config: cfg}, nil
+}
+
+// CacheMaxAge is how long clients may cache previews
+func (s *ThumbnailService) CacheMaxAge() time.Duration {
+	return s.config.CacheMaxAge
+}
+
+// Width resolves a preview request to a rendition width: a named size, or a width w in pixels
+// rounded up to a multiple of 32 and capped at the maximum. Zero means the original file.
+// Errors start with "invalid thumbnail".
+func (s *ThumbnailService) Width(size, w string) (int, error) {
+	switch {
+	case size != "" && w != "":
+		return 0, fmt.Errorf("invalid thumbnail request: size and w cannot be combined")
+	case size != "":
+		width, ok := s.config.Sizes[size]
+		if !ok {
+			return 0, fmt.Errorf("invalid thumbnail size %q: expected small, medium or large", size)
+		}
+		return width, nil
+	case w != "":
+		width, err := strconv.Atoi(w)
+		if err != nil || width < 1 {
+			return 0, fmt.Errorf("invalid thumbnail width %q", w)
+		}
+		width = (width + thumbnailWidthStep - 1) / thumbnailWidthStep * thumbnailWidthStep
+		if width > s.config.MaxWidth {
+			width = s.config.MaxWidth
+		}
+		return width, nil
+	}
+	return 0, nil
+}
+
+// Open returns the rendition of an image at a width, generating and caching it on first use;
+// the caller must close it. Images are never upscaled, so widths past the image's own give a
+// rendition at its full size.
+func (s *ThumbnailService) Open(ctx context.Context, img *models.Image, width int) (io.ReadCloser, *blobstore.Info, error) {
+	if upright := uprightWidth(img.Metadata); upright > 0 && width > upright {
+		width = upright
+	}
+	key := thumbnailKey(img.Path, width, s.config.Quality)
+	reader, info, err := s.blobs.Get(ctx, key)
+	if err == nil {
+		return reader, info, nil
+	}
+	if !errors.Is(err, blobstore.ErrNotFound) {
+		return nil, nil, fmt.Errorf("failed to open thumbnail: %w", err)
+	}
+
+	data, err := s.render(ctx, img.Path, width)
+	if err != nil {
+		return nil, nil, err
+	}
+	// A failed write only costs the next request another render
+	if err := s.blobs.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+		fmt.Printf("Warning: failed to cache thumbnail %s: %v\n", key, err)
+	}
+	info = &blobstore.Info{Key: key, Size: int64(len(data)), ContentType: "image/jpeg", ModTime: time.Now()}
+	return bytesBlob{bytes.NewReader(data)}, info, nil
+}
+
+// bytesBlob is a rendition held in memory; like the blobs the stores return it can seek
+type bytesBlob struct {
+	*bytes.Reader
+}
+
+func (bytesBlob) Close() error {
+	return nil
+}
+
+// render decodes an image file, turns it upright and encodes it as a JPEG of the given width
+func (s *ThumbnailService) render(ctx context.Context, key string, width int) ([]byte, error) {
+	reader, _, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return nil, fmt.Errorf("image file not found")
+		}
+		return nil, err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+
+	src, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	orientation := 0
+	if x := readEXIF(bytes.NewReader(data), sniffImageType(data)); x != nil {
+		orientation = exifOrientation(x)
+	}
+
+	// Scale the stored pixels before turning them upright, so the width applies to the upright image
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	if width > w {
+		width = w
+	}
+	height := (h*width + w/2) / w
+	if height < 1 {
+		height = 1
+	}
+	size := image.Rect(0, 0, width, height)
+	if orientation >= 5 {
+		size = image.Rect(0, 0, height, width)
+	}
+	dst := image.NewNRGBA(size)
+	draw.CatmullRom.Scale(dst, size, src, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flatten(orient(dst, orientation)), &jpeg.Options{Quality: s.config.Quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ETag is the entity tag of an image's preview at a width, zero for the original file.
+// Image files never change, so the tag only depends on the file and the rendition.
+func (s *ThumbnailService) ETag(img *models.Image, width int) string {
+	tag := img.Digest
+	if tag == "" {
+		tag = fmt.Sprintf("image-%d", img.ID)
+	}
+	if width > 0 {
+		if upright := uprightWidth(img.Metadata); upright > 0 && width > upright {
+			width = upright
+		}
+		tag += fmt.Sprintf("-w%d-q%d", width, s.config.Quality)
+	}
+	return strconv.Quote(tag)
+}
+
+// uprightWidth is the width of an image once its EXIF orientation is applied; zero when unknown
+func uprightWidth(metadata models.ImageMetadata) int {
+	if metadata.Orientation >= 5 {
+		return metadata.Height
+	}
+	return metadata.Width
+}
+
+// thumbnailPrefix is the blob key prefix of the renditions of an image file
+func thumbnailPrefix(imageKey string) string {
+	return path.Join(path.Dir(imageKey), "thumbnails", path.Base(imageKey)) + "/"
+}
+
+func thumbnailKey(imageKey string, width, quality int) string {
+	return fmt.Sprintf("%sw%d-q%d.jpg", thumbnailPrefix(imageKey), width, quality)
+}
+
+// deleteThumbnails deletes the cached renditions of an image file
+func deleteThumbnails(ctx context.Context, blobs blobstore.Store, imageKey string) error {
+	var keys []string
+	if err := blobs.List(ctx, thumbnailPrefix(imageKey), func(info blobstore.Info) error {
+		keys = append(keys, info.Key)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := blobs.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
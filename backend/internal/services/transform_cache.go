@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// transformCache keeps transformed images as files in a directory, deleting the least recently
+// used once their total size passes a bound. The index is rebuilt from the directory on startup,
+// taking modification times as the last use, so the bound holds across restarts.
+type transformCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*transformCacheEntry
+	size    int64
+}
+
+type transformCacheEntry struct {
+	size int64
+	used time.Time
+}
+
+func newTransformCache(dir string, maxBytes int64) (*transformCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create transform cache directory: %w", err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transform cache directory: %w", err)
+	}
+
+	c := &transformCache{dir: dir, maxBytes: maxBytes, entries: make(map[string]*transformCacheEntry)}
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		// Leftovers of writes interrupted by a crash
+		if filepath.Ext(file.Name()) == ".tmp" {
+			os.Remove(filepath.Join(dir, file.Name()))
+			continue
+		}
+		c.entries[file.Name()] = &transformCacheEntry{size: info.Size(), used: info.ModTime()}
+		c.size += info.Size()
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// get reads a cached image and marks it used
+func (c *transformCache) get(name string) ([]byte, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	if ok {
+		entry.used = time.Now()
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	path := filepath.Join(c.dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// Deleted from under the cache, or evicted since the lookup
+		c.mu.Lock()
+		c.remove(name)
+		c.mu.Unlock()
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, true
+}
+
+// put stores an image, then evicts images until the cache is within its bound. Images larger
+// than the whole cache are not stored.
+func (c *transformCache) put(name string, data []byte) error {
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return nil
+	}
+
+	// Write to a temporary file first, so readers never see a partial image
+	file, err := os.CreateTemp(c.dir, name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(c.dir, name))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[name]; ok {
+		c.size -= entry.size
+	}
+	c.entries[name] = &transformCacheEntry{size: size, used: time.Now()}
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// evict deletes the least recently used images until the cache is within its bound; the caller holds mu
+func (c *transformCache) evict() {
+	if c.size <= c.maxBytes {
+		return
+	}
+	names := make([]string, 0, len(c.entries))
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return c.entries[names[i]].used.Before(c.entries[names[j]].used)
+	})
+	for _, name := range names {
+		if c.size <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Warning: failed to evict cached transform %s: %v\n", name, err)
+			continue
+		}
+		c.remove(name)
+	}
+}
+
+// remove drops an image from the index; the caller holds mu
+func (c *transformCache) remove(name string) {
+	if entry, ok := c.entries[name]; ok {
+		c.size -= entry.size
+		delete(c.entries, name)
+	}
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"image-rag-backend/internal/authz"
+	"image-rag-backend/internal/blobstore"
+	"image-rag-backend/internal/database"
+	"image-rag-backend/internal/logger"
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// TrashPartitionName is the vector store partition holding the vectors of trashed images.
+// Searches always name the dataset partitions they cover, so trashed vectors never match.
+const TrashPartitionName = "_trash"
+
+// purgeBatchSize is the number of expired records or images loaded per purge query
+const purgeBatchSize = 100
+
+// purgeActor is recorded in the audit log for permanent deletions made by the purger
+var purgeActor = AuditActor{ID: "system:purger"}
+
+// TrashService lists, restores and purges soft-deleted records and images.
+// A trashed image's vector sits in the trash partition, as do the vectors of every
+// image of a trashed record.
+type TrashService struct {
+	db            *gorm.DB
+	vectorService *VectorService
+	tagService    *TagService
+	blobs         blobstore.Store
+	// retention is how long trashed items stay restorable; zero keeps them forever
+	retention time.Duration
+}
+
+func NewTrashService(vectorService *VectorService, tagService *TagService, blobs blobstore.Store,
+	retention time.Duration) *TrashService {
+	return &TrashService{
+		db:            database.DB,
+		vectorService: vectorService,
+		tagService:    tagService,
+		blobs:         blobs,
+		retention:     retention,
+	}
+}
+
+// ListTrash returns the tenant's trashed records and images the principal may see, most recently deleted first
+func (s *TrashService) ListTrash(tenantID uint, principal *models.Principal) (*models.TrashResponse, error) {
+	var records []models.Record
+	if err := s.db.Unscoped().Scopes(authz.VisibleRecords(principal)).
+		Where("records.tenant_id = ? AND records.deleted_at IS NOT NULL", tenantID).
+		Order("records.deleted_at DESC").
+		Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to list trashed records: %w", err)
+	}
+
+	var images []models.Image
+	if err := s.db.Unscoped().
+		Joins("JOIN records ON records.id = images.record_id").
+		Scopes(authz.VisibleRecords(principal)).
+		Where("images.tenant_id = ? AND images.deleted_at IS NOT NULL", tenantID).
+		Order("images.deleted_at DESC").
+		Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("failed to list trashed images: %w", err)
+	}
+
+	response := &models.TrashResponse{
+		Records: make([]models.TrashedRecord, len(records)),
+		Images:  make([]models.TrashedImage, len(images)),
+	}
+	for i, record := range records {
+		response.Records[i] = models.TrashedRecord{Record: record, PurgeAt: s.purgeAt(record.DeletedAt)}
+	}
+	for i, image := range images {
+		response.Images[i] = models.TrashedImage{Image: image, PurgeAt: s.purgeAt(image.DeletedAt)}
+	}
+	return response, nil
+}
+
+// FindRecord returns a record whether or not it is in the trash
+func (s *TrashService) FindRecord(tenantID, id uint) (*models.Record, error) {
+	var record models.Record
+	if err := s.db.Unscoped().Where("tenant_id = ?", tenantID).First(&record, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("record not found")
+		}
+		return nil, fmt.Errorf("failed to get record: %w", err)
+	}
+	return &record, nil
+}
+
+// FindImage returns an image whether or not it is in the trash
+func (s *TrashService) FindImage(tenantID, id uint) (*models.Image, error) {
+	var image models.Image
+	if err := s.db.Unscoped().Where("tenant_id = ?", tenantID).First(&image, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("image not found")
+		}
+		return nil, fmt.Errorf("failed to get image: %w", err)
+	}
+	return &image, nil
+}
+
+// RestoreRecord takes a record out of the trash and makes its images searchable again.
+// Images that were trashed on their own stay in the trash.
+func (s *TrashService) RestoreRecord(actor AuditActor, tenantID, id uint) (*models.Record, error) {
+	record, err := s.FindRecord(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !record.DeletedAt.Valid {
+		return nil, fmt.Errorf("record %d is not in the trash", id)
+	}
+
+	var images []models.Image
+	if err := s.db.Where("tenant_id = ? AND record_id = ?", tenantID, id).Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("failed to get images: %w", err)
+	}
+	// Vectors move first so a failure leaves the record in the trash, where stray vectors are harmless
+	if err := s.restoreVectors(tenantID, record.DatasetID, images); err != nil {
+		return nil, err
+	}
+
+	deletedAt := record.DeletedAt.Time
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(record).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore record: %w", err)
+		}
+		return writeAudit(tx, actor, tenantID, models.AuditActionRestore, models.AuditEntityRecord, record.ID,
+			map[string]interface{}{"deleted_at": deletedAt}, map[string]interface{}{"deleted_at": nil})
+	}); err != nil {
+		return nil, err
+	}
+
+	var restored models.Record
+	if err := s.db.Preload("Images.Tags").Preload("Tags").First(&restored, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to get record: %w", err)
+	}
+	return &restored, nil
+}
+
+// RestoreImage takes an image out of the trash; its record must not be in the trash
+func (s *TrashService) RestoreImage(actor AuditActor, tenantID, id uint) (*models.Image, error) {
+	image, err := s.FindImage(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !image.DeletedAt.Valid {
+		return nil, fmt.Errorf("image %d is not in the trash", id)
+	}
+	record, err := s.FindRecord(tenantID, image.RecordID)
+	if err != nil {
+		return nil, err
+	}
+	if record.DeletedAt.Valid {
+		return nil, fmt.Errorf("record %d is in the trash; restore the record first", record.ID)
+	}
+
+	if err := s.restoreVectors(tenantID, record.DatasetID, []models.Image{*image}); err != nil {
+		return nil, err
+	}
+
+	deletedAt := image.DeletedAt.Time
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(image).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore image: %w", err)
+		}
+		if err := writeAudit(tx, actor, tenantID, models.AuditActionRestore, models.AuditEntityImage, image.ID,
+			map[string]interface{}{"deleted_at": deletedAt}, map[string]interface{}{"deleted_at": nil}); err != nil {
+			return err
+		}
+		_, err := writeVersion(tx, actor, image.RecordID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	var restored models.Image
+	if err := s.db.Preload("Tags").First(&restored, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to get image: %w", err)
+	}
+	return &restored, nil
+}
+
+// PurgeExpired permanently deletes the records and images trashed longer than the
+// retention period, with their vectors and files. It returns how many rows were purged.
+func (s *TrashService) PurgeExpired() (int, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-s.retention)
+	purged := 0
+
+	// Records go first since purging a record purges all of its images
+	for {
+		var records []models.Record
+		if err := s.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Limit(purgeBatchSize).Find(&records).Error; err != nil {
+			return purged, fmt.Errorf("failed to find expired records: %w", err)
+		}
+		if len(records) == 0 {
+			break
+		}
+		for i := range records {
+			n, err := s.purgeRecord(&records[i])
+			if err != nil {
+				return purged, err
+			}
+			purged += n
+		}
+	}
+
+	for {
+		var images []models.Image
+		if err := s.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Limit(purgeBatchSize).Find(&images).Error; err != nil {
+			return purged, fmt.Errorf("failed to find expired images: %w", err)
+		}
+		if len(images) == 0 {
+			break
+		}
+		for i := range images {
+			if err := s.purgeImages(images[i].TenantID, images[i:i+1], nil); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// StartPurger purges expired trash now and then every interval for the life of the process
+func (s *TrashService) StartPurger(interval time.Duration, log *logger.Logger) {
+	if s.retention <= 0 || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			purged, err := s.PurgeExpired()
+			if err != nil {
+				log.Error("Failed to purge trash: %v", err)
+			} else if purged > 0 {
+				log.Info("Purged %d expired records and images from the trash", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// purgeRecord permanently deletes a trashed record with all of its images
+func (s *TrashService) purgeRecord(record *models.Record) (int, error) {
+	var images []models.Image
+	if err := s.db.Unscoped().Where("record_id = ?", record.ID).Find(&images).Error; err != nil {
+		return 0, fmt.Errorf("failed to get images of record %d: %w", record.ID, err)
+	}
+	if err := s.purgeImages(record.TenantID, images, record); err != nil {
+		return 0, err
+	}
+	return len(images) + 1, nil
+}
+
+// purgeImages permanently deletes images, and their record when one is given. Vectors are
+// deleted first so a failure leaves the rows behind for the next run to retry.
+func (s *TrashService) purgeImages(tenantID uint, images []models.Image, record *models.Record) error {
+	for _, image := range images {
+		for _, vectorID := range image.VectorIDs() {
+			if err := s.vectorService.DeleteVector(vectorID); err != nil {
+				return fmt.Errorf("failed to delete vector %s: %w", vectorID, err)
+			}
+		}
+	}
+
+	var released []*releasedBlob
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		for i := range images {
+			if err := tx.Unscoped().Delete(&images[i]).Error; err != nil {
+				return fmt.Errorf("failed to purge image %d: %w", images[i].ID, err)
+			}
+			blob, err := releaseBlob(tx, tenantID, images[i].Digest, images[i].Path)
+			if err != nil {
+				return err
+			}
+			released = append(released, blob)
+			if err := writeAudit(tx, purgeActor, tenantID, models.AuditActionPurge, models.AuditEntityImage,
+				images[i].ID, imageSnapshot(&images[i]), nil); err != nil {
+				return err
+			}
+		}
+		if record == nil {
+			return nil
+		}
+		if err := tx.Unscoped().Delete(record).Error; err != nil {
+			return fmt.Errorf("failed to purge record %d: %w", record.ID, err)
+		}
+		return writeAudit(tx, purgeActor, tenantID, models.AuditActionPurge, models.AuditEntityRecord, record.ID,
+			recordSnapshot(record), nil)
+	}); err != nil {
+		return err
+	}
+
+	deleteReleasedFiles(s.db, s.blobs, released)
+	return nil
+}
+
+// restoreVectors moves image vectors out of the trash into their dataset's partition with their current tags
+func (s *TrashService) restoreVectors(tenantID, datasetID uint, images []models.Image) error {
+	if len(images) == 0 {
+		return nil
+	}
+
+	var dataset models.Dataset
+	if err := s.db.Where("tenant_id = ?", tenantID).First(&dataset, datasetID).Error; err != nil {
+		return fmt.Errorf("failed to get dataset: %w", err)
+	}
+
+	for _, image := range images {
+		tags, err := s.tagService.EffectiveImageTags(tenantID, image.ID)
+		if err != nil {
+			return err
+		}
+		for _, vectorID := range image.VectorIDs() {
+			if err := s.vectorService.RestoreVector(vectorID, tags, dataset.PartitionName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// purgeAt returns when a trashed item will be purged, or nil when the trash is kept forever
+func (s *TrashService) purgeAt(deletedAt gorm.DeletedAt) *time.Time {
+	if s.retention <= 0 || !deletedAt.Valid {
+		return nil
+	}
+	at := deletedAt.Time.Add(s.retention)
+	return &at
+}
@@ -1,18 +1,24 @@
 package services
 
 import (
+	"encoding/base64"
 	"fmt"
+	"io"
+	"math"
+	"os"
 	"sync"
 	"time"
 
 	"image-rag-backend/internal/config"
 	"image-rag-backend/internal/doubao"
 	"image-rag-backend/internal/milvus"
+	"image-rag-backend/internal/models"
 )
 
 type VectorService struct {
 	doubaoClient *doubao.Client
 	milvusClient *milvus.Client
+	preprocessor *ImagePreprocessor
 	config       *config.Config
 }
 
@@ -21,13 +27,38 @@ type VectorResult struct {
 	Vector   []float32
 }
 
+// maxSearchTopK is the largest number of results Milvus returns from one search
+const maxSearchTopK = 16384
+
 type SearchResult struct {
 	ImageID  string
 	Distance float32
 }
 
+// VectorMetadata is stored alongside an image vector
+type VectorMetadata struct {
+	Tags []string
+	// Partition is the vector store partition of the image's dataset
+	Partition string
+}
+
+// SearchOptions controls how similar images are retrieved and ranked
+type SearchOptions struct {
+	TopK int
+	// Diversity in [0, 1] re-ranks results with maximal marginal relevance; 0 disables it
+	Diversity float64
+	// Tags restricts results to images carrying all of the given tags
+	Tags []string
+	// Partitions restricts results to the given dataset partitions
+	Partitions []string
+}
+
 func NewVectorService(cfg *config.Config) (*VectorService, error) {
 	doubaoClient := doubao.NewClient(&cfg.Doubao)
+	preprocessor, err := NewImagePreprocessor(cfg.Preprocess)
+	if err != nil {
+		return nil, err
+	}
 
 	milvusClient, err := milvus.NewClient(&cfg.Milvus)
 	if err != nil {
@@ -38,17 +69,101 @@ func NewVectorService(cfg *config.Config) (*VectorService, error) {
 	if err := milvusClient.CreateCollection(); err != nil {
 		return nil, fmt.Errorf("failed to create/load milvus collection: %w", err)
 	}
+	if err := milvusClient.CreatePartition(TrashPartitionName); err != nil {
+		return nil, fmt.Errorf("failed to create trash partition: %w", err)
+	}
 
 	return &VectorService{
 		doubaoClient: doubaoClient,
 		milvusClient: milvusClient,
+		preprocessor: preprocessor,
 		config:       cfg,
 	}, nil
 }
 
-func (s *VectorService) GenerateVector(imagePath string) (string, error) {
+// Transform describes the preprocessing images currently get before they are embedded
+func (s *VectorService) Transform() string {
+	return s.preprocessor.Transform()
+}
+
+// embed preprocesses image data in the given format, e.g. "png", and generates its embedding
+func (s *VectorService) embed(data []byte, format string) ([]float32, error) {
+	data, format, err := s.preprocessor.Process(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preprocess image: %w", err)
+	}
+	return s.doubaoClient.GenerateEmbeddingFromBase64(base64.StdEncoding.EncodeToString(data), format)
+}
+
+// embedKeyFrames preprocesses image data in the given format and generates an embedding per key frame
+func (s *VectorService) embedKeyFrames(data []byte, format string) ([][]float32, error) {
+	frames, format, err := s.preprocessor.KeyFrames(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preprocess image: %w", err)
+	}
+	embeddings := make([][]float32, len(frames))
+	for i, frame := range frames {
+		embeddings[i], err = s.doubaoClient.GenerateEmbeddingFromBase64(base64.StdEncoding.EncodeToString(frame), format)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return embeddings, nil
+}
+
+// insertFrames stores one vector per key frame under the IDs models.FrameVectorID gives,
+// deleting those already stored when one fails
+func (s *VectorService) insertFrames(vectorID string, embeddings [][]float32, meta VectorMetadata) error {
+	for i, embedding := range embeddings {
+		if _, err := s.milvusClient.InsertVector(milvus.VectorData{
+			VectorID:  models.FrameVectorID(vectorID, i),
+			Vector:    embedding,
+			Tags:      meta.Tags,
+			Partition: meta.Partition,
+		}); err != nil {
+			for _, id := range models.ImageVectorIDs(vectorID, i) {
+				_ = s.milvusClient.DeleteVector(id)
+			}
+			return fmt.Errorf("failed to insert vector into milvus: %w", err)
+		}
+	}
+	return nil
+}
+
+// embedFile embeds the image file at a path
+func (s *VectorService) embedFile(imagePath string) ([]float32, error) {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	return s.embed(data, imageFormat(imagePath))
+}
+
+// embedReader embeds image data read from r; filename supplies the image format
+func (s *VectorService) embedReader(r io.Reader, filename string) ([]float32, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	return s.embed(data, imageFormat(filename))
+}
+
+// embedBase64 embeds base64 image data in the given format, jpeg when empty
+func (s *VectorService) embedBase64(base64Data string, format string) ([]float32, error) {
+	data, err := decodeBase64Image(base64Data)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = "jpeg"
+	}
+	return s.embed(data, format)
+}
+
+// GenerateVector embeds an image and stores the vector with the given metadata
+func (s *VectorService) GenerateVector(imagePath string, meta VectorMetadata) (string, error) {
 	// Generate embedding using Doubao
-	embedding, err := s.doubaoClient.GenerateEmbedding(imagePath)
+	embedding, err := s.embedFile(imagePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate embedding: %w", err)
 	}
@@ -57,7 +172,12 @@ func (s *VectorService) GenerateVector(imagePath string) (string, error) {
 	vectorID := generateUUID()
 
 	// Insert into Milvus
-	_, err = s.milvusClient.InsertVector(vectorID, embedding)
+	_, err = s.milvusClient.InsertVector(milvus.VectorData{
+		VectorID:  vectorID,
+		Vector:    embedding,
+		Tags:      meta.Tags,
+		Partition: meta.Partition,
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to insert vector into milvus: %w", err)
 	}
@@ -66,9 +186,33 @@ func (s *VectorService) GenerateVector(imagePath string) (string, error) {
 	return vectorID, nil
 }
 
-func (s *VectorService) GenerateVectorFromFile(imagePath string) (string, []float32, error) {
+// GenerateVectorFromReader embeds image data read from r, such as a stored blob, and stores the
+// vector with the given metadata; filename supplies the image format. Animations store a vector
+// per key frame and return their number of key frames, which is zero for still images.
+func (s *VectorService) GenerateVectorFromReader(image io.Reader, filename string,
+	meta VectorMetadata) (string, int, error) {
+	data, err := io.ReadAll(image)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read image: %w", err)
+	}
+	embeddings, err := s.embedKeyFrames(data, imageFormat(filename))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to generate embedding: %w", err)
+	}
+
+	vectorID := generateUUID()
+	if err := s.insertFrames(vectorID, embeddings, meta); err != nil {
+		return "", 0, err
+	}
+	if len(embeddings) == 1 {
+		return vectorID, 0, nil
+	}
+	return vectorID, len(embeddings), nil
+}
+
+func (s *VectorService) GenerateVectorFromFile(imagePath string, meta VectorMetadata) (string, []float32, error) {
 	// Generate embedding using Doubao
-	embedding, err := s.doubaoClient.GenerateEmbedding(imagePath)
+	embedding, err := s.embedFile(imagePath)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to generate embedding: %w", err)
 	}
@@ -77,7 +221,12 @@ func (s *VectorService) GenerateVectorFromFile(imagePath string) (string, []floa
 	vectorID := generateUUID()
 
 	// Insert into Milvus
-	_, err = s.milvusClient.InsertVector(vectorID, embedding)
+	_, err = s.milvusClient.InsertVector(milvus.VectorData{
+		VectorID:  vectorID,
+		Vector:    embedding,
+		Tags:      meta.Tags,
+		Partition: meta.Partition,
+	})
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to insert vector into milvus: %w", err)
 	}
@@ -86,48 +235,141 @@ func (s *VectorService) GenerateVectorFromFile(imagePath string) (string, []floa
 	return vectorID, embedding, nil
 }
 
-func (s *VectorService) SearchSimilar(imagePath string, topK int) ([]SearchResult, error) {
+func (s *VectorService) SearchSimilar(imagePath string, opts SearchOptions) ([]SearchResult, error) {
 	// Generate embedding for query image
-	embedding, err := s.doubaoClient.GenerateEmbedding(imagePath)
+	embedding, err := s.embedFile(imagePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
 	}
 
-	// Search in Milvus
-	results, err := s.milvusClient.SearchSimilar(embedding, topK)
+	return s.SearchSimilarWithVector(embedding, opts)
+}
+
+// SearchSimilarFromReader searches for images similar to image data read from r; filename supplies the image format
+func (s *VectorService) SearchSimilarFromReader(image io.Reader, filename string, opts SearchOptions) ([]SearchResult, error) {
+	embedding, err := s.embedReader(image, filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search similar vectors: %w", err)
+		return nil, fmt.Errorf("failed to generate embedding: %w", err)
+	}
+
+	return s.SearchSimilarWithVector(embedding, opts)
+}
+
+func (s *VectorService) SearchSimilarWithVector(vector []float32, opts SearchOptions) ([]SearchResult, error) {
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = 10
 	}
 
-	// Convert to our result format
-	var searchResults []SearchResult
-	for _, result := range results {
-		searchResults = append(searchResults, SearchResult{
-			ImageID:  result.VectorID,
-			Distance: result.Distance,
-		})
+	// Over-fetch candidates when results will be diversified
+	fetchK := topK
+	if opts.Diversity > 0 {
+		fetchK = CandidatePoolSize(topK)
 	}
 
-	return searchResults, nil
+	searchResults, err := s.searchImages(vector, fetchK, milvus.SearchFilter{
+		Tags:       opts.Tags,
+		Partitions: opts.Partitions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Diversity <= 0 || len(searchResults) <= 1 {
+		return searchResults, nil
+	}
+
+	return s.diversify(vector, searchResults, topK, opts.Diversity)
 }
 
-func (s *VectorService) SearchSimilarWithVector(vector []float32, topK int) ([]SearchResult, error) {
-	// Search in Milvus
-	results, err := s.milvusClient.SearchSimilar(vector, topK)
+// searchImages returns up to limit distinct images nearest to a vector. The key frames of an
+// animation are separate vectors collapsing into one image, so the search widens by the key
+// frame count until it finds limit images or runs out of vectors.
+func (s *VectorService) searchImages(vector []float32, limit int, filter milvus.SearchFilter) ([]SearchResult, error) {
+	growth := s.config.Preprocess.MaxFrames
+	if growth < 2 {
+		growth = 2
+	}
+
+	for k := limit; ; k *= growth {
+		if k > maxSearchTopK {
+			k = maxSearchTopK
+		}
+		results, err := s.milvusClient.SearchSimilar(vector, k, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search similar vectors: %w", err)
+		}
+
+		// Keep the best match among the key frames of an animation
+		var searchResults []SearchResult
+		seen := make(map[string]bool, len(results))
+		for _, result := range results {
+			vectorID := models.BaseVectorID(result.VectorID)
+			if seen[vectorID] {
+				continue
+			}
+			seen[vectorID] = true
+			searchResults = append(searchResults, SearchResult{
+				ImageID:  vectorID,
+				Distance: result.Distance,
+			})
+			if len(searchResults) == limit {
+				break
+			}
+		}
+		if len(searchResults) == limit || len(results) < k || k == maxSearchTopK {
+			return searchResults, nil
+		}
+	}
+}
+
+// diversify re-ranks candidates with MMR using their stored vectors
+func (s *VectorService) diversify(query []float32, candidates []SearchResult, topK int, diversity float64) ([]SearchResult, error) {
+	ids := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		ids[i] = candidate.ImageID
+	}
+
+	vectors, err := s.milvusClient.GetVectors(ids)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search similar vectors: %w", err)
+		return nil, fmt.Errorf("failed to fetch candidate vectors: %w", err)
 	}
 
-	// Convert to our result format
-	var searchResults []SearchResult
-	for _, result := range results {
-		searchResults = append(searchResults, SearchResult{
-			ImageID:  result.VectorID,
-			Distance: result.Distance,
-		})
+	return rerankMMR(query, candidates, vectors, topK, diversity), nil
+}
+
+// UpdateVectorTags replaces the filterable tags stored with a vector
+func (s *VectorService) UpdateVectorTags(vectorID string, tags []string, partition string) error {
+	if err := s.milvusClient.ReplaceTags(vectorID, tags, partition); err != nil {
+		return fmt.Errorf("failed to update vector tags: %w", err)
 	}
+	return nil
+}
 
-	return searchResults, nil
+// TrashVector moves a vector into the trash partition, which searches never include
+func (s *VectorService) TrashVector(vectorID string) error {
+	if err := s.milvusClient.MoveVector(vectorID, nil, TrashPartitionName); err != nil {
+		return fmt.Errorf("failed to move vector to trash: %w", err)
+	}
+	return nil
+}
+
+// RestoreVector moves a trashed vector back into its dataset partition with its current tags
+func (s *VectorService) RestoreVector(vectorID string, tags []string, partition string) error {
+	if err := s.milvusClient.MoveVector(vectorID, tags, partition); err != nil {
+		return fmt.Errorf("failed to restore vector: %w", err)
+	}
+	return nil
+}
+
+// CreatePartition creates the vector store partition backing a dataset
+func (s *VectorService) CreatePartition(name string) error {
+	return s.milvusClient.CreatePartition(name)
+}
+
+// DropPartition drops a dataset partition and all of its vectors
+func (s *VectorService) DropPartition(name string) error {
+	return s.milvusClient.DropPartition(name)
 }
 
 func (s *VectorService) DeleteVector(vectorID string) error {
@@ -171,12 +413,12 @@ func (s *VectorService) Close() error {
 
 // ProcessImage handles the complete image processing pipeline
 func (s *VectorService) ProcessImage(imagePath string) (string, error) {
-	return s.GenerateVector(imagePath)
+	return s.GenerateVector(imagePath, VectorMetadata{})
 }
 
 // ProcessImageWithEmbedding handles the complete image processing pipeline with embedding
 func (s *VectorService) ProcessImageWithEmbedding(imagePath string) (string, []float32, error) {
-	return s.GenerateVectorFromFile(imagePath)
+	return s.GenerateVectorFromFile(imagePath, VectorMetadata{})
 }
 
 // BatchProcessImages processes multiple images concurrently
@@ -228,9 +470,10 @@ func (s *VectorService) AsyncProcessImage(imagePath string, resultChan chan<- st
 }
 
 // GenerateVectorFromBase64 generates vector from base64 image data
-func (s *VectorService) GenerateVectorFromBase64(base64Data string, format string) (string, []float32, error) {
+func (s *VectorService) GenerateVectorFromBase64(base64Data string, format string,
+	meta VectorMetadata) (string, []float32, error) {
 	// Generate embedding using Doubao
-	embedding, err := s.doubaoClient.GenerateEmbeddingFromBase64(base64Data, format)
+	embedding, err := s.embedBase64(base64Data, format)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to generate embedding: %w", err)
 	}
@@ -239,7 +482,12 @@ func (s *VectorService) GenerateVectorFromBase64(base64Data string, format strin
 	vectorID := generateUUID()
 
 	// Insert into Milvus
-	_, err = s.milvusClient.InsertVector(vectorID, embedding)
+	_, err = s.milvusClient.InsertVector(milvus.VectorData{
+		VectorID:  vectorID,
+		Vector:    embedding,
+		Tags:      meta.Tags,
+		Partition: meta.Partition,
+	})
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to insert vector into milvus: %w", err)
 	}
@@ -249,29 +497,14 @@ func (s *VectorService) GenerateVectorFromBase64(base64Data string, format strin
 }
 
 // SearchSimilarFromBase64 searches for similar images from base64 image data
-func (s *VectorService) SearchSimilarFromBase64(base64Data string, format string, topK int) ([]SearchResult, error) {
+func (s *VectorService) SearchSimilarFromBase64(base64Data string, format string, opts SearchOptions) ([]SearchResult, error) {
 	// Generate embedding for query image
-	embedding, err := s.doubaoClient.GenerateEmbeddingFromBase64(base64Data, format)
+	embedding, err := s.embedBase64(base64Data, format)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
 	}
 
-	// Search in Milvus
-	results, err := s.milvusClient.SearchSimilar(embedding, topK)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search similar vectors: %w", err)
-	}
-
-	// Convert to our result format
-	var searchResults []SearchResult
-	for _, result := range results {
-		searchResults = append(searchResults, SearchResult{
-			ImageID:  result.VectorID,
-			Distance: result.Distance,
-		})
-	}
-
-	return searchResults, nil
+	return s.SearchSimilarWithVector(embedding, opts)
 }
 
 // generateUUID generates a unique identifier
@@ -312,8 +545,7 @@ func NormalizeVector(vector []float32) []float32 {
 
 // sqrt32 calculates square root for float32
 func sqrt32(x float32) float32 {
-	// Simple implementation - in production use math.Sqrt(float64(x))
-	return float32(1.0) // Placeholder - use proper implementation
+	return float32(math.Sqrt(float64(x)))
 }
 
 // CalculateSimilarity calculates cosine similarity between two vectors
@@ -336,11 +568,51 @@ func CalculateSimilarity(vec1, vec2 []float32) float32 {
 	return dotProduct / (sqrt32(norm1) * sqrt32(norm2))
 }
 
+// CopyVector stores the embeddings of an existing image's vector and its other key frames again
+// with new metadata, so images with identical bytes share embeddings without another call to the embedding API
+func (s *VectorService) CopyVector(vectorID string, keyFrames int, meta VectorMetadata) (string, error) {
+	ids := models.ImageVectorIDs(vectorID, keyFrames)
+	vectors, err := s.milvusClient.GetVectors(ids)
+	if err != nil {
+		return "", err
+	}
+	embeddings := make([][]float32, len(ids))
+	for i, id := range ids {
+		embedding, ok := vectors[id]
+		if !ok {
+			return "", fmt.Errorf("vector not found: %s", id)
+		}
+		embeddings[i] = embedding
+	}
+
+	copyID := generateUUID()
+	if err := s.insertFrames(copyID, embeddings, meta); err != nil {
+		return "", err
+	}
+	return copyID, nil
+}
+
 // GetVectorByID retrieves a vector by its ID
 func (s *VectorService) GetVectorByID(vectorID string) ([]float32, error) {
-	// This would require implementing a get operation in Milvus
-	// For now, return empty vector
-	return make([]float32, 1024), nil
+	vectors, err := s.milvusClient.GetVectors([]string{vectorID})
+	if err != nil {
+		return nil, err
+	}
+
+	vector, ok := vectors[vectorID]
+	if !ok {
+		return nil, fmt.Errorf("vector not found: %s", vectorID)
+	}
+	return vector, nil
+}
+
+// GetVectors retrieves the stored vectors with the given IDs; IDs without a vector are left out
+func (s *VectorService) GetVectors(vectorIDs []string) (map[string][]float32, error) {
+	vectors, err := s.milvusClient.GetVectors(vectorIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch vectors: %w", err)
+	}
+	return vectors, nil
 }
 
 // GetStats returns statistics about the vector service
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"image-rag-backend/internal/database"
+	"image-rag-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// VersionService reads and reverts record version history. Versions are written by
+// the services performing mutations, in the same transaction as the change.
+type VersionService struct {
+	db            *gorm.DB
+	vectorService *VectorService
+	trashService  *TrashService
+}
+
+func NewVersionService(vectorService *VectorService, trashService *TrashService) *VersionService {
+	return &VersionService{
+		db:            database.DB,
+		vectorService: vectorService,
+		trashService:  trashService,
+	}
+}
+
+// ListVersions returns every version of a record, newest first
+func (s *VersionService) ListVersions(tenantID, recordID uint) ([]models.RecordVersion, error) {
+	var versions []models.RecordVersion
+	if err := s.db.Where("tenant_id = ? AND record_id = ?", tenantID, recordID).
+		Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list versions: %w", err)
+	}
+	return versions, nil
+}
+
+func (s *VersionService) GetVersion(tenantID, recordID uint, version int) (*models.RecordVersion, error) {
+	var v models.RecordVersion
+	if err := s.db.Where("tenant_id = ? AND record_id = ? AND version = ?", tenantID, recordID, version).
+		First(&v).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("version %d not found", version)
+		}
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+	return &v, nil
+}
+
+// DiffVersions compares the fields and image sets of two versions of a record
+func (s *VersionService) DiffVersions(tenantID, recordID uint, from, to int) (*models.RecordVersionDiff, error) {
+	fromVersion, err := s.GetVersion(tenantID, recordID, from)
+	if err != nil {
+		return nil, err
+	}
+	toVersion, err := s.GetVersion(tenantID, recordID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	added, removed := diffIDs(fromVersion.ImageIDs, toVersion.ImageIDs)
+	return &models.RecordVersionDiff{
+		From:          from,
+		To:            to,
+		Changes:       diffSnapshots(versionSnapshot(fromVersion), versionSnapshot(toVersion)),
+		ImagesAdded:   added,
+		ImagesRemoved: removed,
+	}, nil
+}
+
+// RevertRecord restores a record's fields and image set to those of an earlier version and
+// records the result as a new version. Removed images are taken back out of the trash; images
+// added since are moved to the trash. Images already purged cannot be re-attached and are reported.
+func (s *VersionService) RevertRecord(actor AuditActor, tenantID, recordID uint, version int) (*models.RevertRecordResponse, error) {
+	var record models.Record
+	if err := s.db.Where("tenant_id = ?", tenantID).First(&record, recordID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("record not found")
+		}
+		return nil, fmt.Errorf("failed to get record: %w", err)
+	}
+	target, err := s.GetVersion(tenantID, recordID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []models.Image
+	if err := s.db.Unscoped().Where("tenant_id = ? AND record_id = ?", tenantID, recordID).
+		Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("failed to get images: %w", err)
+	}
+
+	wanted := make(map[uint]bool, len(target.ImageIDs))
+	for _, id := range target.ImageIDs {
+		wanted[id] = true
+	}
+	var toRestore, toTrash []models.Image
+	for _, image := range images {
+		switch {
+		case wanted[image.ID] && image.DeletedAt.Valid:
+			toRestore = append(toRestore, image)
+		case !wanted[image.ID] && !image.DeletedAt.Valid:
+			toTrash = append(toTrash, image)
+		}
+		delete(wanted, image.ID)
+	}
+	missing := make([]uint, 0, len(wanted))
+	for id := range wanted {
+		missing = append(missing, id)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+
+	// Restored vectors move before the transaction and trashed ones after it, so a failure
+	// at any point only leaves behind vectors whose images are hidden from search anyway
+	if err := s.trashService.restoreVectors(tenantID, record.DatasetID, toRestore); err != nil {
+		return nil, err
+	}
+
+	before := recordSnapshot(&record)
+	record.Name = target.Name
+	record.Description = target.Description
+	record.Visibility = target.Visibility
+	record.Attributes = copyAttributes(target.Attributes)
+
+	newVersion := 0
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&record).Error; err != nil {
+			return fmt.Errorf("failed to revert record: %w", err)
+		}
+		if err := writeAudit(tx, actor, tenantID, models.AuditActionUpdate, models.AuditEntityRecord, record.ID,
+			before, recordSnapshot(&record)); err != nil {
+			return err
+		}
+
+		for i := range toRestore {
+			image := &toRestore[i]
+			deletedAt := image.DeletedAt.Time
+			if err := tx.Unscoped().Model(image).Update("deleted_at", nil).Error; err != nil {
+				return fmt.Errorf("failed to restore image %d: %w", image.ID, err)
+			}
+			if err := writeAudit(tx, actor, tenantID, models.AuditActionRestore, models.AuditEntityImage, image.ID,
+				map[string]interface{}{"deleted_at": deletedAt}, map[string]interface{}{"deleted_at": nil}); err != nil {
+				return err
+			}
+		}
+		for i := range toTrash {
+			image := &toTrash[i]
+			if err := tx.Delete(image).Error; err != nil {
+				return fmt.Errorf("failed to delete image %d: %w", image.ID, err)
+			}
+			if err := writeAudit(tx, actor, tenantID, models.AuditActionDelete, models.AuditEntityImage, image.ID,
+				imageSnapshot(image), nil); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		newVersion, err = writeVersion(tx, actor, record.ID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, image := range toTrash {
+		for _, vectorID := range image.VectorIDs() {
+			if err := s.vectorService.TrashVector(vectorID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var reverted models.Record
+	if err := s.db.Preload("Images.Tags").Preload("Tags").First(&reverted, recordID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get record: %w", err)
+	}
+	return &models.RevertRecordResponse{Record: &reverted, Version: newVersion, MissingImages: missing}, nil
+}
+
+// writeVersion snapshots a record's current fields and live images as its next version.
+// It runs inside the transaction of the change; the unique index on record and version
+// rejects a concurrent change that picked the same number.
+func writeVersion(tx *gorm.DB, actor AuditActor, recordID uint) (int, error) {
+	var record models.Record
+	if err := tx.First(&record, recordID).Error; err != nil {
+		return 0, fmt.Errorf("failed to get record: %w", err)
+	}
+
+	var imageIDs []uint
+	if err := tx.Model(&models.Image{}).Where("record_id = ?", recordID).Order("id").
+		Pluck("id", &imageIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to get record images: %w", err)
+	}
+
+	var latest int
+	if err := tx.Model(&models.RecordVersion{}).Where("record_id = ?", recordID).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return 0, fmt.Errorf("failed to get latest version: %w", err)
+	}
+
+	version := &models.RecordVersion{
+		TenantID:    record.TenantID,
+		RecordID:    record.ID,
+		Version:     latest + 1,
+		Name:        record.Name,
+		Description: record.Description,
+		Visibility:  record.Visibility,
+		Attributes:  copyAttributes(record.Attributes),
+		ImageIDs:    models.IDList(imageIDs),
+		Actor:       actor.ID,
+	}
+	if err := tx.Create(version).Error; err != nil {
+		return 0, fmt.Errorf("failed to write version: %w", err)
+	}
+	return version.Version, nil
+}
+
+// versionSnapshot captures the compared fields of a version
+func versionSnapshot(v *models.RecordVersion) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        v.Name,
+		"description": v.Description,
+		"visibility":  v.Visibility,
+		"attributes":  copyAttributes(v.Attributes),
+	}
+}
+
+// diffIDs returns the IDs only in to and the IDs only in from
+func diffIDs(from, to []uint) (added, removed []uint) {
+	added, removed = []uint{}, []uint{}
+	inFrom := make(map[uint]bool, len(from))
+	for _, id := range from {
+		inFrom[id] = true
+	}
+	inTo := make(map[uint]bool, len(to))
+	for _, id := range to {
+		inTo[id] = true
+		if !inFrom[id] {
+			added = append(added, id)
+		}
+	}
+	for _, id := range from {
+		if !inTo[id] {
+			removed = append(removed, id)
+		}
+	}
+	return added, removed
+}
@@ -4,39 +4,220 @@
 CREATE DATABASE IF NOT EXISTS image_rag CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
 USE image_rag;
 
+-- Tenants own all other data
+CREATE TABLE IF NOT EXISTS tenants (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_tenants_name (name)
+);
+
+INSERT INTO tenants (name) VALUES ('default');
+
+-- Datasets partition records and their Milvus vectors
+CREATE TABLE IF NOT EXISTS datasets (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 0,
+    name VARCHAR(64) NOT NULL,
+    description TEXT,
+    partition_name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_datasets_tenant_name (tenant_id, name)
+);
+
+INSERT INTO datasets (tenant_id, name, partition_name) VALUES (1, 'default', '_default');
+
 -- Records table for image metadata
 CREATE TABLE IF NOT EXISTS records (
     id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 0,
+    dataset_id BIGINT NOT NULL DEFAULT 0,
+    owner_id VARCHAR(191) NOT NULL DEFAULT '',
+    visibility VARCHAR(16) NOT NULL DEFAULT 'tenant',
     name VARCHAR(255) NOT NULL,
     description TEXT,
+    attributes JSON,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    -- Millisecond precision keeps ETags distinct for updates within the same second
+    updated_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    deleted_at TIMESTAMP NULL,
     INDEX idx_name (name),
-    INDEX idx_created_at (created_at)
+    INDEX idx_tenant_id (tenant_id),
+    INDEX idx_dataset_id (dataset_id),
+    INDEX idx_owner_id (owner_id),
+    INDEX idx_created_at (created_at),
+    INDEX idx_records_deleted_at (deleted_at),
+    FULLTEXT INDEX idx_records_fulltext (name, description)
 );
 
 -- Images table for storing image file references
 CREATE TABLE IF NOT EXISTS images (
     id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 0,
     record_id BIGINT NOT NULL,
     filename VARCHAR(255) NOT NULL,
     path VARCHAR(500) NOT NULL,
     vector_id VARCHAR(100) NOT NULL,
+    attributes JSON,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    digest VARCHAR(64),
+    p_hash BIGINT,
+    d_hash BIGINT,
+    duplicate_of BIGINT,
+    width INT NOT NULL DEFAULT 0,
+    height INT NOT NULL DEFAULT 0,
+    size BIGINT NOT NULL DEFAULT 0,
+    mime_type VARCHAR(64),
+    color_mode VARCHAR(16),
+    frame_count INT NOT NULL DEFAULT 0,
+    camera_make VARCHAR(128),
+    camera_model VARCHAR(128),
+    captured_at TIMESTAMP NULL,
+    gps_latitude DOUBLE,
+    gps_longitude DOUBLE,
+    orientation INT NOT NULL DEFAULT 0,
+    embedding_transform VARCHAR(255) NOT NULL DEFAULT '',
+    key_frames INT NOT NULL DEFAULT 0,
+    deleted_at TIMESTAMP NULL,
+    INDEX idx_tenant_id (tenant_id),
     INDEX idx_record_id (record_id),
     INDEX idx_vector_id (vector_id),
     INDEX idx_filename (filename),
+    INDEX idx_images_digest (digest),
+    INDEX idx_images_duplicate_of (duplicate_of),
+    INDEX idx_images_width (width),
+    INDEX idx_images_height (height),
+    INDEX idx_images_captured_at (captured_at),
+    INDEX idx_images_deleted_at (deleted_at),
     FOREIGN KEY (record_id) REFERENCES records(id) ON DELETE CASCADE
 );
 
+-- Content-addressed image files shared by every image of a tenant with the same bytes
+CREATE TABLE IF NOT EXISTS blobs (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    digest VARCHAR(64) NOT NULL,
+    path VARCHAR(500) NOT NULL,
+    size BIGINT NOT NULL,
+    ref_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_blobs_tenant_digest (tenant_id, digest)
+);
+
+-- Corpus-wide duplicate scans and the clusters of similar images they found
+CREATE TABLE IF NOT EXISTS duplicate_scans (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    threshold DOUBLE,
+    neighbors BIGINT,
+    images_scanned BIGINT,
+    cluster_count BIGINT,
+    error VARCHAR(1000),
+    requested_by VARCHAR(191),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP NULL,
+    INDEX idx_duplicate_scans_tenant_id (tenant_id)
+);
+
+CREATE TABLE IF NOT EXISTS duplicate_scan_clusters (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    scan_id BIGINT NOT NULL,
+    size BIGINT,
+    keeper_image_id BIGINT,
+    image_ids JSON,
+    resolution VARCHAR(16),
+    resolved_at TIMESTAMP NULL,
+    INDEX idx_duplicate_scan_clusters_tenant_id (tenant_id),
+    INDEX idx_duplicate_scan_clusters_scan_id (scan_id)
+);
+
+-- Tags shared by records and images
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT NOT NULL DEFAULT 0,
+    name VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_tags_tenant_name (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS record_tags (
+    record_id BIGINT NOT NULL,
+    tag_id BIGINT NOT NULL,
+    PRIMARY KEY (record_id, tag_id),
+    FOREIGN KEY (record_id) REFERENCES records(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS image_tags (
+    image_id BIGINT NOT NULL,
+    tag_id BIGINT NOT NULL,
+    PRIMARY KEY (image_id, tag_id),
+    FOREIGN KEY (image_id) REFERENCES images(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+-- Hashed API keys with comma separated scopes
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    rate_limits JSON,
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_tenant_id (tenant_id),
+    UNIQUE INDEX idx_api_keys_key_hash (key_hash)
+);
+
+-- Append-only audit log of record and image mutations
+CREATE TABLE IF NOT EXISTS audit_entries (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    actor VARCHAR(191) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    entity_type VARCHAR(32) NOT NULL,
+    entity_id BIGINT NOT NULL,
+    changes JSON,
+    request_id VARCHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_audit_tenant_created (tenant_id, created_at),
+    INDEX idx_audit_entity (entity_type, entity_id),
+    INDEX idx_actor (actor),
+    INDEX idx_request_id (request_id)
+);
+
 -- Sample data for testing
-INSERT INTO records (name, description) VALUES
-('Sample Cat', 'A cute domestic cat'),
-('Sample Dog', 'A friendly golden retriever'),
-('Sample Landscape', 'Beautiful mountain landscape');
-
-INSERT INTO images (record_id, filename, path, vector_id) VALUES
-(1, 'cat1.jpg', './uploads/cat1.jpg', 'vec_cat_001'),
-(1, 'cat2.jpg', './uploads/cat2.jpg', 'vec_cat_002'),
-(2, 'dog1.jpg', './uploads/dog1.jpg', 'vec_dog_001'),
-(3, 'landscape1.jpg', './uploads/landscape1.jpg', 'vec_landscape_001');
\ No newline at end of file
+INSERT INTO records (tenant_id, dataset_id, name, description) VALUES
+(1, 1, 'Sample Cat', 'A cute domestic cat'),
+(1, 1, 'Sample Dog', 'A friendly golden retriever'),
+(1, 1, 'Sample Landscape', 'Beautiful mountain landscape');
+
+INSERT INTO images (tenant_id, record_id, filename, path, vector_id) VALUES
+(1, 1, 'cat1.jpg', 'default/cat1.jpg', 'vec_cat_001'),
+(1, 1, 'cat2.jpg', 'default/cat2.jpg', 'vec_cat_002'),
+(1, 2, 'dog1.jpg', 'default/dog1.jpg', 'vec_dog_001'),
+(1, 3, 'landscape1.jpg', 'default/landscape1.jpg', 'vec_landscape_001');
+-- Snapshot of a record's fields and image set after every change
+CREATE TABLE IF NOT EXISTS record_versions (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    record_id BIGINT NOT NULL,
+    version INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    visibility VARCHAR(16) NOT NULL,
+    attributes JSON,
+    image_ids JSON,
+    actor VARCHAR(191) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_tenant_id (tenant_id),
+    UNIQUE INDEX idx_record_versions_record_version (record_id, version),
+    FOREIGN KEY (record_id) REFERENCES records(id) ON DELETE CASCADE
+);
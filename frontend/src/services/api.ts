@@ -2,6 +2,7 @@ import axios from 'axios';
 import type { Record, SearchResponse, PaginatedResponse, CreateRecordRequest, UpdateRecordRequest } from '@/types';
 
 const API_BASE_URL = import.meta.env.VITE_API_URL || '/api/v1';
+export const ACCESS_TOKEN_KEY = 'access_token';
 
 const api = axios.create({
   baseURL: API_BASE_URL,
@@ -14,7 +15,11 @@ const api = axios.create({
 // Request interceptor
 api.interceptors.request.use(
   (config) => {
-    // Add any auth tokens here if needed
+    // The SSO sign-in flow stores the identity provider's access token here
+    const token = localStorage.getItem(ACCESS_TOKEN_KEY);
+    if (token) {
+      config.headers.Authorization = `Bearer ${token}`;
+    }
     return config;
   },
   (error) => {